@@ -12,6 +12,10 @@
 // The following architectures/cores are supported/tested:
 //  * ARMv7-A / Cortex-A7 (single-core)
 //
+// The TamaGo runtime executes all goroutines on the boot core, secondary cores
+// are not started and therefore no goroutine affinity or priority control is
+// available, such scheduling hints require SMP support in the runtime itself.
+//
 // This package is only meant to be used with `GOOS=tamago GOARCH=arm` as
 // supported by the TamaGo framework for bare metal Go on ARM SoCs, see
 // https://github.com/f-secure-foundry/tamago.
@@ -46,10 +50,23 @@ type CPU struct {
 	virtualization   bool
 	genericTimer     bool
 
+	// GIC distributor and CPU interface base addresses
+	gicd uint32
+	gicc uint32
+
+	// first-level translation table base address
+	ttb uint32
+
 	// timer multiplier
 	TimerMultiplier int64
 	// timer function
 	TimerFn func() int64
+	// timer value at initialization, subtracted from the TimerFn value so
+	// that its conversion to nanoseconds does not overflow regardless of
+	// the counter value at boot
+	TimerOffset int64
+	// timer backend, set by InitGlobalTimers() or InitGenericTimers()
+	Timer Timer
 }
 
 // defined in arm.s
@@ -67,6 +84,34 @@ func (cpu *CPU) Mode() int {
 	return int(read_cpsr() & 0x1f)
 }
 
+// Mode represents a processor mode (see *_MODE constants).
+type Mode int
+
+// String returns the processor mode name.
+func (m Mode) String() string {
+	return ModeName(int(m))
+}
+
+// CurrentMode returns the current processor mode, read from CPSR.M.
+func CurrentMode() Mode {
+	return Mode(read_cpsr() & 0x1f)
+}
+
+// InException returns whether the processor is executing in an exception
+// handling mode (FIQ, IRQ, Abort or Undefined), allowing assertions on
+// functions which must not be invoked from interrupt handlers.
+//
+// Monitor mode is not reported as an exception mode, as it is the regular
+// execution mode of secure monitor code.
+func InException() bool {
+	switch CurrentMode() {
+	case FIQ_MODE, IRQ_MODE, ABT_MODE, UND_MODE:
+		return true
+	}
+
+	return false
+}
+
 // ModeName returns the processor mode name.
 func ModeName(mode int) string {
 	switch mode {
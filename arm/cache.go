@@ -12,6 +12,8 @@ package arm
 // ARM cache register constants
 const (
 	ACTLR_SMP = 6
+
+	CTR_DMINLINE = 16
 )
 
 // defined in cache.s
@@ -21,6 +23,10 @@ func cache_enable()
 func cache_disable()
 func cache_flush_data()
 func cache_flush_instruction()
+func read_ctr() uint32
+func cache_clean_range(start uint32, end uint32, line uint32)
+func cache_flush_range(start uint32, end uint32, line uint32)
+func cache_invalidate_range(start uint32, end uint32, line uint32)
 
 // EnableSMP sets the SMP bit in Cortex-A7 Auxiliary Control Register, to
 // enable coherent requests to the processor. This must be ensured before
@@ -51,3 +57,67 @@ func (cpu *CPU) CacheFlushData() {
 func (cpu *CPU) CacheFlushInstruction() {
 	cache_flush_instruction()
 }
+
+// cacheLineSize returns the smallest data cache line size, in bytes, from the
+// Cache Type Register.
+func cacheLineSize() uint32 {
+	return 4 << ((read_ctr() >> CTR_DMINLINE) & 0xf)
+}
+
+// CacheCleanRange cleans the ARM data cache lines, to the point of coherency,
+// which hold the argument memory range, without invalidating them. It can be
+// used, in place of CacheFlushRange(), before handing over memory written by
+// the CPU to a DMA master which only reads it (e.g. transmit buffers and DMA
+// descriptors), so that the CPU can keep accessing it from the cache.
+func (cpu *CPU) CacheCleanRange(addr uint32, size int) {
+	if size <= 0 {
+		return
+	}
+
+	line := cacheLineSize()
+	start := addr &^ (line - 1)
+
+	cache_clean_range(start, addr+uint32(size), line)
+}
+
+// CacheFlushRange cleans and invalidates the ARM data cache lines, to the point
+// of coherency, which hold the argument memory range. It must be used before
+// handing over memory, written by the CPU, to a DMA master.
+func (cpu *CPU) CacheFlushRange(addr uint32, size int) {
+	if size <= 0 {
+		return
+	}
+
+	line := cacheLineSize()
+	start := addr &^ (line - 1)
+
+	cache_flush_range(start, addr+uint32(size), line)
+}
+
+// CacheInvalidateRange invalidates the ARM data cache lines, to the point of
+// coherency, which hold the argument memory range. It must be used before
+// reading memory written by a DMA master.
+//
+// Lines which are only partially covered by the range, at its start and end,
+// are cleaned before invalidation to preserve adjacent data, such data must
+// therefore not be modified by the CPU while the DMA master writes to the
+// range.
+func (cpu *CPU) CacheInvalidateRange(addr uint32, size int) {
+	if size <= 0 {
+		return
+	}
+
+	line := cacheLineSize()
+	start := addr &^ (line - 1)
+	end := addr + uint32(size)
+
+	if start != addr {
+		cache_flush_range(start, start+line, line)
+	}
+
+	if end&(line-1) != 0 {
+		cache_flush_range(end&^(line-1), end, line)
+	}
+
+	cache_invalidate_range(start, end, line)
+}
@@ -112,3 +112,48 @@ TEXT ·cache_flush_instruction(SB),$0
 	MOVW	$0, R0
 	MCR	15, 0, R0, C7, C5, 0
 	RET
+
+// func read_ctr() uint32
+TEXT ·read_ctr(SB),$0-4
+	MRC	15, 0, R0, C0, C0, 1
+	MOVW	R0, ret+0(FP)
+	RET
+
+// func cache_flush_range(start uint32, end uint32, line uint32)
+TEXT ·cache_flush_range(SB),$0-12
+	MOVW	start+0(FP), R0
+	MOVW	end+4(FP), R1
+	MOVW	line+8(FP), R2
+flush_range_loop:
+	MCR	15, 0, R0, C7, C14, 1		// clean & invalidate by MVA to PoC
+	ADD	R2, R0
+	CMP	R1, R0
+	BLO	flush_range_loop
+	WORD	$0xf57ff04f			// DSB SY
+	RET
+
+// func cache_clean_range(start uint32, end uint32, line uint32)
+TEXT ·cache_clean_range(SB),$0-12
+	MOVW	start+0(FP), R0
+	MOVW	end+4(FP), R1
+	MOVW	line+8(FP), R2
+clean_range_loop:
+	MCR	15, 0, R0, C7, C10, 1		// clean by MVA to PoC
+	ADD	R2, R0
+	CMP	R1, R0
+	BLO	clean_range_loop
+	WORD	$0xf57ff04f			// DSB SY
+	RET
+
+// func cache_invalidate_range(start uint32, end uint32, line uint32)
+TEXT ·cache_invalidate_range(SB),$0-12
+	MOVW	start+0(FP), R0
+	MOVW	end+4(FP), R1
+	MOVW	line+8(FP), R2
+invalidate_range_loop:
+	MCR	15, 0, R0, C7, C6, 1		// invalidate by MVA to PoC
+	ADD	R2, R0
+	CMP	R1, R0
+	BLO	invalidate_range_loop
+	WORD	$0xf57ff04f			// DSB SY
+	RET
@@ -12,6 +12,8 @@ package arm
 import (
 	"fmt"
 	_ "unsafe"
+
+	"github.com/f-secure-foundry/tamago/internal/reg"
 )
 
 // ARM exception vector offsets
@@ -26,10 +28,31 @@ const (
 	FIQ            = 0x1c
 )
 
+// The exception vector table consists of one jump instruction for each
+// exception, followed by the handler addresses loaded by such instructions.
+const vecTableSize = 0x40
+
+// defined in exception.s
+func read_vbar() uint32
+func write_vbar(addr uint32)
+
 var exceptionHandlerFn = defaultExceptionHandler
+var interruptHandlerFn func()
 
 //go:linkname exceptionHandler runtime.exceptionHandler
 func exceptionHandler(off int) {
+	if off == IRQ && interruptHandlerFn != nil {
+		recordIRQLatency()
+		interruptHandlerFn()
+		return
+	}
+
+	if off == IRQ && dispatchCPU != nil {
+		recordIRQLatency()
+		dispatchCPU.dispatchInterrupt()
+		return
+	}
+
 	exceptionHandlerFn(off)
 }
 
@@ -45,6 +68,52 @@ func ExceptionHandler(fn func(int)) {
 	exceptionHandlerFn = fn
 }
 
+// InterruptHandler sets the function invoked on IRQ exceptions, taking
+// precedence over registered interrupt handlers (see RegisterInterrupt()) and
+// the exception handler (see ExceptionHandler()). The function is responsible
+// for acknowledging the interrupt (see GetInterrupt() and EndInterrupt()).
+//
+// A nil argument restores handling of IRQ exceptions through registered
+// interrupt handlers or, if none is registered, the exception handler.
+func InterruptHandler(fn func()) {
+	interruptHandlerFn = fn
+}
+
+// VectorBase returns the exception vector table base address (VBAR).
+func (cpu *CPU) VectorBase() uint32 {
+	return read_vbar()
+}
+
+// SetVectorBase relocates the exception vector table to the argument address,
+// which must be 32-byte aligned, by copying the current one and programming
+// the Vector Base Address Register (VBAR).
+//
+// The relocated table requires vecTableSize (64) bytes, the application must
+// guarantee that such memory is never used by the Go runtime. This function
+// requires Security Extensions and does not affect the Monitor mode vector
+// table (MVBAR).
+func (cpu *CPU) SetVectorBase(addr uint32) {
+	if !cpu.security {
+		panic("VBAR requires Security Extensions")
+	}
+
+	if addr&0x1f != 0 {
+		panic("vector table address must be 32-byte aligned")
+	}
+
+	base := read_vbar()
+
+	for off := uint32(0); off < vecTableSize; off += 4 {
+		reg.Write(addr+off, reg.Read(base+off))
+	}
+
+	// ensure that the copied instructions are fetched
+	cache_flush_data()
+	cache_flush_instruction()
+
+	write_vbar(addr)
+}
+
 // VectorName returns the exception vector offset name.
 func VectorName(off int) string {
 	switch off {
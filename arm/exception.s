@@ -0,0 +1,23 @@
+// ARM processor support
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// func read_vbar() uint32
+TEXT ·read_vbar(SB),$0-4
+	MRC	15, 0, R0, C12, C0, 0	// Read VBAR into R0
+	MOVW	R0, ret+0(FP)
+
+	RET
+
+// func write_vbar(addr uint32)
+TEXT ·write_vbar(SB),$0-4
+	MOVW	addr+0(FP), R0
+	MCR	15, 0, R0, C12, C0, 0	// Write R0 into VBAR
+	WORD	$0xf57ff06f		// isb sy
+
+	RET
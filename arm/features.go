@@ -25,11 +25,57 @@ const (
 	ID_PFR1_M_PROFILE_MODEL_MASK   = 0x00f00
 	ID_PFR1_VIRTUALIZATION_MASK    = 0x0f000
 	ID_PFR1_GENERIC_TIMER_MASK     = 0xf0000
+
+	// B4.1.105 MIDR, Main ID Register, VMSA
+	MIDR_IMPLEMENTER  = 24
+	MIDR_VARIANT      = 20
+	MIDR_ARCHITECTURE = 16
+	MIDR_PART_NUMBER  = 4
+	MIDR_REVISION     = 0
+)
+
+// ARM implementer codes and primary part numbers
+const (
+	IMPLEMENTER_ARM = 0x41
+
+	PART_CORTEX_A7 = 0xc07
+	PART_CORTEX_A9 = 0xc09
 )
 
-// defined in arm.s
+// CoreInfo represents the processor identification, as reported by the Main ID
+// Register (MIDR).
+type CoreInfo struct {
+	// implementer code (e.g. IMPLEMENTER_ARM)
+	Implementer uint32
+	// major revision number (rN in rNpN)
+	Variant uint32
+	// architecture code (0xf for architectures defined by CPUID scheme)
+	Architecture uint32
+	// primary part number (e.g. PART_CORTEX_A7, PART_CORTEX_A9)
+	PartNumber uint32
+	// minor revision number (pN in rNpN)
+	Revision uint32
+}
+
+// defined in features.s
 func read_idpfr0() uint32
 func read_idpfr1() uint32
+func read_midr() uint32
+
+// CoreID returns the processor core identification, allowing decisions on
+// errata and core specific features (e.g. global timers on Cortex-A9, generic
+// timers on Cortex-A7) to be taken on the core rather than the SoC.
+func CoreID() (info CoreInfo) {
+	midr := read_midr()
+
+	info.Implementer = (midr >> MIDR_IMPLEMENTER) & 0xff
+	info.Variant = (midr >> MIDR_VARIANT) & 0xf
+	info.Architecture = (midr >> MIDR_ARCHITECTURE) & 0xf
+	info.PartNumber = (midr >> MIDR_PART_NUMBER) & 0xfff
+	info.Revision = (midr >> MIDR_REVISION) & 0xf
+
+	return
+}
 
 func (cpu *CPU) initFeatures() {
 	idpfr0 := read_idpfr0()
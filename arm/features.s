@@ -38,3 +38,13 @@ TEXT ·read_idpfr1(SB),$0-4
 	MOVW	R0, ret+0(FP)
 
 	RET
+
+// func read_midr() uint32
+TEXT ·read_midr(SB),$0-4
+	// ARM Architecture Reference Manual - ARMv7-A and ARMv7-R edition
+	//
+	// B4.1.105 MIDR, Main ID Register, VMSA
+	MRC	15, 0, R0, C0, C0, 0
+	MOVW	R0, ret+0(FP)
+
+	RET
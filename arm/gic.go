@@ -0,0 +1,274 @@
+// ARM processor support
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package arm
+
+import (
+	"github.com/f-secure-foundry/tamago/internal/reg"
+)
+
+// Generic Interrupt Controller (GIC) registers
+// (4.1.2 Distributor register map, 4.1.3 CPU interface register map,
+// ARM Generic Interrupt Controller Architecture Specification v2.0).
+const (
+	GICD_CTLR    = 0x000
+	CTLR_ENABLE  = 0
+	GICD_TYPER   = 0x004
+	TYPER_ITLINE = 0
+
+	GICD_IGROUPR    = 0x080
+	GICD_ISENABLER  = 0x100
+	GICD_ICENABLER  = 0x180
+	GICD_ISPENDR    = 0x200
+	GICD_ICPENDR    = 0x280
+	GICD_ISACTIVER  = 0x300
+	GICD_ICACTIVER  = 0x380
+	GICD_IPRIORITYR = 0x400
+	GICD_ITARGETSR  = 0x800
+
+	GICC_CTLR = 0x000
+	GICC_PMR  = 0x004
+	GICC_IAR  = 0x00c
+	GICC_EOIR = 0x010
+
+	// spurious interrupt ID
+	GIC_SPURIOUS = 1023
+	// maximum number of interrupt IDs
+	GIC_MAX_INTERRUPTS = 1020
+
+	// Software Generated Interrupts (SGIs) and Private Peripheral Interrupts
+	// (PPIs) are banked for each core, Shared Peripheral Interrupts (SPIs)
+	// start at this ID.
+	GIC_SPI_START = 32
+)
+
+// Registered interrupt handlers, a fixed size array is used as the table is
+// accessed in interrupt context.
+var interruptHandlers [GIC_MAX_INTERRUPTS]func()
+
+// CPU instance dispatching interrupts to registered handlers, set by
+// RegisterInterrupt().
+var dispatchCPU *CPU
+
+// InitGIC initializes the ARM Generic Interrupt Controller (GIC), taking the
+// distributor and CPU interface base addresses as arguments.
+//
+// All interrupts are disabled, configured with the same priority and targeted
+// to the current core, they can be individually enabled with
+// EnableInterrupt().
+func (cpu *CPU) InitGIC(dist uint32, cpuif uint32) {
+	cpu.gicd = dist
+	cpu.gicc = cpuif
+
+	// disable distributor
+	reg.Clear(cpu.gicd+GICD_CTLR, CTLR_ENABLE)
+
+	n := cpu.Interrupts()
+
+	for i := 0; i < n/32; i++ {
+		off := uint32(i * 4)
+		// disable all interrupts
+		reg.Write(cpu.gicd+GICD_ICENABLER+off, 0xffffffff)
+		// clear all pending and active states
+		reg.Write(cpu.gicd+GICD_ICPENDR+off, 0xffffffff)
+		reg.Write(cpu.gicd+GICD_ICACTIVER+off, 0xffffffff)
+	}
+
+	for i := 0; i < n/4; i++ {
+		off := uint32(i * 4)
+		// highest priority for all interrupts
+		reg.Write(cpu.gicd+GICD_IPRIORITYR+off, 0)
+
+		// target shared peripheral interrupts to CPU0
+		if i >= 8 {
+			reg.Write(cpu.gicd+GICD_ITARGETSR+off, 0x01010101)
+		}
+	}
+
+	// enable distributor
+	reg.Set(cpu.gicd+GICD_CTLR, CTLR_ENABLE)
+
+	// do not mask any interrupt priority
+	reg.Write(cpu.gicc+GICC_PMR, 0xff)
+	// enable CPU interface
+	reg.Set(cpu.gicc+GICC_CTLR, CTLR_ENABLE)
+}
+
+// Interrupts returns the number of interrupt IDs supported by the GIC, zero is
+// returned if the GIC has not been initialized (see InitGIC()).
+func (cpu *CPU) Interrupts() int {
+	if cpu.gicd == 0 {
+		return 0
+	}
+
+	return 32 * (int(reg.Get(cpu.gicd+GICD_TYPER, TYPER_ITLINE, 0x1f)) + 1)
+}
+
+// EnableInterrupt enables forwarding of the argument interrupt ID to the CPU
+// interface.
+func (cpu *CPU) EnableInterrupt(id int) {
+	if id < 0 || id >= cpu.Interrupts() {
+		return
+	}
+
+	reg.Write(cpu.gicd+GICD_ISENABLER+uint32(4*(id/32)), 1<<(id%32))
+}
+
+// DisableInterrupt disables forwarding of the argument interrupt ID to the CPU
+// interface.
+func (cpu *CPU) DisableInterrupt(id int) {
+	if id < 0 || id >= cpu.Interrupts() {
+		return
+	}
+
+	reg.Write(cpu.gicd+GICD_ICENABLER+uint32(4*(id/32)), 1<<(id%32))
+}
+
+// InterruptEnabled returns whether forwarding of the argument interrupt ID to
+// the CPU interface is enabled.
+func (cpu *CPU) InterruptEnabled(id int) bool {
+	if id < 0 || id >= cpu.Interrupts() {
+		return false
+	}
+
+	return reg.Get(cpu.gicd+GICD_ISENABLER+uint32(4*(id/32)), id%32, 1) == 1
+}
+
+// GetInterrupt acknowledges and returns the highest priority pending
+// interrupt ID, GIC_SPURIOUS is returned when no interrupt is pending.
+func (cpu *CPU) GetInterrupt() (id int) {
+	if cpu.gicc == 0 {
+		return GIC_SPURIOUS
+	}
+
+	return int(reg.Read(cpu.gicc+GICC_IAR) & 0x3ff)
+}
+
+// EndInterrupt signals completion of the processing of an interrupt ID
+// previously returned by GetInterrupt().
+func (cpu *CPU) EndInterrupt(id int) {
+	if cpu.gicc == 0 || id == GIC_SPURIOUS {
+		return
+	}
+
+	reg.Write(cpu.gicc+GICC_EOIR, uint32(id))
+}
+
+// SetInterruptPriority sets the priority of the argument interrupt ID, lower
+// values correspond to higher priorities. All interrupts are configured with
+// the highest priority (0) by InitGIC().
+//
+// The priority determines which interrupt is acknowledged first, among those
+// pending, by GetInterrupt(). The GIC might implement only the most
+// significant bits of each priority value, the remaining ones are ignored.
+//
+// For SGIs and PPIs (IDs lower than GIC_SPI_START) the setting applies only to
+// the current core, as their configuration is banked.
+func (cpu *CPU) SetInterruptPriority(id int, priority uint8) {
+	if id < 0 || id >= cpu.Interrupts() {
+		return
+	}
+
+	reg.SetN(cpu.gicd+GICD_IPRIORITYR+uint32(4*(id/4)), 8*(id%4), 0xff, uint32(priority))
+}
+
+// RegisterInterrupt sets the function invoked, in interrupt context, on the
+// assertion of the argument interrupt ID, a nil handler removes any previous
+// registration. The interrupt must be enabled separately (see
+// EnableInterrupt()).
+//
+// Unless an application IRQ handler is set (see InterruptHandler()), which
+// takes precedence, IRQ exceptions are dispatched to registered handlers as
+// follows:
+//   * the interrupt is acknowledged with GetInterrupt() (GICC_IAR read)
+//   * the registered handler, if any, is invoked
+//   * the end of interrupt is signaled with EndInterrupt() (GICC_EOIR write)
+//
+// Handlers are therefore not required to acknowledge the interrupt with the
+// GIC, but must clear its assertion at the peripheral (e.g. by servicing its
+// status register) before returning, level-sensitive interrupts are otherwise
+// taken again immediately. Interrupts without a registered handler are
+// disabled on their first occurrence, to prevent interrupt storms.
+//
+// Handlers run with interrupts masked and must not block or allocate memory,
+// the CPU interrupts must be enabled (see InterruptsEnable()) for handlers to
+// be invoked. The function has no effect if the GIC has not been initialized
+// (see InitGIC()), or does not support the argument ID, so that drivers can
+// fall back to polling.
+func (cpu *CPU) RegisterInterrupt(id int, handler func()) {
+	if id < 0 || id >= cpu.Interrupts() {
+		return
+	}
+
+	interruptHandlers[id] = handler
+	dispatchCPU = cpu
+}
+
+// dispatchInterrupt acknowledges the highest priority pending interrupt and
+// invokes its registered handler (see RegisterInterrupt()).
+func (cpu *CPU) dispatchInterrupt() {
+	id := cpu.GetInterrupt()
+
+	if id >= GIC_MAX_INTERRUPTS {
+		return
+	}
+
+	if handler := interruptHandlers[id]; handler != nil {
+		handler()
+	} else {
+		cpu.DisableInterrupt(id)
+	}
+
+	cpu.EndInterrupt(id)
+}
+
+// interruptSet returns the interrupt IDs whose bit is set in the argument
+// distributor register array.
+func (cpu *CPU) interruptSet(off uint32) (ids []int) {
+	n := cpu.Interrupts()
+
+	for i := 0; i < n/32; i++ {
+		val := reg.Read(cpu.gicd + off + uint32(i*4))
+
+		for j := 0; val != 0; j++ {
+			if val&1 == 1 {
+				ids = append(ids, i*32+j)
+			}
+
+			val >>= 1
+		}
+	}
+
+	return
+}
+
+// PendingInterrupts returns the IDs of all interrupts in pending state, for
+// debugging purposes (e.g. to identify the source of an interrupt storm).
+func (cpu *CPU) PendingInterrupts() []int {
+	return cpu.interruptSet(GICD_ISPENDR)
+}
+
+// ActiveInterrupts returns the IDs of all interrupts in active state, which
+// have been acknowledged but whose processing has not been completed (see
+// GetInterrupt(), EndInterrupt()), for debugging purposes (e.g. to identify
+// stuck handlers).
+func (cpu *CPU) ActiveInterrupts() []int {
+	return cpu.interruptSet(GICD_ISACTIVER)
+}
+
+// ClearPending removes the pending state of the argument interrupt ID, to
+// recover from spurious assertions. Level-sensitive interrupts become pending
+// again if their source is still asserted.
+func (cpu *CPU) ClearPending(id int) {
+	if id < 0 || id >= cpu.Interrupts() {
+		return
+	}
+
+	reg.Write(cpu.gicd+GICD_ICPENDR+uint32(4*(id/32)), 1<<(id%32))
+}
@@ -12,6 +12,12 @@ package arm
 // defined in irq.s
 func irq_enable()
 func irq_disable()
+func irq_save() uint32
+func irq_restore()
+func wait_interrupt()
+
+// CPSR IRQ mask bit
+const CPSR_I = 7
 
 // InterruptsEnable enables IRQ and FIQ interrupts.
 func (cpu *CPU) InterruptsEnable() {
@@ -22,3 +28,26 @@ func (cpu *CPU) InterruptsEnable() {
 func (cpu *CPU) InterruptsDisable() {
 	irq_disable()
 }
+
+// DisableInterrupts disables IRQ interrupts, to enter a critical section, and
+// returns a function which restores their previous state, to exit it (e.g.
+// `defer ARM.DisableInterrupts()()`).
+//
+// Unlike InterruptsDisable() the previous state is preserved, therefore
+// critical sections can be nested. FIQ interrupts are not affected.
+func (cpu *CPU) DisableInterrupts() (restore func()) {
+	cpsr := irq_save()
+
+	return func() {
+		if cpsr&(1<<CPSR_I) == 0 {
+			irq_restore()
+		}
+	}
+}
+
+// WaitInterrupt suspends execution until an interrupt, or another wake-up
+// event, is signaled to the processor (WFI). The wake-up takes place even if
+// interrupts are masked, without the exception being taken.
+func (cpu *CPU) WaitInterrupt() {
+	wait_interrupt()
+}
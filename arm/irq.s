@@ -9,8 +9,34 @@
 
 // func irq_enable()
 TEXT ·irq_enable(SB),$0
-	WORD	$0xc00108f1	// CPSIE iaf
+	WORD	$0xf10801c0	// CPSIE iaf
+
+	RET
 
 // func irq_disable()
 TEXT ·irq_disable(SB),$0
-	WORD	$0xc0010cf1	// CPSID iaf
+	WORD	$0xf10c01c0	// CPSID iaf
+
+	RET
+
+// func irq_save() uint32
+TEXT ·irq_save(SB),$0-4
+	WORD	$0xe10f0000	// mrs r0, CPSR
+	WORD	$0xf10c0080	// CPSID i
+
+	MOVW	R0, ret+0(FP)
+
+	RET
+
+// func irq_restore()
+TEXT ·irq_restore(SB),$0
+	WORD	$0xf1080080	// CPSIE i
+
+	RET
+
+// func wait_interrupt()
+TEXT ·wait_interrupt(SB),$0
+	WORD	$0xf57ff04f	// dsb sy
+	WORD	$0xe320f003	// wfi
+
+	RET
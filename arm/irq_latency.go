@@ -0,0 +1,61 @@
+// ARM processor support
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// +build irqlatency
+
+package arm
+
+import (
+	"time"
+)
+
+// maximum latency, in system counter ticks
+var maxIRQLatency int64
+
+// recordIRQLatency measures the time elapsed between assertion of the generic
+// timer interrupt, which takes place when the system counter reaches the
+// comparator value (see SetAlarm()), and IRQ handler entry.
+//
+// The generic timer registers are undefined on cores which do not implement
+// it (e.g. Cortex-A9), the measurement is therefore only performed once the
+// generic timer is initialized on a core supporting it.
+func recordIRQLatency() {
+	if cpu := genericTimerCPU; cpu == nil || !cpu.genericTimer {
+		return
+	}
+
+	ctl := read_cntp_ctl()
+
+	if ctl&(1<<CNTP_CTL_ENABLE) == 0 || ctl&(1<<CNTP_CTL_ISTATUS) == 0 {
+		return
+	}
+
+	if latency := read_cntpct() - read_cntp_cval(); latency > maxIRQLatency {
+		maxIRQLatency = latency
+	}
+}
+
+// MaxIRQLatency returns the worst case interrupt latency measured so far on
+// generic timer interrupts, the measurement is only available when compiling
+// with the `irqlatency` build tag and on cores implementing the generic timer
+// (e.g. Cortex-A7), otherwise 0 is returned.
+//
+// The latency is measured between the interrupt assertion, when the system
+// counter reaches the timer comparator value (see SetAlarm()), and the
+// invocation of the IRQ handler (see InterruptHandler()). Periodically
+// triggering timer interrupts measures the impact of code sections running
+// with interrupts masked.
+func (cpu *CPU) MaxIRQLatency() time.Duration {
+	return time.Duration(maxIRQLatency * cpu.TimerMultiplier)
+}
+
+// ResetIRQLatency clears the worst case interrupt latency measurement.
+func (cpu *CPU) ResetIRQLatency() {
+	maxIRQLatency = 0
+}
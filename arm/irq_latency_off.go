@@ -0,0 +1,28 @@
+// ARM processor support
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// +build !irqlatency
+
+package arm
+
+import (
+	"time"
+)
+
+func recordIRQLatency() {}
+
+// MaxIRQLatency returns the worst case interrupt latency measured so far on
+// generic timer interrupts, the measurement is only available when compiling
+// with the `irqlatency` build tag, otherwise 0 is returned.
+func (cpu *CPU) MaxIRQLatency() time.Duration {
+	return 0
+}
+
+// ResetIRQLatency clears the worst case interrupt latency measurement.
+func (cpu *CPU) ResetIRQLatency() {}
@@ -0,0 +1,145 @@
+// ARM processor support
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package arm
+
+import (
+	"errors"
+	"unsafe"
+
+	"github.com/f-secure-foundry/tamago/internal/reg"
+)
+
+// First-level section descriptor fields
+// (B3.5.1 Short-descriptor translation table format descriptors,
+// ARM Architecture Reference Manual ARMv7-A and ARMv7-R edition).
+const (
+	TTE_SECTION = 0b10
+	TTE_B       = 2
+	TTE_C       = 3
+	TTE_XN      = 4
+	TTE_DOMAIN  = 5
+	TTE_AP      = 10
+	TTE_TEX     = 12
+	TTE_S       = 16
+
+	// full access at any privilege level
+	TTE_AP_RW = 0b11
+)
+
+const (
+	// number of first-level entries, each mapping a 1MB section
+	l1TableEntries = 4096
+	// first-level translation table size and alignment
+	l1TableSize = l1TableEntries * 4
+	// section size
+	sectionSize = 1 << 20
+)
+
+// MemoryAttr represents the memory type and attributes of a first-level
+// section (see ConfigureMMU()).
+type MemoryAttr uint32
+
+// Memory region attributes
+// (B3.8.2 Short-descriptor format memory region attributes, without TEX
+// remap, ARM Architecture Reference Manual ARMv7-A and ARMv7-R edition).
+const (
+	// Strongly-ordered memory (TEX=0b000 C=0 B=0), the default for all
+	// sections, matching the attributes of data accesses with the MMU
+	// disabled.
+	MEMORY_STRONGLY_ORDERED MemoryAttr = 0
+
+	// Device memory (TEX=0b000 C=0 B=1), never executable, for peripheral
+	// registers.
+	MEMORY_DEVICE MemoryAttr = 1<<TTE_B | 1<<TTE_XN
+
+	// Normal memory, non-cacheable (TEX=0b001 C=0 B=0), for buffers shared
+	// with DMA masters.
+	MEMORY_NORMAL_UNCACHED MemoryAttr = 0b001 << TTE_TEX
+
+	// Normal memory, inner and outer write-back write-allocate cacheable
+	// (TEX=0b001 C=1 B=1), for RAM.
+	MEMORY_NORMAL MemoryAttr = 0b001<<TTE_TEX | 1<<TTE_C | 1<<TTE_B | 1<<TTE_S
+)
+
+// defined in mmu.s
+func set_ttbr0(addr uint32)
+func mmu_enable()
+func tlb_invalidate()
+
+// First-level translation table storage, sized to allow its alignment, as
+// required by TTBR0, within the Go image rather than in memory which must be
+// reserved from the runtime.
+var l1Table [2 * l1TableEntries]uint32
+
+// InitMMU enables the Memory Management Unit with a flat (identity) mapping of
+// the 4GB address space, using a first-level translation table of 1MB
+// sections, all set as MEMORY_STRONGLY_ORDERED, so that the memory attributes
+// in effect are not changed by this function.
+//
+// The attributes of each memory region can be set afterwards with
+// ConfigureMMU(), RAM must be set as MEMORY_NORMAL for the data cache to have
+// any effect.
+func (cpu *CPU) InitMMU() {
+	if cpu.ttb != 0 {
+		return
+	}
+
+	addr := uint32(uintptr(unsafe.Pointer(&l1Table[0])))
+	cpu.ttb = (addr + l1TableSize - 1) &^ (l1TableSize - 1)
+
+	for i := uint32(0); i < l1TableEntries; i++ {
+		reg.Write(cpu.ttb+i*4, section(i, MEMORY_STRONGLY_ORDERED))
+	}
+
+	set_ttbr0(cpu.ttb)
+	mmu_enable()
+}
+
+// section returns the first-level section descriptor for the argument section
+// index and memory attributes.
+func section(i uint32, attr MemoryAttr) uint32 {
+	return i*sectionSize | TTE_AP_RW<<TTE_AP | uint32(attr) | TTE_SECTION
+}
+
+// ConfigureMMU sets the memory attributes of the 1MB sections holding the
+// argument memory range, where end is exclusive, overriding any previous
+// configuration. An error is returned if the MMU has not been initialized
+// (see InitMMU()), as the attributes would otherwise be silently discarded.
+//
+// The data cache is flushed before the update, so that no dirty lines are left
+// for regions which become non-cacheable, and the TLBs are then invalidated,
+// so that the new attributes are in effect as soon as the function returns.
+//
+// Regions accessed by DMA masters without cache maintenance (see
+// CacheFlushRange(), CacheInvalidateRange()) must not be set as MEMORY_NORMAL.
+func (cpu *CPU) ConfigureMMU(start uint32, end uint32, attr MemoryAttr) (err error) {
+	if cpu.ttb == 0 {
+		return errors.New("MMU not initialized")
+	}
+
+	if end <= start {
+		return errors.New("invalid memory range")
+	}
+
+	first := start / sectionSize
+	last := (end - 1) / sectionSize
+
+	cache_flush_data()
+
+	for i := first; i <= last; i++ {
+		reg.Write(cpu.ttb+i*4, section(i, attr))
+	}
+
+	// translation table walks are not cacheable
+	cache_flush_range(cpu.ttb+first*4, cpu.ttb+(last+1)*4, cacheLineSize())
+	tlb_invalidate()
+
+	return
+}
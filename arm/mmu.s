@@ -0,0 +1,52 @@
+// ARM processor support
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// func set_ttbr0(addr uint32)
+TEXT ·set_ttbr0(SB),$0-4
+	MOVW	addr+0(FP), R0
+
+	// use TTBR0 for all translations (TTBCR.N = 0)
+	MOVW	$0, R1
+	MCR	15, 0, R1, C2, C0, 2
+
+	// set domain 0 as client, access permissions are checked
+	MOVW	$1, R1
+	MCR	15, 0, R1, C3, C0, 0
+
+	// set translation table base, non-cacheable walks
+	MCR	15, 0, R0, C2, C0, 0
+	WORD	$0xf57ff06f			// ISB SY
+
+	RET
+
+// func mmu_enable()
+TEXT ·mmu_enable(SB),$0
+	MOVW	$0, R0
+	MCR	15, 0, R0, C8, C7, 0		// invalidate unified TLB
+	MCR	15, 0, R0, C7, C5, 6		// invalidate branch predictor
+	WORD	$0xf57ff04f			// DSB SY
+	WORD	$0xf57ff06f			// ISB SY
+
+	MRC	15, 0, R1, C1, C0, 0
+	ORR	$1, R1				// enable MMU
+	MCR	15, 0, R1, C1, C0, 0
+	WORD	$0xf57ff06f			// ISB SY
+
+	RET
+
+// func tlb_invalidate()
+TEXT ·tlb_invalidate(SB),$0
+	WORD	$0xf57ff04f			// DSB SY
+	MOVW	$0, R0
+	MCR	15, 0, R0, C8, C7, 0		// invalidate unified TLB
+	MCR	15, 0, R0, C7, C5, 6		// invalidate branch predictor
+	WORD	$0xf57ff04f			// DSB SY
+	WORD	$0xf57ff06f			// ISB SY
+
+	RET
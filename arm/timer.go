@@ -10,8 +10,10 @@
 package arm
 
 import (
+	"time"
 	_ "unsafe"
 
+	"github.com/f-secure-foundry/tamago/internal/clock"
 	"github.com/f-secure-foundry/tamago/internal/reg"
 )
 
@@ -34,6 +36,35 @@ const (
 	CNTCR_HDBG   = 1
 	CNTCR_EN     = 0
 
+	// B4.1.26 CNTP_CTL, PL1 Physical Timer Control register, VMSA
+	CNTP_CTL_ISTATUS = 2
+	CNTP_CTL_IMASK   = 1
+	CNTP_CTL_ENABLE  = 0
+
+	// Generic Timer private peripheral interrupts, Cortex™-A7 MPCore®
+	// Technical Reference Manual r0p5, 8.2.1 Interrupt sources
+	CNTPS_IRQ  = 29
+	CNTPNS_IRQ = 30
+
+	// Cortex™-A9 MPCore® Technical Reference Manual
+	// 4.4 Global timer, watchdogs, and private timers registers
+	//
+	// p214, Table 2-1, ARM MP Global timer, IMX6DQRM
+	GT_BASE       = 0x00a00200
+	GT_CTRL       = GT_BASE + 0x08
+	CTRL_IRQ_EN   = 2
+	CTRL_COMP_EN  = 1
+	CTRL_TIMER_EN = 0
+	GT_ISR        = GT_BASE + 0x0c
+	ISR_EVENT     = 0
+	GT_COMP_LO    = GT_BASE + 0x10
+	GT_COMP_HI    = GT_BASE + 0x14
+
+	// Global Timer private peripheral interrupt, Cortex™-A9 MPCore®
+	// Technical Reference Manual, 3.3 Interrupt distributor interrupt
+	// sources
+	GT_IRQ = 27
+
 	// nanoseconds
 	refFreq int64 = 1000000000
 )
@@ -43,15 +74,114 @@ func read_gtc() int64
 func read_cntfrq() int32
 func write_cntfrq(freq int32)
 func read_cntpct() int64
+func read_cntp_ctl() uint32
+func write_cntp_ctl(val uint32)
+func read_cntp_cval() int64
+func write_cntp_cval(cval int64)
 
 // Busyloop spins the processor for busy waiting purposes, taking a counter
 // value for the number of loops.
 func Busyloop(count int32)
 
+// Delay busy waits for the argument duration by polling the CPU timer (see
+// TimerFn), without relying on the Go scheduler.
+//
+// Unlike time.Sleep(), which requires the runtime scheduler and must therefore
+// only be used after runtime initialization (i.e. not before package init()
+// functions are executed), Delay can be used at any stage once the CPU timers
+// are initialized (see InitGlobalTimers(), InitGenericTimers()), including
+// early hardware initialization (runtime.hwinit). A panic occurs if timers are
+// not initialized yet.
+func (cpu *CPU) Delay(d time.Duration) {
+	if cpu.TimerFn == nil || cpu.TimerMultiplier == 0 {
+		panic("Delay() invoked before timer initialization")
+	}
+
+	end := cpu.TimerFn() + (int64(d)+cpu.TimerMultiplier-1)/cpu.TimerMultiplier
+
+	for cpu.TimerFn() < end {
+		// busy wait
+	}
+}
+
+// Timer represents a CPU timer backend, selected once by the SoC package at
+// initialization (see InitGlobalTimers(), InitGenericTimers()), so that
+// application and driver code does not depend on the processor timer type.
+type Timer interface {
+	// Nanos returns the nanoseconds elapsed since timer initialization.
+	Nanos() int64
+	// SetComparator programs the timer comparator, with the argument time
+	// expressed with the same reference as Nanos(), to assert the timer
+	// interrupt once it is reached.
+	SetComparator(ns int64)
+	// Frequency returns the counter frequency in Hz.
+	Frequency() int64
+}
+
+// TimerNanos converts the argument timer counter value to the nanoseconds
+// elapsed since timer initialization, the counter value at initialization
+// (see TimerOffset) is subtracted before the conversion so that it does not
+// overflow regardless of the counter value at boot.
+func (cpu *CPU) TimerNanos(cnt int64) int64 {
+	return clock.Nanos(cnt, cpu.TimerOffset, cpu.TimerMultiplier)
+}
+
+// globalTimer implements Timer for the ARM Cortex-A9 Global Timer.
+type globalTimer struct {
+	cpu *CPU
+}
+
+func (t *globalTimer) Nanos() int64 {
+	return t.cpu.TimerNanos(read_gtc())
+}
+
+// SetComparator programs the Global Timer comparator, the timer interrupt is
+// GT_IRQ.
+func (t *globalTimer) SetComparator(ns int64) {
+	cval := uint64(ns/t.cpu.TimerMultiplier + t.cpu.TimerOffset)
+
+	// the comparator must be disabled while updated
+	reg.Clear(GT_CTRL, CTRL_COMP_EN)
+	reg.Write(GT_ISR, 1<<ISR_EVENT)
+
+	reg.Write(GT_COMP_LO, uint32(cval))
+	reg.Write(GT_COMP_HI, uint32(cval>>32))
+
+	reg.Set(GT_CTRL, CTRL_IRQ_EN)
+	reg.Set(GT_CTRL, CTRL_COMP_EN)
+}
+
+func (t *globalTimer) Frequency() int64 {
+	return refFreq / t.cpu.TimerMultiplier
+}
+
+// genericTimer implements Timer for the ARM Generic Timer.
+type genericTimer struct {
+	cpu *CPU
+}
+
+func (t *genericTimer) Nanos() int64 {
+	return t.cpu.TimerNanos(read_cntpct())
+}
+
+// SetComparator programs the physical timer comparator (see SetAlarm()).
+func (t *genericTimer) SetComparator(ns int64) {
+	t.cpu.SetAlarm(ns/t.cpu.TimerMultiplier + t.cpu.TimerOffset)
+}
+
+func (t *genericTimer) Frequency() int64 {
+	return int64(read_cntfrq())
+}
+
+// CPU instance using the generic timer, set by InitGenericTimers().
+var genericTimerCPU *CPU
+
 // InitGlobalTimers initializes ARM Cortex-A9 timers.
 func (cpu *CPU) InitGlobalTimers() {
 	cpu.TimerFn = read_gtc
 	cpu.TimerMultiplier = 10
+	cpu.TimerOffset = cpu.TimerFn()
+	cpu.Timer = &globalTimer{cpu: cpu}
 }
 
 // InitGenericTimers initializes ARM Cortex-A7 timers.
@@ -74,4 +204,22 @@ func (cpu *CPU) InitGenericTimers(base uint32, freq int32) {
 
 	cpu.TimerMultiplier = int64(refFreq / timerFreq)
 	cpu.TimerFn = read_cntpct
+	cpu.TimerOffset = cpu.TimerFn()
+	cpu.Timer = &genericTimer{cpu: cpu}
+
+	genericTimerCPU = cpu
+}
+
+// SetAlarm programs the generic timer physical comparator with the argument
+// counter value, the timer interrupt (CNTPS_IRQ in Secure state, CNTPNS_IRQ
+// otherwise) is asserted when the system counter reaches it.
+func (cpu *CPU) SetAlarm(cval int64) {
+	write_cntp_cval(cval)
+	write_cntp_ctl(1 << CNTP_CTL_ENABLE)
+}
+
+// ClearAlarm disables the generic timer physical comparator, deasserting its
+// interrupt.
+func (cpu *CPU) ClearAlarm() {
+	write_cntp_ctl(0)
 }
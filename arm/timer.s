@@ -66,6 +66,54 @@ TEXT ·read_cntpct(SB),$0-8
 
 	RET
 
+// func read_cntp_ctl() uint32
+TEXT ·read_cntp_ctl(SB),$0-4
+	// ARM Architecture Reference Manual - ARMv7-A and ARMv7-R edition
+	//
+	// B4.1.26 CNTP_CTL, PL1 Physical Timer Control register, VMSA
+	WORD	$0xf57ff06f // isb sy
+	MRC	15, 0, R0, C14, C2, 1
+
+	MOVW	R0, ret+0(FP)
+
+	RET
+
+// func write_cntp_ctl(val uint32)
+TEXT ·write_cntp_ctl(SB),$0-4
+	// ARM Architecture Reference Manual - ARMv7-A and ARMv7-R edition
+	//
+	// B4.1.26 CNTP_CTL, PL1 Physical Timer Control register, VMSA
+	MOVW	val+0(FP), R0
+	MCR	15, 0, R0, C14, C2, 1
+	WORD	$0xf57ff06f // isb sy
+
+	RET
+
+// func read_cntp_cval() int64
+TEXT ·read_cntp_cval(SB),$0-8
+	// ARM Architecture Reference Manual - ARMv7-A and ARMv7-R edition
+	//
+	// B4.1.27 CNTP_CVAL, PL1 Physical Timer CompareValue register, VMSA
+	WORD	$0xf57ff06f // isb sy
+	WORD	$0xec510f2e // mrrc p15, 2, r0, r1, c14
+
+	MOVW	R0, ret_lo+0(FP)
+	MOVW	R1, ret_hi+4(FP)
+
+	RET
+
+// func write_cntp_cval(cval int64)
+TEXT ·write_cntp_cval(SB),$0-8
+	// ARM Architecture Reference Manual - ARMv7-A and ARMv7-R edition
+	//
+	// B4.1.27 CNTP_CVAL, PL1 Physical Timer CompareValue register, VMSA
+	MOVW	cval_lo+0(FP), R0
+	MOVW	cval_hi+4(FP), R1
+	WORD	$0xec410f2e // mcrr p15, 2, r0, r1, c14
+	WORD	$0xf57ff06f // isb sy
+
+	RET
+
 // func busyloop(count int32)
 TEXT ·Busyloop(SB),$0-4
 	MOVW count+0(FP), R0
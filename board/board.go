@@ -0,0 +1,63 @@
+// Board descriptor
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// Package board defines a descriptor of board specific hardware assignments
+// (console, LEDs, buttons, storage and network), which board packages fill in
+// to allow drivers and applications to be written without hardcoding
+// peripheral instances (e.g. `imx6.UART2`).
+//
+// This package is only meant to be used with `GOOS=tamago GOARCH=arm` as
+// supported by the TamaGo framework for bare metal Go on ARM SoCs, see
+// https://github.com/f-secure-foundry/tamago.
+package board
+
+import (
+	"github.com/f-secure-foundry/tamago/serial"
+)
+
+// Button represents a board push button.
+type Button struct {
+	// button name
+	Name string
+	// Pressed returns the button state
+	Pressed func() bool
+}
+
+// Storage represents a block storage device (e.g. `usdhc.USDHC`).
+type Storage interface {
+	// ReadBlocks reads the device blocks starting at the argument logical
+	// block address to the buffer.
+	ReadBlocks(lba int, buf []byte) error
+	// WriteBlocks writes the buffer to the device blocks starting at the
+	// argument logical block address.
+	WriteBlocks(lba int, buf []byte) error
+}
+
+// Config represents a board hardware configuration.
+type Config struct {
+	// board model name
+	Name string
+
+	// serial console
+	Console serial.Port
+
+	// LED names, which can be used with SetLED
+	LEDs []string
+	// SetLED turns on/off an LED by name
+	SetLED func(name string, on bool) error
+
+	// push buttons
+	Buttons []Button
+
+	// storage devices, by name
+	Storage map[string]Storage
+
+	// network interface description (e.g. "USB CDC-ECM", "Ethernet")
+	Network string
+}
@@ -0,0 +1,35 @@
+// USB armory Mk II support for tamago/arm
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// +build !minimal
+
+package usbarmory
+
+import (
+	"github.com/f-secure-foundry/tamago/board"
+	"github.com/f-secure-foundry/tamago/soc/imx6"
+)
+
+// Board describes the USB armory Mk II hardware configuration, it is the
+// reference instance for board descriptors (see package board).
+//
+// The USB armory Mk II has no push buttons, custom ones can be added with
+// AddButton(), and networking is available through USB Ethernet emulation on
+// the device port.
+var Board = &board.Config{
+	Name:    "USB armory Mk II",
+	Console: imx6.UART2,
+	LEDs:    []string{"white", "blue"},
+	SetLED:  LED,
+	Storage: map[string]board.Storage{
+		"SD":  SD,
+		"MMC": MMC,
+	},
+	Network: "USB CDC-ECM",
+}
@@ -0,0 +1,202 @@
+// USB armory Mk II support for tamago/arm
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// +build !minimal
+
+package usbarmory
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/f-secure-foundry/tamago/board"
+	"github.com/f-secure-foundry/tamago/soc/imx6"
+)
+
+const (
+	// button debounce interval
+	debounceInterval = 20 * time.Millisecond
+	// number of consecutive matching samples for a stable button state
+	debounceSamples = 4
+)
+
+type button struct {
+	gpio      *imx6.GPIO
+	activeLow bool
+
+	// presses detected by the GPIO interrupt handler
+	presses uint32
+	// press notification state
+	fn      func()
+	running bool
+}
+
+var buttons = make(map[string]*button)
+var buttonsMutex sync.Mutex
+
+// level returns the instantaneous button state.
+func (b *button) level() bool {
+	return b.gpio.Value() != b.activeLow
+}
+
+// pressed returns the debounced button state, as the level observed for a
+// number of consecutive samples over the debounce interval.
+func (b *button) pressed() bool {
+	state := b.level()
+
+	for n := 1; n < debounceSamples; {
+		time.Sleep(debounceInterval / debounceSamples)
+
+		if s := b.level(); s != state {
+			state = s
+			n = 1
+		} else {
+			n++
+		}
+	}
+
+	return state
+}
+
+// AddButton registers a push button connected to the argument GPIO, which is
+// configured as input, under the argument name, for use with Button() and
+// OnButton(). The button is also added to the board descriptor (see Board).
+//
+// The USB armory Mk II has no push buttons, this function allows board
+// variants, or custom designs, to attach buttons (e.g. on a header pin) with
+// the pad configuration (e.g. pull-up) applied by the caller.
+func AddButton(name string, gpio *imx6.GPIO, activeLow bool) (err error) {
+	if gpio == nil {
+		return errors.New("invalid GPIO")
+	}
+
+	buttonsMutex.Lock()
+	defer buttonsMutex.Unlock()
+
+	if _, ok := buttons[name]; ok {
+		return errors.New("button already registered")
+	}
+
+	gpio.In()
+
+	b := &button{
+		gpio:      gpio,
+		activeLow: activeLow,
+	}
+
+	buttons[name] = b
+
+	Board.Buttons = append(Board.Buttons, board.Button{
+		Name:    name,
+		Pressed: b.level,
+	})
+
+	return
+}
+
+func getButton(name string) (b *button, err error) {
+	buttonsMutex.Lock()
+	defer buttonsMutex.Unlock()
+
+	b, ok := buttons[name]
+
+	if !ok {
+		return nil, errors.New("invalid button")
+	}
+
+	return
+}
+
+// Button returns the debounced state of a push button by name (see
+// AddButton()), the function takes about 20 ms to sample the button state.
+func Button(name string) (pressed bool, err error) {
+	b, err := getButton(name)
+
+	if err != nil {
+		return
+	}
+
+	return b.pressed(), nil
+}
+
+// OnButton sets a function, invoked from a dedicated goroutine, on each
+// debounced press of a push button by name (see AddButton()), replacing any
+// previously set one.
+//
+// Presses are detected on the GPIO interrupt, triggered on the button active
+// edge, which requires the GIC to be initialized (see
+// imx6.GPIO.SetInterrupt).
+// Presses occurring while the function executes are coalesced.
+func OnButton(name string, fn func()) (err error) {
+	b, err := getButton(name)
+
+	if err != nil {
+		return
+	}
+
+	if fn == nil {
+		return errors.New("invalid function")
+	}
+
+	cond := uint32(imx6.ICR_RISING)
+
+	if b.activeLow {
+		cond = imx6.ICR_FALLING
+	}
+
+	buttonsMutex.Lock()
+	defer buttonsMutex.Unlock()
+
+	b.fn = fn
+
+	if b.running {
+		return
+	}
+
+	err = b.gpio.SetInterrupt(cond, false, func() {
+		// interrupt context, only the press is recorded
+		atomic.AddUint32(&b.presses, 1)
+	})
+
+	if err != nil {
+		return
+	}
+
+	b.running = true
+	go b.notify()
+
+	return
+}
+
+// DumpGoroutinesOnButton sets DumpGoroutines() as the function invoked on each
+// press of a push button by name (see OnButton()).
+func DumpGoroutinesOnButton(name string) error {
+	return OnButton(name, DumpGoroutines)
+}
+
+func (b *button) notify() {
+	for {
+		time.Sleep(debounceInterval)
+
+		if atomic.SwapUint32(&b.presses, 0) == 0 || !b.pressed() {
+			continue
+		}
+
+		buttonsMutex.Lock()
+		fn := b.fn
+		buttonsMutex.Unlock()
+
+		fn()
+
+		// discard presses recorded during execution
+		atomic.StoreUint32(&b.presses, 0)
+	}
+}
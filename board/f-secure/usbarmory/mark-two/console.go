@@ -12,8 +12,15 @@
 package usbarmory
 
 import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
 	_ "unsafe"
 
+	"github.com/f-secure-foundry/tamago/internal/ring"
+	"github.com/f-secure-foundry/tamago/serial"
 	"github.com/f-secure-foundry/tamago/soc/imx6"
 )
 
@@ -21,9 +28,303 @@ import (
 // output is redirected there.
 //
 // The console is exposed through the USB Type-C receptacle and available only
-// in debug accessory mode (see EnableDebugAccessory()).
+// in debug accessory mode (see EnableDebugAccessory()), additional outputs
+// (e.g. a USB CDC-ACM port) can be added at runtime with AddConsoleBackend().
+
+// console represents the serial console standard output.
+type console struct {
+	// serial port, UART2 unless set with SetPort()
+	port serial.Port
+	// line timestamping
+	timestamps bool
+	// start of line flag
+	sol bool
+
+	// line buffering
+	buffered bool
+	line     [consoleLineSize]byte
+	n        int
+
+	// additional outputs (see AddConsoleBackend()), stored as an immutable
+	// *backends array replaced on each update, so that printk can load it
+	// without locking or allocating
+	backends atomic.Value
+	// serializes backend updates
+	mutex sync.Mutex
+}
+
+// backends represents the set of additional console outputs.
+type backends [maxConsoleBackends]*consoleBackend
+
+const (
+	// console line buffer size
+	consoleLineSize = 256
+
+	// maximum number of additional console outputs
+	maxConsoleBackends = 4
+	// additional console output buffer size (power of 2)
+	consoleBackendSize = 4096
+	// additional console output drain interval
+	consoleBackendInterval = 10 * time.Millisecond
+)
+
+// consoleBackend represents an additional console output, fed by printk
+// through a circular buffer which is drained by a dedicated goroutine, so that
+// a blocking writer does not stall console output.
+type consoleBackend struct {
+	w    io.Writer
+	done chan struct{}
+	// closed on goroutine exit
+	exit chan struct{}
+
+	// output buffer, filled by printk and drained by the goroutine
+	buf *ring.Buffer
+}
+
+// Console instance, the serial port is not set in the initializer as, being
+// an interface value, it would be assigned during package initialization
+// while printk can be invoked earlier (see serial()).
+var Console = &console{
+	sol: true,
+}
+
+//go:linkname nanotime runtime.nanotime
+func nanotime() int64
+
+// SetPort redirects the console standard output to the argument serial port,
+// a nil argument restores the default one (UART2).
+func (c *console) SetPort(port serial.Port) {
+	c.Flush()
+	c.port = port
+}
+
+// serial returns the console serial port, falling back to UART2 when not set.
+func (c *console) serial() serial.Port {
+	if c.port == nil {
+		return imx6.UART2
+	}
+
+	return c.port
+}
+
+// SetLineBuffering enables or disables console line buffering, when enabled
+// output characters are accumulated until a newline, or until the line buffer
+// is full, and then written to the serial port at once to reduce per
+// character overhead on logging-heavy workloads.
+//
+// Output which does not end with a newline is held in the buffer until
+// Flush() is invoked, disabling line buffering flushes the buffer.
+func (c *console) SetLineBuffering(enable bool) {
+	if !enable {
+		c.Flush()
+	}
+
+	c.buffered = enable
+}
+
+// Flush writes any buffered console output to the serial port.
+func (c *console) Flush() {
+	if c.n == 0 {
+		return
+	}
+
+	c.serial().Write(c.line[0:c.n])
+	c.n = 0
+}
+
+// AddConsoleBackend adds an output to the console, all characters written to
+// standard output, in addition to being transmitted on the serial port, are
+// then written to it.
+//
+// The writer is invoked from a dedicated goroutine, so that a blocking output
+// (e.g. a USB serial port not yet enumerated) does not stall the serial one,
+// console output is buffered, up to 4096 characters, and discarded while the
+// writer blocks. Up to 4 additional outputs are supported.
+func AddConsoleBackend(w io.Writer) (err error) {
+	if w == nil {
+		return errors.New("invalid writer")
+	}
+
+	Console.mutex.Lock()
+	defer Console.mutex.Unlock()
+
+	slot := -1
+	set := Console.outputs()
+
+	for i, b := range set {
+		if b == nil {
+			slot = i
+			break
+		}
+	}
+
+	if slot < 0 {
+		return errors.New("too many console backends")
+	}
+
+	buf, err := ring.NewBuffer(consoleBackendSize)
+
+	if err != nil {
+		return
+	}
+
+	b := &consoleBackend{
+		w:    w,
+		done: make(chan struct{}),
+		exit: make(chan struct{}),
+		buf:  buf,
+	}
+
+	go b.drain()
+
+	set[slot] = b
+	Console.backends.Store(&set)
+
+	return
+}
+
+// RemoveConsoleBackend removes an output previously added with
+// AddConsoleBackend(), any pending output for it is discarded.
+//
+// The function returns once the writer is no longer invoked, waiting for the
+// completion of any write in progress, so that the caller can safely release
+// it afterwards.
+func RemoveConsoleBackend(w io.Writer) {
+	var removed []*consoleBackend
+
+	Console.mutex.Lock()
+
+	set := Console.outputs()
+
+	for i, b := range set {
+		if b != nil && b.w == w {
+			set[i] = nil
+			removed = append(removed, b)
+		}
+	}
+
+	Console.backends.Store(&set)
+	Console.mutex.Unlock()
+
+	for _, b := range removed {
+		close(b.done)
+		<-b.exit
+	}
+}
+
+// outputs returns a copy of the current set of additional console outputs.
+func (c *console) outputs() (set backends) {
+	if p, ok := c.backends.Load().(*backends); ok {
+		set = *p
+	}
+
+	return
+}
+
+// drain periodically writes buffered output to the backend writer.
+func (b *consoleBackend) drain() {
+	var buf [consoleBackendSize]byte
+
+	ticker := time.NewTicker(consoleBackendInterval)
+
+	defer close(b.exit)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+		}
+
+		if n := b.buf.Read(buf[:]); n > 0 {
+			b.w.Write(buf[0:n])
+		}
+	}
+}
+
+// output transmits, or buffers, a single character, it avoids any allocation
+// as it is invoked within printk.
+func (c *console) output(b byte) {
+	if set, ok := c.backends.Load().(*backends); ok {
+		for _, backend := range set {
+			if backend != nil {
+				// discard output on full buffer
+				backend.buf.Put(b)
+			}
+		}
+	}
+
+	if !c.buffered {
+		c.serial().Tx(b)
+		return
+	}
+
+	c.line[c.n] = b
+	c.n++
+
+	if b == '\n' || c.n == len(c.line) {
+		c.Flush()
+	}
+}
+
+// SetTimestamps enables or disables prefixing of each console line with a
+// monotonic timestamp, in seconds since boot, in a format similar to the Linux
+// kernel ring buffer (e.g. `[   12.345678] `).
+func (c *console) SetTimestamps(enable bool) {
+	c.timestamps = enable
+}
+
+// timestamp transmits the time elapsed since boot, it avoids any allocation
+// as it is invoked within printk.
+func (c *console) timestamp() {
+	var buf [20]byte
+
+	ns := nanotime()
+	sec := ns / 1e9
+	usec := (ns % 1e9) / 1e3
+
+	i := len(buf) - 1
+	buf[i] = ' '
+	i--
+	buf[i] = ']'
+
+	for n := 0; n < 6; n++ {
+		i--
+		buf[i] = byte('0' + usec%10)
+		usec /= 10
+	}
+
+	i--
+	buf[i] = '.'
+
+	for n := 0; n < 5 || sec > 0; n++ {
+		i--
+
+		if n > 0 && sec == 0 {
+			buf[i] = ' '
+		} else {
+			buf[i] = byte('0' + sec%10)
+			sec /= 10
+		}
+	}
+
+	i--
+	buf[i] = '['
+
+	for ; i < len(buf); i++ {
+		c.output(buf[i])
+	}
+}
 
 //go:linkname printk runtime.printk
 func printk(c byte) {
-	imx6.UART2.Tx(c)
+	if Console.timestamps && Console.sol {
+		Console.timestamp()
+	}
+
+	Console.sol = c == '\n'
+
+	imx6.LogPostMortem(c)
+	Console.output(c)
 }
@@ -0,0 +1,44 @@
+// USB armory Mk II support for tamago/arm
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package usbarmory
+
+import (
+	"os"
+	"runtime"
+)
+
+const (
+	// initial and maximum goroutine dump buffer size
+	stackBufferSize    = 64 * 1024
+	maxStackBufferSize = 4 * 1024 * 1024
+)
+
+// DumpGoroutines writes the stack traces of all goroutines to standard output
+// (see Console), in the same format as the Go runtime dump on SIGQUIT, to
+// diagnose an unresponsive application.
+//
+// As signals are not available on bare metal, the function is meant to be
+// invoked by an application console command, or on a hardware trigger (see
+// DumpGoroutinesOnButton()). The dump is truncated at 4 MB.
+func DumpGoroutines() {
+	var buf []byte
+
+	for size := stackBufferSize; size <= maxStackBufferSize; size *= 2 {
+		buf = make([]byte, size)
+		n := runtime.Stack(buf, true)
+
+		if n < size {
+			buf = buf[0:n]
+			break
+		}
+	}
+
+	os.Stdout.Write(buf)
+}
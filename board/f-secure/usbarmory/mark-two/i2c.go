@@ -7,6 +7,8 @@
 // Use of this source code is governed by the license
 // that can be found in the LICENSE file.
 
+// +build !minimal
+
 package usbarmory
 
 // The USB armory Mk II has the following components accessible as I²C slaves.
@@ -36,6 +36,11 @@ func Model() (model string) {
 func Init() {
 	imx6.Init()
 
-	// initialize serial console
+	imx6.RegisterInit(imx6.INIT_CONSOLE, initConsole)
+	imx6.RunInit()
+}
+
+// initConsole initializes the serial console.
+func initConsole() {
 	imx6.UART2.Init()
 }
@@ -0,0 +1,27 @@
+// USB armory Mk II support for tamago/arm
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package usbarmory
+
+import (
+	"io"
+
+	"github.com/f-secure-foundry/tamago/serial"
+	"github.com/f-secure-foundry/tamago/soc/imx6"
+)
+
+// ReceiveXMODEM receives a file over the serial console (UART2), using the
+// XMODEM-CRC protocol, writing it to the argument destination (e.g. to load a
+// firmware image to the eMMC or microSD card), see serial.ReceiveXMODEM().
+//
+// The console standard output must not be used during the transfer, as it
+// would corrupt the protocol exchange.
+func ReceiveXMODEM(w io.Writer) error {
+	return serial.ReceiveXMODEM(imx6.UART2, w)
+}
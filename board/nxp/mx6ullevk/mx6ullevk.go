@@ -29,6 +29,11 @@ import (
 func Init() {
 	imx6.Init()
 
-	// initialize console
+	imx6.RegisterInit(imx6.INIT_CONSOLE, initConsole)
+	imx6.RunInit()
+}
+
+// initConsole initializes the serial console.
+func initConsole() {
 	imx6.UART1.Init()
 }
@@ -55,6 +55,8 @@ func (dma *Region) defrag() {
 	}
 }
 
+// alloc returns a block of the argument size and alignment, taken from the
+// free blocks, nil is returned if none is large enough.
 func (dma *Region) alloc(size int, align int) *block {
 	var e *list.Element
 	var freeBlock *block
@@ -80,7 +82,7 @@ func (dma *Region) alloc(size int, align int) *block {
 	}
 
 	if freeBlock == nil {
-		panic("out of memory")
+		return nil
 	}
 
 	// allocate block from free linked list
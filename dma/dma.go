@@ -18,6 +18,7 @@ package dma
 
 import (
 	"container/list"
+	"errors"
 	"reflect"
 	"sync"
 	"unsafe"
@@ -46,10 +47,24 @@ type Region struct {
 
 var dma *Region
 
+var initHandlerFn func(start uint32, size int)
+
+// InitHandler sets the function invoked on each region initialization (see
+// Region.Init()) with the region memory range, it allows the SoC package to
+// set the memory attributes required by DMA masters (e.g. non-cacheable) for
+// any region, including those defined by the application.
+func InitHandler(fn func(start uint32, size int)) {
+	initHandlerFn = fn
+}
+
 // Init initializes a memory region for DMA buffer allocation, the application
 // must guarantee that the passed memory range is never used by the Go
 // runtime (defining runtime.ramStart and runtime.ramSize accordingly).
 func (dma *Region) Init() {
+	if initHandlerFn != nil {
+		initHandlerFn(dma.Start, dma.Size)
+	}
+
 	// initialize a single block to fit all available memory
 	b := &block{
 		addr: dma.Start,
@@ -80,8 +95,22 @@ func (dma *Region) Init() {
 //     can be subject of Release()
 //
 // The optional alignment must be a power of 2 and word alignment is always
-// enforced (0 == 4).
+// enforced (0 == 4). A panic occurs if the region free space cannot fit the
+// allocation (see TryReserve()).
 func (dma *Region) Reserve(size int, align int) (addr uint32, buf []byte) {
+	addr, buf, err := dma.TryReserve(size, align)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return
+}
+
+// TryReserve is the equivalent of Reserve(), but an error is returned, rather
+// than a panic occurring, if the region free space cannot fit the allocation
+// (e.g. on a used or fragmented region).
+func (dma *Region) TryReserve(size int, align int) (addr uint32, buf []byte, err error) {
 	if size == 0 {
 		return
 	}
@@ -90,6 +119,11 @@ func (dma *Region) Reserve(size int, align int) (addr uint32, buf []byte) {
 	defer dma.Unlock()
 
 	b := dma.alloc(size, align)
+
+	if b == nil {
+		return 0, nil, errors.New("out of memory")
+	}
+
 	b.res = true
 
 	dma.usedBlocks[b.addr] = b
@@ -99,7 +133,7 @@ func (dma *Region) Reserve(size int, align int) (addr uint32, buf []byte) {
 	hdr.Len = size
 	hdr.Cap = hdr.Len
 
-	return b.addr, buf
+	return b.addr, buf, nil
 }
 
 // Reserved returns whether a slice of bytes data is allocated within the DMA
@@ -136,6 +170,11 @@ func (dma *Region) Alloc(buf []byte, align int) (addr uint32) {
 	defer dma.Unlock()
 
 	b := dma.alloc(len(buf), align)
+
+	if b == nil {
+		panic("out of memory")
+	}
+
 	b.write(buf, 0)
 
 	dma.usedBlocks[b.addr] = b
@@ -271,6 +310,12 @@ func Reserve(size int, align int) (addr uint32, buf []byte) {
 	return dma.Reserve(size, align)
 }
 
+// TryReserve is the equivalent of Region.TryReserve() on the global DMA
+// region.
+func TryReserve(size int, align int) (addr uint32, buf []byte, err error) {
+	return dma.TryReserve(size, align)
+}
+
 // Reserved is the equivalent of Region.Reserved() on the global DMA region.
 func Reserved(buf []byte) (res bool, addr uint32) {
 	return dma.Reserved(buf)
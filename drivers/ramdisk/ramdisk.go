@@ -0,0 +1,178 @@
+// RAM disk block device
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// Package ramdisk implements a block device backed by memory, as a scratch
+// storage (e.g. temporary files, unpacked assets) for filesystem libraries on
+// boards without, or without need for, storage hardware.
+//
+// The device implements the same block interface of storage drivers (e.g.
+// `usdhc.USDHC`, see `board.Storage`) as well as io.ReaderAt and io.WriterAt.
+// Devices allocated with New() do not access any hardware and can therefore
+// be used with `go test` on the host, as a test backend for filesystem code.
+package ramdisk
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/f-secure-foundry/tamago/dma"
+)
+
+// BlockSize is the RAM disk block size.
+const BlockSize = 512
+
+// Disk represents a RAM disk instance.
+type Disk struct {
+	sync.RWMutex
+
+	buf []byte
+
+	// memory region and address, for disks reserved with NewRegion()
+	region *dma.Region
+	addr   uint32
+}
+
+// New allocates a RAM disk of the argument size, which must be a multiple of
+// BlockSize, from the Go runtime heap.
+func New(size int) (d *Disk, err error) {
+	if size <= 0 || size%BlockSize != 0 {
+		return nil, errors.New("invalid size")
+	}
+
+	return &Disk{buf: make([]byte, size)}, nil
+}
+
+// NewRegion reserves a RAM disk of the argument size, which must be a multiple
+// of BlockSize, from a memory region which is not used by the Go runtime
+// (e.g. external RAM excluded from the runtime by the board `linkramsize`
+// build tag), avoiding any impact on heap size and garbage collection.
+//
+// The region must be initialized (see dma.Region.Init()), the reservation is
+// returned to the region with Close(). An error is returned if the region
+// free space cannot fit the reservation.
+//
+// On i.MX6 all regions are non-cacheable, as required for DMA (see
+// imx6.Init()), disks reserved with NewRegion() are therefore slower than
+// those allocated with New().
+func NewRegion(region *dma.Region, size int) (d *Disk, err error) {
+	if region == nil {
+		return nil, errors.New("invalid region")
+	}
+
+	if size <= 0 || size%BlockSize != 0 || size > region.Size {
+		return nil, errors.New("invalid size")
+	}
+
+	addr, buf, err := region.TryReserve(size, BlockSize)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not reserve memory, %v", err)
+	}
+
+	d = &Disk{
+		buf:    buf,
+		region: region,
+		addr:   addr,
+	}
+
+	// the reserved memory is not zeroed by the allocator
+	for i := range d.buf {
+		d.buf[i] = 0
+	}
+
+	return
+}
+
+// Close releases the RAM disk memory, for disks reserved with NewRegion(),
+// the disk cannot be used afterwards.
+func (d *Disk) Close() error {
+	d.Lock()
+	defer d.Unlock()
+
+	if d.region != nil {
+		d.region.Release(d.addr)
+		d.region = nil
+	}
+
+	d.buf = nil
+
+	return nil
+}
+
+// Size returns the RAM disk size in bytes.
+func (d *Disk) Size() int64 {
+	d.RLock()
+	defer d.RUnlock()
+
+	return int64(len(d.buf))
+}
+
+// ReadAt reads len(p) bytes from the RAM disk at the argument offset, it
+// implements io.ReaderAt.
+func (d *Disk) ReadAt(p []byte, off int64) (n int, err error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	if off < 0 {
+		return 0, errors.New("invalid offset")
+	}
+
+	if off >= int64(len(d.buf)) {
+		return 0, io.EOF
+	}
+
+	n = copy(p, d.buf[off:])
+
+	if n < len(p) {
+		err = io.EOF
+	}
+
+	return
+}
+
+// WriteAt writes len(p) bytes to the RAM disk at the argument offset, it
+// implements io.WriterAt.
+func (d *Disk) WriteAt(p []byte, off int64) (n int, err error) {
+	d.Lock()
+	defer d.Unlock()
+
+	if off < 0 || off+int64(len(p)) > int64(len(d.buf)) {
+		return 0, errors.New("invalid offset")
+	}
+
+	return copy(d.buf[off:], p), nil
+}
+
+// ReadBlocks reads the RAM disk blocks starting at the argument logical block
+// address to the buffer, whose size must be a multiple of BlockSize.
+func (d *Disk) ReadBlocks(lba int, buf []byte) (err error) {
+	if lba < 0 || len(buf)%BlockSize != 0 {
+		return errors.New("invalid block access")
+	}
+
+	if _, err = d.ReadAt(buf, int64(lba)*BlockSize); err == io.EOF {
+		err = errors.New("invalid block access")
+	}
+
+	return
+}
+
+// WriteBlocks writes the buffer, whose size must be a multiple of BlockSize,
+// to the RAM disk blocks starting at the argument logical block address.
+func (d *Disk) WriteBlocks(lba int, buf []byte) (err error) {
+	if lba < 0 || len(buf)%BlockSize != 0 {
+		return errors.New("invalid block access")
+	}
+
+	_, err = d.WriteAt(buf, int64(lba)*BlockSize)
+
+	return
+}
@@ -0,0 +1,40 @@
+// Sitronix ST7789 and Ilitek ILI9341 TFT display driver
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package st7789
+
+import (
+	"image/color"
+)
+
+// RGB565Model is the color model of the display 16-bit pixels, colors are
+// quantized to 5 bits for red and blue and 6 bits for green.
+var RGB565Model = color.ModelFunc(rgb565Model)
+
+func rgb565Model(c color.Color) color.Color {
+	v := rgb565(c)
+
+	r := uint8(v>>11) << 3
+	g := uint8(v>>5) << 2
+	b := uint8(v) << 3
+
+	return color.RGBA{
+		R: r | r>>5,
+		G: g | g>>6,
+		B: b | b>>5,
+		A: 0xff,
+	}
+}
+
+// rgb565 converts a color to its 16-bit pixel representation.
+func rgb565(c color.Color) uint16 {
+	r, g, b, _ := c.RGBA()
+
+	return uint16((r>>11)<<11 | (g>>10)<<5 | b>>11)
+}
@@ -0,0 +1,289 @@
+// Sitronix ST7789 and Ilitek ILI9341 TFT display driver
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// Package st7789 implements a driver for Sitronix ST7789 and Ilitek ILI9341
+// TFT display controllers, interfaced through a 4-line serial interface (SPI
+// with a Data/Command GPIO), using 16-bit (RGB565) pixels.
+//
+// The display implements draw.Image, so that it can be used with image/draw,
+// the SPI bus and GPIO drivers are accessed through interfaces implemented at
+// SoC level (e.g. imx6.ECSPI and imx6.GPIO).
+//
+// This package is only meant to be used with `GOOS=tamago GOARCH=arm` as
+// supported by the TamaGo framework for bare metal Go on ARM SoCs, see
+// https://github.com/f-secure-foundry/tamago.
+package st7789
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"sync"
+	"time"
+)
+
+// Display commands (MIPI DCS, common to ST7789 and ILI9341)
+const (
+	SWRESET = 0x01
+	SLPOUT  = 0x11
+	NORON   = 0x13
+	INVON   = 0x21
+	DISPON  = 0x29
+	CASET   = 0x2a
+	RASET   = 0x2b
+	RAMWR   = 0x2c
+	MADCTL  = 0x36
+	COLMOD  = 0x3a
+
+	// 16 bits per pixel (RGB565)
+	COLMOD_16BPP = 0x55
+
+	// MADCTL bits
+	MADCTL_MY  = 0x80
+	MADCTL_MX  = 0x40
+	MADCTL_MV  = 0x20
+	MADCTL_BGR = 0x08
+)
+
+// SPI transfer chunk size
+const chunkSize = 4096
+
+// SPI represents a serial bus (e.g. imx6.ECSPI), the display chip select must
+// be handled by the bus driver.
+type SPI interface {
+	// Txn performs a full duplex transaction, the buffer is overwritten
+	// with the received data.
+	Txn(buf []byte) error
+}
+
+// Pin represents an output GPIO (e.g. imx6.GPIO).
+type Pin interface {
+	// High sets the pin output to high.
+	High()
+	// Low sets the pin output to low.
+	Low()
+}
+
+// Display represents a TFT display controller instance.
+type Display struct {
+	sync.Mutex
+
+	// serial bus
+	SPI SPI
+	// Data/Command selection, low for commands and high for data
+	DC Pin
+	// optional hardware reset (active low)
+	Reset Pin
+
+	// display size, in pixels, after orientation (see MemoryAccess)
+	Width  int
+	Height int
+
+	// memory access control (MADCTL) value, selecting orientation and
+	// color order (e.g. MADCTL_BGR on most ILI9341 panels)
+	MemoryAccess byte
+	// display inversion, required by most ST7789 panels
+	Invert bool
+
+	// transfer buffer
+	buf []byte
+}
+
+// Init initializes the display controller, by means of an hardware (if Reset
+// is set) and software reset, configuring 16-bit pixels and turning on the
+// display.
+func (d *Display) Init() (err error) {
+	d.Lock()
+	defer d.Unlock()
+
+	if d.SPI == nil || d.DC == nil {
+		return errors.New("invalid bus configuration")
+	}
+
+	if d.Width <= 0 || d.Height <= 0 {
+		return errors.New("invalid display size")
+	}
+
+	d.buf = make([]byte, chunkSize)
+
+	if d.Reset != nil {
+		d.Reset.Low()
+		time.Sleep(10 * time.Millisecond)
+		d.Reset.High()
+		time.Sleep(120 * time.Millisecond)
+	}
+
+	if err = d.command(SWRESET); err != nil {
+		return
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	if err = d.command(SLPOUT); err != nil {
+		return
+	}
+
+	time.Sleep(120 * time.Millisecond)
+
+	if err = d.command(COLMOD, COLMOD_16BPP); err != nil {
+		return
+	}
+
+	if err = d.command(MADCTL, d.MemoryAccess); err != nil {
+		return
+	}
+
+	if d.Invert {
+		if err = d.command(INVON); err != nil {
+			return
+		}
+	}
+
+	if err = d.command(NORON); err != nil {
+		return
+	}
+
+	return d.command(DISPON)
+}
+
+// command transmits a command followed by its parameters.
+func (d *Display) command(cmd byte, data ...byte) (err error) {
+	d.DC.Low()
+
+	if err = d.SPI.Txn([]byte{cmd}); err != nil {
+		return
+	}
+
+	d.DC.High()
+
+	if len(data) == 0 {
+		return
+	}
+
+	return d.SPI.Txn(data)
+}
+
+// window sets the display memory area for the following pixel data and
+// starts the memory write.
+func (d *Display) window(r image.Rectangle) (err error) {
+	x0, x1 := uint16(r.Min.X), uint16(r.Max.X-1)
+	y0, y1 := uint16(r.Min.Y), uint16(r.Max.Y-1)
+
+	if err = d.command(CASET, byte(x0>>8), byte(x0), byte(x1>>8), byte(x1)); err != nil {
+		return
+	}
+
+	if err = d.command(RASET, byte(y0>>8), byte(y0), byte(y1>>8), byte(y1)); err != nil {
+		return
+	}
+
+	return d.command(RAMWR)
+}
+
+// pixels transmits n pixels, in display memory order, with colors returned by
+// the argument function.
+func (d *Display) pixels(n int, pixel func(i int) uint16) (err error) {
+	off := 0
+
+	for i := 0; i < n; i++ {
+		c := pixel(i)
+
+		d.buf[off] = byte(c >> 8)
+		d.buf[off+1] = byte(c)
+		off += 2
+
+		if off == len(d.buf) || i == n-1 {
+			// the buffer is overwritten by the received data
+			if err = d.SPI.Txn(d.buf[0:off]); err != nil {
+				return
+			}
+
+			off = 0
+		}
+	}
+
+	return
+}
+
+// draw transmits pixels for the argument area, clipped to the display bounds.
+func (d *Display) draw(r image.Rectangle, pixel func(x, y int) uint16) (err error) {
+	d.Lock()
+	defer d.Unlock()
+
+	if d.buf == nil {
+		return errors.New("display is not initialized")
+	}
+
+	r = r.Intersect(d.Bounds())
+
+	if r.Empty() {
+		return
+	}
+
+	if err = d.window(r); err != nil {
+		return
+	}
+
+	w := r.Dx()
+
+	return d.pixels(w*r.Dy(), func(i int) uint16 {
+		return pixel(r.Min.X+i%w, r.Min.Y+i/w)
+	})
+}
+
+// Fill sets all display pixels to the argument color.
+func (d *Display) Fill(c color.Color) (err error) {
+	rgb := rgb565(c)
+
+	return d.draw(d.Bounds(), func(x, y int) uint16 {
+		return rgb
+	})
+}
+
+// DrawImage draws the argument image with its top-left corner at the
+// argument display coordinates, the image is clipped to the display bounds.
+func (d *Display) DrawImage(x, y int, img image.Image) (err error) {
+	b := img.Bounds()
+	r := image.Rect(x, y, x+b.Dx(), y+b.Dy())
+
+	return d.draw(r, func(px, py int) uint16 {
+		return rgb565(img.At(b.Min.X+px-x, b.Min.Y+py-y))
+	})
+}
+
+// ColorModel returns the display color model, see draw.Image.
+func (d *Display) ColorModel() color.Model {
+	return RGB565Model
+}
+
+// Bounds returns the display area, see draw.Image.
+func (d *Display) Bounds() image.Rectangle {
+	return image.Rect(0, 0, d.Width, d.Height)
+}
+
+// At returns the color of a pixel, see draw.Image.
+//
+// As the display memory is not read back, transparent black is always
+// returned, for this reason the display should be used with draw.Src as
+// composition operator.
+func (d *Display) At(x, y int) color.Color {
+	return color.RGBA{}
+}
+
+// Set sets the color of a single pixel, see draw.Image.
+//
+// As each pixel requires a display memory window update, DrawImage() should
+// be preferred for drawing of entire images.
+func (d *Display) Set(x, y int, c color.Color) {
+	rgb := rgb565(c)
+
+	d.draw(image.Rect(x, y, x+1, y+1), func(x, y int) uint16 {
+		return rgb
+	})
+}
@@ -0,0 +1,236 @@
+// Clock arithmetic
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// Package clock implements the timer and clock divider arithmetic used by
+// processor and SoC drivers.
+//
+// The package performs no register access and has no build constraints, so
+// that its computations can be verified with host tests (`go test`) rather
+// than on the target.
+package clock
+
+import (
+	"errors"
+)
+
+// Nanos converts the argument timer counter value to nanoseconds, given the
+// counter value at timer initialization and the nanoseconds per counter tick.
+//
+// The initial value is subtracted before the multiplication so that the
+// conversion does not overflow regardless of the counter value at boot.
+func Nanos(cnt int64, offset int64, multiplier int64) int64 {
+	return (cnt - offset) * multiplier
+}
+
+// UARTRoot returns the i.MX6 UART_CLK_ROOT frequency, sourced from pll3_80m
+// (PLL3 with its /6 static divider) or from the oscillator, according to the
+// CSCDR1_UART_CLK_SEL value on parts which have the selector, and divided by
+// the CSCDR1_UART_CLK_PODF value + 1.
+func UARTRoot(pll3 uint32, osc uint32, selector bool, sel uint32, podf uint32) uint32 {
+	freq := pll3 / 6
+
+	if selector && sel == 1 {
+		freq = osc
+	}
+
+	return freq / (podf + 1)
+}
+
+// I2C clock divider values by I2Cx_IFDR value
+// (I2C Frequency Divider Register (I2Cx_IFDR), IMX6ULLRM).
+var i2cDividers = [64]uint16{
+	30, 32, 36, 42, 48, 52, 60, 72,
+	80, 88, 104, 128, 144, 160, 192, 240,
+	288, 320, 384, 480, 576, 640, 768, 960,
+	1152, 1280, 1536, 1920, 2304, 2560, 3072, 3840,
+	22, 24, 26, 28, 32, 36, 40, 44,
+	48, 56, 64, 72, 80, 96, 112, 128,
+	160, 192, 224, 256, 320, 384, 448, 512,
+	640, 768, 896, 1024, 1280, 1536, 1792, 2048,
+}
+
+// I2CDivider returns the i.MX6 I2Cx_IFDR value for the smallest clock divider
+// resulting, from the argument root clock frequency, in an SCL frequency not
+// greater than speed, the largest divider is selected when none is
+// sufficient.
+func I2CDivider(root uint32, speed uint32) uint16 {
+	code := -1
+
+	for i, div := range i2cDividers {
+		if root/uint32(div) > speed {
+			continue
+		}
+
+		if code < 0 || div < i2cDividers[code] {
+			code = i
+		}
+	}
+
+	if code < 0 {
+		// 3840
+		code = 0x1f
+	}
+
+	return uint16(code)
+}
+
+// GateIndex returns the index of the argument clock gating register, among
+// the count consecutive 32-bit registers starting at base (e.g. i.MX6
+// CCM_CCGR0-CCM_CCGR6), or -1 if the address does not belong to any of them.
+func GateIndex(base uint32, count int, ccgr uint32) int {
+	if ccgr < base || ccgr&0b11 != 0 {
+		return -1
+	}
+
+	i := (ccgr - base) / 4
+
+	if i >= uint32(count) {
+		return -1
+	}
+
+	return int(i)
+}
+
+// BaudrateTolerance is the maximum relative error, in parts per million,
+// accepted by SolveBaudrate() between the requested and generated baud rates.
+//
+// Asynchronous reception samples each bit at the center of its nominal period,
+// over a 10 bits frame the combined error of both ends must therefore remain
+// below ~5%, ±2% is the allowance commonly granted to each side.
+const BaudrateTolerance = 20000
+
+// BRM represents an i.MX UART baud rate generator configuration, as the
+// reference frequency divider and Binary Rate Multiplier values.
+type BRM struct {
+	// reference frequency divider (1-7)
+	Div uint32
+	// BRM incremental numerator (UBIR + 1)
+	Num uint32
+	// BRM modulator denominator (UBMR + 1)
+	Den uint32
+	// relative error, in parts per million, to the requested baud rate
+	PPM uint32
+}
+
+// BestRational returns the fraction, with numerator and denominator not
+// exceeding max, closest to n/d using its continued fraction expansion.
+func BestRational(n, d, max uint64) (num, den uint64) {
+	var n0, d1 uint64 = 0, 0
+	var n1, d0 uint64 = 1, 1
+
+	for d != 0 {
+		dp := d
+		a := n / d
+		d = n % d
+		n = dp
+
+		n2 := n0 + a*n1
+		d2 := d0 + a*d1
+
+		if n2 > max || d2 > max {
+			t := ^uint64(0)
+
+			if d1 != 0 {
+				t = (max - d0) / d1
+			}
+
+			if n1 != 0 && (max-n0)/n1 < t {
+				t = (max - n0) / n1
+			}
+
+			// use the semi-convergent when closer than the last
+			// convergent
+			if d1 == 0 || 2*t > a || (2*t == a && d0*dp > d1*d) {
+				n1 = n0 + t*n1
+				d1 = d0 + t*d1
+			}
+
+			break
+		}
+
+		n0, n1 = n1, n2
+		d0, d1 = d1, d2
+	}
+
+	return n1, d1
+}
+
+// SolveBaudrate searches the reference frequency divider and Binary Rate
+// Multiplier combinations for the one which minimizes the error on the
+// argument baud rate, given the UART module clock frequency
+// (Binary Rate Multiplier (BRM), IMX6ULLRM):
+//
+//                    clk
+//   baudrate = ---------------
+//                       UBMR + 1
+//              16 * div ---------
+//                       UBIR + 1
+//
+// The computation only uses integer arithmetic as it takes place during early
+// runtime initialization. An error is returned when the closest achievable
+// baud rate deviates by more than BaudrateTolerance from the requested one.
+func SolveBaudrate(clk uint32, baud uint32) (rate BRM, err error) {
+	if baud == 0 {
+		return rate, errors.New("invalid baud rate")
+	}
+
+	found := false
+
+	for div := uint32(1); div <= 7; div++ {
+		// (UBIR + 1) / (UBMR + 1) = 16 * div * baudrate / clk
+		n := 16 * uint64(div) * uint64(baud)
+		d := uint64(clk)
+
+		// the BRM can only divide the reference frequency
+		if n > d {
+			break
+		}
+
+		num, den := BestRational(n, d, 1<<16)
+
+		if num == 0 {
+			continue
+		}
+
+		// actual baud rate = clk * num / (16 * div * den)
+		actual := uint64(clk) * num
+		target := 16 * uint64(div) * den * uint64(baud)
+
+		var diff uint64
+
+		if actual > target {
+			diff = actual - target
+		} else {
+			diff = target - actual
+		}
+
+		ppm := uint32(diff * 1000000 / target)
+
+		if !found || ppm < rate.PPM {
+			rate = BRM{
+				Div: div,
+				Num: uint32(num),
+				Den: uint32(den),
+				PPM: ppm,
+			}
+
+			found = true
+		}
+	}
+
+	if !found {
+		return rate, errors.New("unsupported baud rate")
+	}
+
+	if rate.PPM > BaudrateTolerance {
+		return rate, errors.New("baud rate not achievable within tolerance")
+	}
+
+	return
+}
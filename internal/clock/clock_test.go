@@ -0,0 +1,281 @@
+// Clock arithmetic
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNanos(t *testing.T) {
+	uptime := int64(365 * 24 * time.Hour)
+
+	// Generic Timer at 24 MHz (truncated multiplier) and 8 MHz, Cortex-A9
+	// Global Timer, BCM2835 system timer, 1 GHz counter
+	for _, mul := range []int64{41, 125, 10, 1000, 1} {
+		ticks := uptime / mul
+
+		// counter value at boot close to its maximum, the conversion
+		// of the raw counter value overflows with any multiplier
+		// greater than 1
+		offset := int64(1<<63-1) - ticks - 1
+		cnt := offset + ticks
+
+		if ns := Nanos(cnt, offset, mul); ns != ticks*mul {
+			t.Errorf("multiplier %d: %d ns, expected %d ns", mul, ns, ticks*mul)
+		}
+
+		if Nanos(cnt+1, offset, mul) <= Nanos(cnt, offset, mul) {
+			t.Errorf("multiplier %d: time is not monotonic at counter value %#x", mul, cnt)
+		}
+	}
+}
+
+func TestNanosInitial(t *testing.T) {
+	if ns := Nanos(12345, 12345, 10); ns != 0 {
+		t.Errorf("%d ns at initialization, expected 0", ns)
+	}
+}
+
+func TestUARTRoot(t *testing.T) {
+	const (
+		pll3 = 480000000
+		osc  = 24000000
+	)
+
+	for _, test := range []struct {
+		selector bool
+		sel      uint32
+		podf     uint32
+		freq     uint32
+	}{
+		// i.MX6UL/i.MX6ULL
+		{true, 0, 0, 80000000},
+		{true, 0, 1, 40000000},
+		{true, 0, 63, 1250000},
+		{true, 1, 0, 24000000},
+		{true, 1, 2, 8000000},
+		// i.MX6Q, without selector
+		{false, 0, 0, 80000000},
+		{false, 1, 0, 80000000},
+		{false, 1, 3, 20000000},
+	} {
+		if freq := UARTRoot(pll3, osc, test.selector, test.sel, test.podf); freq != test.freq {
+			t.Errorf("selector %v, SEL %d, PODF %d: %d Hz, expected %d Hz", test.selector, test.sel, test.podf, freq, test.freq)
+		}
+	}
+}
+
+func TestI2CDivider(t *testing.T) {
+	for _, test := range []struct {
+		root  uint32
+		speed uint32
+		code  uint16
+	}{
+		// 66 MHz / 768 = 85.9 kHz
+		{66000000, 100000, 0x16},
+		// 66 MHz / 192 = 343.8 kHz
+		{66000000, 400000, 0x0e},
+		// 24 MHz / 240 = 100 kHz, exact
+		{24000000, 100000, 0x0f},
+		// 24 MHz / 22 = 1.09 MHz
+		{24000000, 3400000, 0x20},
+		// 66 MHz / 3840 = 17.2 kHz, the largest divider
+		{66000000, 10000, 0x1f},
+	} {
+		if code := I2CDivider(test.root, test.speed); code != test.code {
+			t.Errorf("%d Hz root, %d Hz: IFDR %#x, expected %#x", test.root, test.speed, code, test.code)
+		}
+	}
+}
+
+func TestI2CDividerSelection(t *testing.T) {
+	for _, root := range []uint32{24000000, 66000000} {
+		for speed := uint32(1000); speed <= 4000000; speed += 1000 {
+			code := I2CDivider(root, speed)
+
+			if code >= uint16(len(i2cDividers)) {
+				t.Fatalf("%d Hz root, %d Hz: invalid IFDR %#x", root, speed, code)
+			}
+
+			scl := root / uint32(i2cDividers[code])
+
+			if scl > speed && code != 0x1f {
+				t.Fatalf("%d Hz root, %d Hz: %d Hz exceeds speed (IFDR %#x)", root, speed, scl, code)
+			}
+
+			for _, div := range i2cDividers {
+				if f := root / uint32(div); f <= speed && f > scl {
+					t.Fatalf("%d Hz root, %d Hz: %d Hz achievable, got %d Hz (IFDR %#x)", root, speed, f, scl, code)
+				}
+			}
+		}
+	}
+}
+
+func TestGateIndex(t *testing.T) {
+	const (
+		CCM_CCGR0 = 0x020c4068
+		CCM_CCGR6 = 0x020c4080
+	)
+
+	for _, test := range []struct {
+		ccgr  uint32
+		index int
+	}{
+		{CCM_CCGR0, 0},
+		{CCM_CCGR0 + 4, 1},
+		{CCM_CCGR6, 6},
+		// preceding and following registers
+		{CCM_CCGR0 - 4, -1},
+		{CCM_CCGR6 + 4, -1},
+		// unaligned
+		{CCM_CCGR0 + 1, -1},
+		{CCM_CCGR6 + 2, -1},
+		{0, -1},
+		{0xffffffff, -1},
+	} {
+		if i := GateIndex(CCM_CCGR0, 7, test.ccgr); i != test.index {
+			t.Errorf("%#x: index %d, expected %d", test.ccgr, i, test.index)
+		}
+	}
+}
+
+// actualBaudrate returns the baud rate generated by the argument
+// configuration.
+func actualBaudrate(clk uint32, rate BRM) uint64 {
+	return uint64(clk) * uint64(rate.Num) / (16 * uint64(rate.Div) * uint64(rate.Den))
+}
+
+func TestSolveBaudrate(t *testing.T) {
+	// pll3_80m, pll3_80m with PODF 1, oscillator
+	for _, clk := range []uint32{80000000, 40000000, 24000000} {
+		// standard rates, MIDI, DMX512
+		for _, baud := range []uint32{9600, 57600, 115200, 921600, 31250, 250000} {
+			rate, err := SolveBaudrate(clk, baud)
+
+			if err != nil {
+				t.Errorf("%d Hz, %d bps: %v", clk, baud, err)
+				continue
+			}
+
+			if rate.Div < 1 || rate.Div > 7 || rate.Num < 1 || rate.Num > 1<<16 || rate.Den < 1 || rate.Den > 1<<16 {
+				t.Errorf("%d Hz, %d bps: invalid configuration %+v", clk, baud, rate)
+			}
+
+			actual := actualBaudrate(clk, rate)
+
+			if actual*100 < uint64(baud)*99 || actual*100 > uint64(baud)*101 {
+				t.Errorf("%d Hz, %d bps: %d bps generated (%+v)", clk, baud, actual, rate)
+			}
+		}
+	}
+}
+
+func TestSolveBaudrateUnsupported(t *testing.T) {
+	if _, err := SolveBaudrate(80000000, 0); err == nil {
+		t.Error("0 bps accepted, expected error")
+	}
+
+	// the BRM can only divide the reference frequency
+	if _, err := SolveBaudrate(80000000, 80000000/16+1); err == nil {
+		t.Error("rate above clk/16 accepted, expected error")
+	}
+}
+
+func TestSolveBaudrateTolerance(t *testing.T) {
+	const clk = 80000000
+
+	// the lowest rate, with the largest divider and BRM ratio, is
+	// 80 MHz / (16 * 7 * 65536) = 10.9 bps
+	if rate, err := SolveBaudrate(clk, 11); err != nil {
+		t.Errorf("11 bps: %v", err)
+	} else if rate.PPM > BaudrateTolerance {
+		t.Errorf("11 bps: %d ppm error exceeds tolerance", rate.PPM)
+	}
+
+	// 10.9 bps is 8.99% faster than 10 bps
+	if rate, err := SolveBaudrate(clk, 10); err == nil {
+		t.Errorf("10 bps accepted with %d ppm error, expected error", rate.PPM)
+	}
+
+	for baud := uint32(1); baud < 200; baud++ {
+		rate, err := SolveBaudrate(clk, baud)
+
+		if err != nil {
+			// rates with no BRM ratio at all fail regardless of
+			// tolerance
+			if rate.Num != 0 && rate.PPM <= BaudrateTolerance {
+				t.Errorf("%d bps: rejected with %d ppm error", baud, rate.PPM)
+			}
+
+			continue
+		}
+
+		if rate.PPM > BaudrateTolerance {
+			t.Errorf("%d bps: accepted with %d ppm error", baud, rate.PPM)
+		}
+
+		actual := actualBaudrate(clk, rate)
+
+		// error bound with integer truncation of the generated rate
+		if actual*1000000 < uint64(baud)*(1000000-BaudrateTolerance)-1000000 ||
+			actual*1000000 > uint64(baud)*(1000000+BaudrateTolerance) {
+			t.Errorf("%d bps: %d bps generated", baud, actual)
+		}
+	}
+}
+
+func TestBestRational(t *testing.T) {
+	for _, test := range []struct {
+		n   uint64
+		d   uint64
+		max uint64
+		num uint64
+		den uint64
+	}{
+		// 115200 bps from 80 MHz, 16 * 115200 / 80 MHz
+		{16 * 115200, 80000000, 1 << 16, 72, 3125},
+		// 3 Mbps from 80 MHz, 16 * 3000000 / 80 MHz
+		{16 * 3000000, 80000000, 1 << 16, 3, 5},
+		// 115200 bps from the 24 MHz oscillator
+		{16 * 115200, 24000000, 1 << 16, 48, 625},
+		// approximations of pi
+		{314159265, 100000000, 1000, 355, 113},
+		{314159265, 100000000, 100, 22, 7},
+		{314159265, 100000000, 10, 3, 1},
+		// ratio below the smallest representable one
+		{1, 1 << 20, 1 << 16, 0, 1},
+	} {
+		num, den := BestRational(test.n, test.d, test.max)
+
+		if num != test.num || den != test.den {
+			t.Errorf("BestRational(%d, %d, %d) = %d/%d, expected %d/%d", test.n, test.d, test.max, num, den, test.num, test.den)
+		}
+	}
+}
+
+func TestSolveBaudrateHighSpeed(t *testing.T) {
+	// 3 Mbps from 80 MHz is exact with the reference frequency undivided
+	rate, err := SolveBaudrate(80000000, 3000000)
+
+	if err != nil {
+		t.Fatalf("3000000 bps: %v", err)
+	}
+
+	if rate.PPM != 0 || actualBaudrate(80000000, rate) != 3000000 {
+		t.Errorf("3000000 bps: %+v, expected exact configuration", rate)
+	}
+
+	// 24 MHz / 16 = 1.5 Mbps is the maximum rate from the oscillator
+	if _, err := SolveBaudrate(24000000, 3000000); err == nil {
+		t.Error("3000000 bps from 24 MHz accepted, expected error")
+	}
+}
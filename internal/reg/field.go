@@ -0,0 +1,47 @@
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+//
+// +build tamago,arm staticcheck
+
+package reg
+
+// Field represents a 32-bit register bit field, it allows typed access to
+// register fields without repeating their position and mask on each access.
+type Field struct {
+	// register address
+	Addr uint32
+	// field position
+	Pos int
+	// field mask
+	Mask int
+}
+
+// Get returns the field value.
+func (f Field) Get() uint32 {
+	return Get(f.Addr, f.Pos, f.Mask)
+}
+
+// Set sets all field bits.
+func (f Field) Set() {
+	SetN(f.Addr, f.Pos, f.Mask, uint32(f.Mask))
+}
+
+// Clear clears all field bits.
+func (f Field) Clear() {
+	ClearN(f.Addr, f.Pos, f.Mask)
+}
+
+// Write sets the field to the argument value, a panic occurs if the value
+// exceeds the field size.
+func (f Field) Write(val uint32) {
+	if val&^uint32(f.Mask) != 0 {
+		panic("value exceeds register field size")
+	}
+
+	SetN(f.Addr, f.Pos, f.Mask, val)
+}
@@ -13,55 +13,50 @@ package reg
 import (
 	"runtime"
 	"time"
-	"unsafe"
 )
 
-// As sync/atomic does not provide 16-bit support, note that these functions do
-// not necessarily enforce memory ordering.
+// The 16-bit functions must be used on 16-bit registers (e.g. WDOG, I2C) as
+// 32-bit accesses to them might result in bus faults or in side effects on
+// adjacent registers.
+//
+// As sync/atomic does not provide 16-bit support, register accesses are
+// performed in assembly (see reg16.s) with exactly one 16-bit load or store,
+// surrounded by memory barriers, therefore read-modify-write functions always
+// perform a single 16-bit read followed by a single 16-bit write.
+
+// defined in reg16.s
+func Read16(addr uint32) uint16
+func Write16(addr uint32, val uint16)
 
 func Get16(addr uint32, pos int, mask int) uint16 {
-	reg := (*uint16)(unsafe.Pointer(uintptr(addr)))
-	return (*reg >> pos) & uint16(mask)
+	return (Read16(addr) >> pos) & uint16(mask)
 }
 
 func Set16(addr uint32, pos int) {
-	reg := (*uint16)(unsafe.Pointer(uintptr(addr)))
-	*reg |= (1 << pos)
+	Write16(addr, Read16(addr)|(1<<pos))
 }
 
 func Clear16(addr uint32, pos int) {
-	reg := (*uint16)(unsafe.Pointer(uintptr(addr)))
-	*reg &= ^(1 << pos)
+	Write16(addr, Read16(addr)&^(1<<pos))
 }
 
 func SetN16(addr uint32, pos int, mask int, val uint16) {
-	reg := (*uint16)(unsafe.Pointer(uintptr(addr)))
-	*reg = (*reg & (^(uint16(mask) << pos))) | (val << pos)
-}
+	r := Read16(addr)
+	r = (r & (^(uint16(mask) << pos))) | (val << pos)
 
-func ClearN16(addr uint32, pos int, mask int) {
-	reg := (*uint16)(unsafe.Pointer(uintptr(addr)))
-	*reg &= ^(uint16(mask) << pos)
+	Write16(addr, r)
 }
 
-func Read16(addr uint32) uint16 {
-	reg := (*uint16)(unsafe.Pointer(uintptr(addr)))
-	return *reg
-}
-
-func Write16(addr uint32, val uint16) {
-	reg := (*uint16)(unsafe.Pointer(uintptr(addr)))
-	*reg = val
+func ClearN16(addr uint32, pos int, mask int) {
+	Write16(addr, Read16(addr)&^(uint16(mask)<<pos))
 }
 
 func WriteBack16(addr uint32) {
-	reg := (*uint16)(unsafe.Pointer(uintptr(addr)))
-	*reg |= *reg
+	Write16(addr, Read16(addr))
 }
 
 func Or16(addr uint32, val uint16) {
-	reg := (*uint16)(unsafe.Pointer(uintptr(addr)))
-	*reg |= val
+	Write16(addr, Read16(addr)|val)
 }
 
 // Wait16 waits for a specific register bit to match a value. This function
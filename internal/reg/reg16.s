@@ -0,0 +1,31 @@
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// func Read16(addr uint32) uint16
+TEXT ·Read16(SB),$0-6
+	MOVW	addr+0(FP), R0
+
+	// single 16-bit load
+	MOVHU	(R0), R1
+	WORD	$0xf57ff05f	// DMB SY
+
+	MOVH	R1, ret+4(FP)
+
+	RET
+
+// func Write16(addr uint32, val uint16)
+TEXT ·Write16(SB),$0-6
+	MOVW	addr+0(FP), R0
+	MOVHU	val+4(FP), R1
+
+	// single 16-bit store
+	WORD	$0xf57ff05f	// DMB SY
+	MOVH	R1, (R0)
+	WORD	$0xf57ff05f	// DMB SY
+
+	RET
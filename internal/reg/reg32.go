@@ -62,6 +62,37 @@ func ClearN(addr uint32, pos int, mask int) {
 	atomic.StoreUint32(reg, r)
 }
 
+// On peripherals which support them, the SET, CLR and TOG register aliases are
+// located at fixed offsets from the register address, writing a value to an
+// alias respectively sets, clears or toggles the register bits which are set in
+// the value, without affecting the others.
+const (
+	setOffset = 0x4
+	clrOffset = 0x8
+	togOffset = 0xc
+)
+
+// SetBits atomically sets the register bits specified in the argument mask,
+// using the register SET alias, it must only be used on registers which
+// support it.
+func SetBits(addr uint32, mask uint32) {
+	Write(addr+setOffset, mask)
+}
+
+// ClearBits atomically clears the register bits specified in the argument
+// mask, using the register CLR alias, it must only be used on registers which
+// support it.
+func ClearBits(addr uint32, mask uint32) {
+	Write(addr+clrOffset, mask)
+}
+
+// ToggleBits atomically toggles the register bits specified in the argument
+// mask, using the register TOG alias, it must only be used on registers which
+// support it.
+func ToggleBits(addr uint32, mask uint32) {
+	Write(addr+togOffset, mask)
+}
+
 // defined in reg32.s
 func Move(dst uint32, src uint32)
 
@@ -75,6 +106,34 @@ func Write(addr uint32, val uint32) {
 	atomic.StoreUint32(reg, val)
 }
 
+// ReadFIFO fills the buffer with consecutive 32-bit reads of a FIFO data
+// port register, stored in little-endian order, any trailing bytes beyond a
+// multiple of 4 are left untouched.
+func ReadFIFO(addr uint32, buf []byte) {
+	reg := (*uint32)(unsafe.Pointer(uintptr(addr)))
+
+	for i := 0; i+4 <= len(buf); i += 4 {
+		r := atomic.LoadUint32(reg)
+
+		buf[i] = byte(r)
+		buf[i+1] = byte(r >> 8)
+		buf[i+2] = byte(r >> 16)
+		buf[i+3] = byte(r >> 24)
+	}
+}
+
+// WriteFIFO writes the buffer, in little-endian order, with consecutive
+// 32-bit writes to a FIFO data port register, any trailing bytes beyond a
+// multiple of 4 are ignored.
+func WriteFIFO(addr uint32, buf []byte) {
+	reg := (*uint32)(unsafe.Pointer(uintptr(addr)))
+
+	for i := 0; i+4 <= len(buf); i += 4 {
+		r := uint32(buf[i]) | uint32(buf[i+1])<<8 | uint32(buf[i+2])<<16 | uint32(buf[i+3])<<24
+		atomic.StoreUint32(reg, r)
+	}
+}
+
 func WriteBack(addr uint32) {
 	reg := (*uint32)(unsafe.Pointer(uintptr(addr)))
 
@@ -0,0 +1,123 @@
+// Ring buffer
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// Package ring implements a fixed size byte ring buffer, meant to be shared
+// between drivers for buffering of received and transmitted data.
+//
+// The buffer supports lock-free operation with a single producer and a single
+// consumer, which can therefore run in different contexts (e.g. an interrupt
+// handler filling the buffer and a goroutine draining it). Multiple producers
+// or consumers must be serialized by the caller.
+//
+// The buffer holds bytes rather than being a generic Ring[T], as type
+// parameters require Go 1.18 while the module targets Go 1.15 (see go.mod),
+// all current users (serial receive and transmit buffers, console outputs)
+// exchange byte streams.
+package ring
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// Buffer represents a ring buffer instance.
+type Buffer struct {
+	buf  []byte
+	mask uint32
+
+	// write index, only updated by the producer
+	head uint32
+	// read index, only updated by the consumer
+	tail uint32
+}
+
+// NewBuffer allocates a ring buffer of the argument size, which must be a
+// power of 2.
+//
+// Buffers are meant to be allocated at driver initialization, as allocation
+// must be avoided within interrupt handlers.
+func NewBuffer(size int) (r *Buffer, err error) {
+	if size <= 0 || size&(size-1) != 0 {
+		return nil, errors.New("ring buffer size must be a power of 2")
+	}
+
+	r = &Buffer{
+		buf:  make([]byte, size),
+		mask: uint32(size - 1),
+	}
+
+	return
+}
+
+// Cap returns the buffer capacity.
+func (r *Buffer) Cap() int {
+	return len(r.buf)
+}
+
+// Len returns the number of bytes available for reading.
+func (r *Buffer) Len() int {
+	return int(atomic.LoadUint32(&r.head) - atomic.LoadUint32(&r.tail))
+}
+
+// Put adds a single byte to the buffer, it returns false if the buffer is
+// full. It must only be invoked by the producer.
+func (r *Buffer) Put(c byte) bool {
+	head := atomic.LoadUint32(&r.head)
+
+	if head-atomic.LoadUint32(&r.tail) == uint32(len(r.buf)) {
+		return false
+	}
+
+	r.buf[head&r.mask] = c
+	atomic.StoreUint32(&r.head, head+1)
+
+	return true
+}
+
+// Get removes a single byte from the buffer, it returns false if the buffer
+// is empty. It must only be invoked by the consumer.
+func (r *Buffer) Get() (c byte, ok bool) {
+	tail := atomic.LoadUint32(&r.tail)
+
+	if atomic.LoadUint32(&r.head) == tail {
+		return
+	}
+
+	c = r.buf[tail&r.mask]
+	atomic.StoreUint32(&r.tail, tail+1)
+
+	return c, true
+}
+
+// Write adds, until the buffer is full, the argument bytes to the buffer, it
+// returns the number of bytes written. It must only be invoked by the
+// producer.
+func (r *Buffer) Write(p []byte) (n int) {
+	for n = 0; n < len(p); n++ {
+		if !r.Put(p[n]) {
+			break
+		}
+	}
+
+	return
+}
+
+// Read removes, until the buffer is empty, bytes from the buffer, it returns
+// the number of bytes read. It must only be invoked by the consumer.
+func (r *Buffer) Read(p []byte) (n int) {
+	var ok bool
+
+	for n = 0; n < len(p); n++ {
+		if p[n], ok = r.Get(); !ok {
+			break
+		}
+	}
+
+	return
+}
@@ -0,0 +1,189 @@
+// Ring buffer
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+func TestNewBufferSize(t *testing.T) {
+	for _, size := range []int{-1, 0, 3, 6, 100} {
+		if _, err := NewBuffer(size); err == nil {
+			t.Errorf("NewBuffer(%d) succeeded, expected error", size)
+		}
+	}
+
+	for _, size := range []int{1, 2, 4, 4096} {
+		r, err := NewBuffer(size)
+
+		if err != nil {
+			t.Fatalf("NewBuffer(%d) failed, %v", size, err)
+		}
+
+		if r.Cap() != size {
+			t.Errorf("Cap() = %d, expected %d", r.Cap(), size)
+		}
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	r, _ := NewBuffer(4)
+
+	if _, ok := r.Get(); ok {
+		t.Error("Get() on empty buffer succeeded")
+	}
+
+	if n := r.Read(make([]byte, 4)); n != 0 {
+		t.Errorf("Read() on empty buffer returned %d bytes", n)
+	}
+
+	if r.Len() != 0 {
+		t.Errorf("Len() = %d, expected 0", r.Len())
+	}
+}
+
+func TestFull(t *testing.T) {
+	r, _ := NewBuffer(4)
+
+	if n := r.Write([]byte{1, 2, 3, 4, 5, 6}); n != 4 {
+		t.Fatalf("Write() = %d, expected 4", n)
+	}
+
+	if r.Put(7) {
+		t.Error("Put() on full buffer succeeded")
+	}
+
+	if r.Len() != 4 {
+		t.Errorf("Len() = %d, expected 4", r.Len())
+	}
+
+	buf := make([]byte, 8)
+
+	if n := r.Read(buf); n != 4 || !bytes.Equal(buf[0:n], []byte{1, 2, 3, 4}) {
+		t.Errorf("Read() = %v, expected [1 2 3 4]", buf[0:n])
+	}
+}
+
+func TestWraparound(t *testing.T) {
+	r, _ := NewBuffer(4)
+	buf := make([]byte, 3)
+
+	// advance the indices past several buffer lengths, with transfers
+	// which are not aligned to the buffer size
+	for i := 0; i < 100; i++ {
+		in := []byte{byte(i), byte(i + 1), byte(i + 2)}
+
+		if n := r.Write(in); n != 3 {
+			t.Fatalf("Write() = %d, expected 3 (iteration %d)", n, i)
+		}
+
+		if n := r.Read(buf); n != 3 || !bytes.Equal(buf, in) {
+			t.Fatalf("Read() = %v, expected %v (iteration %d)", buf[0:n], in, i)
+		}
+	}
+}
+
+func TestIndexOverflow(t *testing.T) {
+	r, _ := NewBuffer(4)
+
+	// place the indices right before the uint32 wraparound
+	r.head = ^uint32(0) - 1
+	r.tail = r.head
+
+	if n := r.Write([]byte{1, 2, 3, 4}); n != 4 {
+		t.Fatalf("Write() = %d, expected 4", n)
+	}
+
+	if r.Len() != 4 {
+		t.Fatalf("Len() = %d, expected 4", r.Len())
+	}
+
+	if r.Put(5) {
+		t.Error("Put() on full buffer succeeded")
+	}
+
+	buf := make([]byte, 4)
+
+	if n := r.Read(buf); n != 4 || !bytes.Equal(buf, []byte{1, 2, 3, 4}) {
+		t.Errorf("Read() = %v, expected [1 2 3 4]", buf[0:n])
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	const total = 1 << 20
+
+	r, _ := NewBuffer(64)
+	done := make(chan error)
+
+	go func() {
+		var c byte
+
+		for i := 0; i < total; {
+			// vary the transfer size to exercise partial writes
+			size := 1 + i%5
+
+			if size > total-i {
+				size = total - i
+			}
+
+			n := r.Write([]byte{c, c + 1, c + 2, c + 3, c + 4}[0:size])
+
+			if n == 0 {
+				runtime.Gosched()
+			}
+
+			c += byte(n)
+			i += n
+		}
+	}()
+
+	go func() {
+		var expected byte
+		buf := make([]byte, 7)
+
+		for i := 0; i < total; {
+			size := 1 + i%7
+
+			if size > total-i {
+				size = total - i
+			}
+
+			n := r.Read(buf[0:size])
+
+			if n == 0 {
+				runtime.Gosched()
+			}
+
+			for j := 0; j < n; j++ {
+				if buf[j] != expected {
+					done <- fmt.Errorf("byte %d is %d, expected %d", i+j, buf[j], expected)
+					return
+				}
+
+				expected++
+			}
+
+			i += n
+		}
+
+		done <- nil
+	}()
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Len() != 0 {
+		t.Errorf("Len() = %d after draining, expected 0", r.Len())
+	}
+}
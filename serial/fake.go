@@ -0,0 +1,90 @@
+// Serial port interface
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package serial
+
+import (
+	"sync"
+)
+
+// Fake represents an in-memory serial port, with deterministic behavior, for
+// testing purposes. Received data is injected with Feed() while transmitted
+// data is retrieved with Output().
+type Fake struct {
+	sync.Mutex
+
+	rx []byte
+	tx []byte
+}
+
+// Feed appends data to the receive queue, it is returned by subsequent Rx()
+// and Read() invocations.
+func (f *Fake) Feed(buf []byte) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.rx = append(f.rx, buf...)
+}
+
+// Output returns, and clears, all data transmitted so far.
+func (f *Fake) Output() (buf []byte) {
+	f.Lock()
+	defer f.Unlock()
+
+	buf = f.tx
+	f.tx = nil
+
+	return
+}
+
+// Tx transmits a single character to the fake serial port.
+func (f *Fake) Tx(c byte) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.tx = append(f.tx, c)
+}
+
+// Rx receives a single character from the fake serial port receive queue.
+func (f *Fake) Rx() (c byte, valid bool) {
+	f.Lock()
+	defer f.Unlock()
+
+	if len(f.rx) == 0 {
+		return
+	}
+
+	c = f.rx[0]
+	f.rx = f.rx[1:]
+
+	return c, true
+}
+
+// Write data from buffer to the fake serial port, it implements io.Writer.
+func (f *Fake) Write(buf []byte) (n int, err error) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.tx = append(f.tx, buf...)
+
+	return len(buf), nil
+}
+
+// Read available data to buffer from the fake serial port receive queue, it
+// implements io.Reader. The function does not block, it returns zero with a
+// nil error when the queue is empty.
+func (f *Fake) Read(buf []byte) (n int, err error) {
+	f.Lock()
+	defer f.Unlock()
+
+	n = copy(buf, f.rx)
+	f.rx = f.rx[n:]
+
+	return
+}
@@ -0,0 +1,90 @@
+// Serial port interface
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package serial
+
+import (
+	"bufio"
+	"fmt"
+	"testing"
+)
+
+// Fake must be usable wherever a serial port is expected.
+var _ Port = &Fake{}
+
+func TestFakeReceive(t *testing.T) {
+	f := &Fake{}
+
+	if _, valid := f.Rx(); valid {
+		t.Error("Rx() on empty queue returned a character")
+	}
+
+	f.Feed([]byte("ab"))
+	f.Feed([]byte("cd"))
+
+	if c, valid := f.Rx(); !valid || c != 'a' {
+		t.Errorf("Rx() = %q, %v, expected 'a', true", c, valid)
+	}
+
+	buf := make([]byte, 2)
+
+	if n, err := f.Read(buf); n != 2 || err != nil || string(buf) != "bc" {
+		t.Errorf("Read() = %d, %v (%q), expected 2, nil (\"bc\")", n, err, buf[0:n])
+	}
+
+	if n, err := f.Read(buf); n != 1 || err != nil || buf[0] != 'd' {
+		t.Errorf("Read() = %d, %v (%q), expected 1, nil (\"d\")", n, err, buf[0:n])
+	}
+
+	// reads do not block on an empty queue
+	if n, err := f.Read(buf); n != 0 || err != nil {
+		t.Errorf("Read() on empty queue = %d, %v, expected 0, nil", n, err)
+	}
+}
+
+func TestFakeTransmit(t *testing.T) {
+	f := &Fake{}
+
+	f.Tx('a')
+
+	if n, err := f.Write([]byte("bc")); n != 2 || err != nil {
+		t.Errorf("Write() = %d, %v, expected 2, nil", n, err)
+	}
+
+	if out := f.Output(); string(out) != "abc" {
+		t.Errorf("Output() = %q, expected \"abc\"", out)
+	}
+
+	if out := f.Output(); len(out) != 0 {
+		t.Errorf("Output() = %q after being cleared, expected empty", out)
+	}
+}
+
+func TestFakeStandardLibrary(t *testing.T) {
+	f := &Fake{}
+
+	fmt.Fprintf(f, "%s %d\n", "value", 42)
+
+	if out := f.Output(); string(out) != "value 42\n" {
+		t.Errorf("Output() = %q, expected \"value 42\\n\"", out)
+	}
+
+	f.Feed([]byte("first\nsecond\n"))
+
+	var lines []string
+	s := bufio.NewScanner(f)
+
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+
+	if len(lines) != 2 || lines[0] != "first" || lines[1] != "second" {
+		t.Errorf("scanned %q, expected [\"first\" \"second\"]", lines)
+	}
+}
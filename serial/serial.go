@@ -0,0 +1,34 @@
+// Serial port interface
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// Package serial defines the interface implemented by serial port drivers
+// (e.g. imx6.UART), to decouple higher level protocol code from a specific
+// hardware instance.
+//
+// An in-memory implementation (see Fake) is also provided, unlike drivers it
+// does not access any hardware register and it can therefore be used with
+// `go test` on the host, without `GOOS=tamago`.
+package serial
+
+import (
+	"io"
+)
+
+// Port represents a serial port instance.
+type Port interface {
+	// Tx transmits a single character.
+	Tx(c byte)
+	// Rx receives a single character, if available.
+	Rx() (c byte, valid bool)
+	// Write transmits the buffer contents.
+	io.Writer
+	// Read receives available data to the buffer, without blocking,
+	// returning the number of characters read.
+	io.Reader
+}
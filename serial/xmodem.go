@@ -0,0 +1,205 @@
+// Serial port interface
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package serial
+
+import (
+	"errors"
+	"io"
+	"runtime"
+	"time"
+)
+
+// XMODEM control characters
+const (
+	SOH = 0x01
+	STX = 0x02
+	EOT = 0x04
+	ACK = 0x06
+	NAK = 0x15
+	CAN = 0x18
+	// CRC mode request
+	CRC = 'C'
+)
+
+const (
+	// maximum number of start requests
+	xmodemStartRetries = 20
+	// maximum number of consecutive errors
+	xmodemMaxErrors = 10
+)
+
+// XMODEM timeouts, variables rather than constants so that host tests can
+// shorten them.
+var (
+	// timeout for the reception of each character within a block
+	xmodemCharTimeout = 1 * time.Second
+	// interval between transfer start requests
+	xmodemStartTimeout = 3 * time.Second
+)
+
+// rxTimeout polls the serial port for a character until the argument timeout
+// expires.
+func rxTimeout(port Port, timeout time.Duration) (c byte, err error) {
+	var valid bool
+
+	deadline := time.Now().Add(timeout)
+
+	for {
+		if c, valid = port.Rx(); valid {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			return 0, errors.New("timeout")
+		}
+
+		runtime.Gosched()
+	}
+}
+
+// purge discards received characters until the line is idle.
+func purge(port Port) {
+	for {
+		if _, err := rxTimeout(port, xmodemCharTimeout); err != nil {
+			return
+		}
+	}
+}
+
+// crc16 computes the XMODEM CRC-16 (CCITT polynomial 0x1021, zero initial
+// value).
+func crc16(buf []byte) (crc uint16) {
+	for _, b := range buf {
+		crc ^= uint16(b) << 8
+
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return
+}
+
+// readBlock receives the remaining of a block, after its header character,
+// returning its sequence number and data.
+func readBlock(port Port, size int) (seq byte, data []byte, err error) {
+	// sequence number, its complement, data and CRC
+	buf := make([]byte, 2+size+2)
+
+	for i := range buf {
+		if buf[i], err = rxTimeout(port, xmodemCharTimeout); err != nil {
+			return
+		}
+	}
+
+	if buf[0] != ^buf[1] {
+		return 0, nil, errors.New("invalid sequence number")
+	}
+
+	data = buf[2 : 2+size]
+	crc := uint16(buf[2+size])<<8 | uint16(buf[3+size])
+
+	if crc16(data) != crc {
+		return 0, nil, errors.New("invalid CRC")
+	}
+
+	return buf[0], data, nil
+}
+
+// ReceiveXMODEM receives a file over the argument serial port using the
+// XMODEM-CRC protocol, 1024 bytes blocks (XMODEM-1K) are also supported. Each
+// received block is written to the argument destination, after verification,
+// before being acknowledged.
+//
+// The protocol does not convey the file size, therefore the last block is
+// written as received, including any padding (typically 0x1a characters)
+// added by the sender.
+func ReceiveXMODEM(port Port, w io.Writer) (err error) {
+	var c byte
+	var failures int
+
+	seq := byte(1)
+
+	// request CRC mode until the sender starts the transfer
+	for i := 0; ; i++ {
+		if i == xmodemStartRetries {
+			return errors.New("transfer start timeout")
+		}
+
+		port.Tx(CRC)
+
+		if c, err = rxTimeout(port, xmodemStartTimeout); err == nil {
+			break
+		}
+	}
+
+	for {
+		var size int
+
+		switch c {
+		case SOH:
+			size = 128
+		case STX:
+			size = 1024
+		case EOT:
+			port.Tx(ACK)
+			return nil
+		case CAN:
+			return errors.New("transfer cancelled by sender")
+		}
+
+		if size > 0 {
+			var n byte
+			var data []byte
+
+			if n, data, err = readBlock(port, size); err == nil {
+				switch n {
+				case seq:
+					if _, err = w.Write(data); err != nil {
+						port.Write([]byte{CAN, CAN})
+						return
+					}
+
+					seq++
+					failures = 0
+
+					port.Tx(ACK)
+				case seq - 1:
+					// duplicate block, previous ACK was lost
+					port.Tx(ACK)
+				default:
+					port.Write([]byte{CAN, CAN})
+					return errors.New("block out of sequence")
+				}
+			}
+		}
+
+		if size == 0 || err != nil {
+			failures++
+
+			if failures == xmodemMaxErrors {
+				port.Write([]byte{CAN, CAN})
+				return errors.New("too many errors")
+			}
+
+			purge(port)
+			port.Tx(NAK)
+		}
+
+		if c, err = rxTimeout(port, 10*xmodemCharTimeout); err != nil {
+			port.Write([]byte{CAN, CAN})
+			return errors.New("block timeout")
+		}
+	}
+}
@@ -0,0 +1,267 @@
+// Serial port interface
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package serial
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestCRC16(t *testing.T) {
+	// CRC-16/XMODEM check value
+	if crc := crc16([]byte("123456789")); crc != 0x31c3 {
+		t.Errorf("crc16(\"123456789\") = %#04x, expected 0x31c3", crc)
+	}
+
+	if crc := crc16(nil); crc != 0 {
+		t.Errorf("crc16(nil) = %#04x, expected 0", crc)
+	}
+}
+
+// shortTimeouts reduces the XMODEM timeouts for the duration of a test.
+func shortTimeouts(t *testing.T) {
+	char, start := xmodemCharTimeout, xmodemStartTimeout
+
+	// the start timeout must exceed the sender response time, to avoid
+	// duplicate start requests
+	xmodemCharTimeout = 10 * time.Millisecond
+	xmodemStartTimeout = 100 * time.Millisecond
+
+	t.Cleanup(func() {
+		xmodemCharTimeout, xmodemStartTimeout = char, start
+	})
+}
+
+// block returns an XMODEM block, 1024 bytes blocks are used for data larger
+// than 128 bytes, the data is padded with 0x1a characters.
+func block(seq byte, data []byte) []byte {
+	header := byte(SOH)
+	size := 128
+
+	if len(data) > 128 {
+		header = STX
+		size = 1024
+	}
+
+	payload := append([]byte{}, data...)
+
+	for len(payload) < size {
+		payload = append(payload, 0x1a)
+	}
+
+	crc := crc16(payload)
+
+	b := []byte{header, seq, ^seq}
+	b = append(b, payload...)
+
+	return append(b, byte(crc>>8), byte(crc))
+}
+
+// sender simulates an XMODEM sender, on the other end of a fake serial port,
+// transmitting its blocks in response to the receiver control characters.
+type sender struct {
+	port   *Fake
+	blocks [][]byte
+	// number of corrupted transmissions for each block index
+	corrupt map[int]int
+
+	// characters transmitted by the receiver
+	received []byte
+}
+
+func (s *sender) send(i int) {
+	if i == len(s.blocks) {
+		s.port.Feed([]byte{EOT})
+		return
+	}
+
+	b := append([]byte{}, s.blocks[i]...)
+
+	if s.corrupt[i] > 0 {
+		s.corrupt[i]--
+		// invert the last CRC byte
+		b[len(b)-1] ^= 0xff
+	}
+
+	s.port.Feed(b)
+}
+
+// run handles the receiver control characters until done is closed.
+func (s *sender) run(done chan struct{}) {
+	i := 0
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		for _, c := range s.port.Output() {
+			s.received = append(s.received, c)
+
+			switch c {
+			case CRC, NAK:
+				s.send(i)
+			case ACK:
+				if i < len(s.blocks) {
+					i++
+					s.send(i)
+				}
+			}
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// receive runs ReceiveXMODEM against the argument sender.
+func receive(s *sender) (data []byte, err error) {
+	var out bytes.Buffer
+
+	done := make(chan struct{})
+	exit := make(chan struct{})
+
+	go func() {
+		s.run(done)
+		close(exit)
+	}()
+
+	err = ReceiveXMODEM(s.port, &out)
+
+	close(done)
+	<-exit
+
+	// collect the last receiver characters
+	s.received = append(s.received, s.port.Output()...)
+
+	return out.Bytes(), err
+}
+
+func TestReceiveXMODEM(t *testing.T) {
+	shortTimeouts(t)
+
+	first := bytes.Repeat([]byte{0xaa}, 128)
+	second := bytes.Repeat([]byte{0x55}, 1024)
+	last := []byte("end")
+
+	s := &sender{
+		port:   &Fake{},
+		blocks: [][]byte{block(1, first), block(2, second), block(3, last)},
+	}
+
+	data, err := receive(s)
+
+	if err != nil {
+		t.Fatalf("ReceiveXMODEM() failed, %v", err)
+	}
+
+	expected := append(append(append([]byte{}, first...), second...), block(3, last)[3:3+128]...)
+
+	if !bytes.Equal(data, expected) {
+		t.Errorf("received %d bytes, expected %d", len(data), len(expected))
+	}
+
+	if ctl := []byte{CRC, ACK, ACK, ACK, ACK}; !bytes.Equal(s.received, ctl) {
+		t.Errorf("receiver sent %q, expected %q", s.received, ctl)
+	}
+}
+
+func TestReceiveXMODEMBadCRC(t *testing.T) {
+	shortTimeouts(t)
+
+	data := bytes.Repeat([]byte{0x42}, 128)
+
+	s := &sender{
+		port:    &Fake{},
+		blocks:  [][]byte{block(1, data)},
+		corrupt: map[int]int{0: 2},
+	}
+
+	received, err := receive(s)
+
+	if err != nil {
+		t.Fatalf("ReceiveXMODEM() failed, %v", err)
+	}
+
+	if !bytes.Equal(received, data) {
+		t.Errorf("received %x, expected %x", received, data)
+	}
+
+	// each corrupted block must be rejected before the retransmission
+	if ctl := []byte{CRC, NAK, NAK, ACK, ACK}; !bytes.Equal(s.received, ctl) {
+		t.Errorf("receiver sent %q, expected %q", s.received, ctl)
+	}
+}
+
+func TestReceiveXMODEMTooManyErrors(t *testing.T) {
+	shortTimeouts(t)
+
+	s := &sender{
+		port:    &Fake{},
+		blocks:  [][]byte{block(1, []byte("data"))},
+		corrupt: map[int]int{0: xmodemMaxErrors},
+	}
+
+	if _, err := receive(s); err == nil {
+		t.Fatal("ReceiveXMODEM() succeeded, expected error")
+	}
+
+	if n := bytes.Count(s.received, []byte{NAK}); n != xmodemMaxErrors-1 {
+		t.Errorf("receiver sent %d NAKs, expected %d", n, xmodemMaxErrors-1)
+	}
+
+	if !bytes.HasSuffix(s.received, []byte{CAN, CAN}) {
+		t.Errorf("receiver sent %q, expected transfer cancellation", s.received)
+	}
+}
+
+func TestReceiveXMODEMStartTimeout(t *testing.T) {
+	shortTimeouts(t)
+
+	port := &Fake{}
+
+	if err := ReceiveXMODEM(port, &bytes.Buffer{}); err == nil {
+		t.Fatal("ReceiveXMODEM() succeeded without a sender, expected error")
+	}
+
+	if out := port.Output(); !bytes.Equal(out, bytes.Repeat([]byte{CRC}, xmodemStartRetries)) {
+		t.Errorf("receiver sent %q, expected %d start requests", out, xmodemStartRetries)
+	}
+}
+
+func TestReceiveXMODEMBlockTimeout(t *testing.T) {
+	shortTimeouts(t)
+
+	var out bytes.Buffer
+	port := &Fake{}
+
+	// send a single block, without ending the transfer
+	go func() {
+		for bytes.IndexByte(port.Output(), CRC) < 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		port.Feed(block(1, []byte("data")))
+	}()
+
+	if err := ReceiveXMODEM(port, &out); err == nil {
+		t.Fatal("ReceiveXMODEM() succeeded without transfer end, expected error")
+	}
+
+	if out.Len() != 128 {
+		t.Errorf("received %d bytes, expected 128", out.Len())
+	}
+
+	if ctl := port.Output(); !bytes.HasSuffix(ctl, []byte{ACK, CAN, CAN}) {
+		t.Errorf("receiver sent %q, expected block acknowledgment and transfer cancellation", ctl)
+	}
+}
@@ -41,7 +41,7 @@ var ARM = &arm.CPU{}
 
 //go:linkname nanotime1 runtime.nanotime1
 func nanotime1() int64 {
-	return int64(read_systimer() * ARM.TimerMultiplier)
+	return ARM.TimerNanos(read_systimer())
 }
 
 // Init takes care of the lower level SoC initialization triggered early in
@@ -59,6 +59,7 @@ func Init(base uint32) {
 
 	ARM.TimerMultiplier = refFreq / SysTimerFreq
 	ARM.TimerFn = read_systimer
+	ARM.TimerOffset = read_systimer()
 
 	// initialize serial console
 	MiniUART.Init()
@@ -0,0 +1,255 @@
+// NXP i.MX6 performance measurements
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/f-secure-foundry/tamago/dma"
+	"github.com/f-secure-foundry/tamago/soc/imx6/rngb"
+)
+
+const (
+	// buffer size for copies served by the L1 data cache
+	benchCachedSize = 8 * 1024
+	// buffer size for copies exceeding the L2 cache, served by DDR
+	benchDRAMSize = 2 * 1024 * 1024
+	// amount of data processed by each measurement
+	benchTotal = 4 * 1024 * 1024
+
+	// buffer size for DMA and random number generator measurements, DMA
+	// buffers are allocated in the (limited) DMA region
+	benchDMASize = 16 * 1024
+	// amount of data processed by DMA and random number generator
+	// measurements
+	benchDMATotal = 256 * 1024
+	// smallest buffer size for the CPU and DMA copy comparison
+	benchCrossoverMin = 64
+)
+
+// BenchmarkResult represents the result of a throughput measurement.
+type BenchmarkResult struct {
+	// measurement name
+	Name string
+	// processed bytes
+	Bytes int
+	// measurement duration
+	Duration time.Duration
+	// measurement error, if any
+	Err error
+}
+
+// Throughput returns the measured throughput in MB/s.
+func (r BenchmarkResult) Throughput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+
+	return float64(r.Bytes) / r.Duration.Seconds() / 1e6
+}
+
+// String returns the result in human readable format.
+func (r BenchmarkResult) String() string {
+	if r.Err != nil {
+		return fmt.Sprintf("%-24s error: %v", r.Name, r.Err)
+	}
+
+	return fmt.Sprintf("%-24s %8.2f MB/s (%d bytes in %v)", r.Name, r.Throughput(), r.Bytes, r.Duration)
+}
+
+type benchmark struct {
+	name string
+	fn   func(buf []byte) error
+}
+
+// benchmarks registered by packages external to imx6 (see RegisterBenchmark())
+var benchmarks []benchmark
+var benchmarksMutex sync.Mutex
+
+// RegisterBenchmark adds a measurement to the Benchmark() suite, the argument
+// function is repeatedly invoked with a 16 KB buffer to process. It is used
+// by drivers which cannot be referenced by this package (e.g. DCP), to report
+// their throughput.
+func RegisterBenchmark(name string, fn func(buf []byte) error) {
+	if fn == nil {
+		return
+	}
+
+	benchmarksMutex.Lock()
+	defer benchmarksMutex.Unlock()
+
+	for i, b := range benchmarks {
+		if b.name == name {
+			benchmarks[i].fn = fn
+			return
+		}
+	}
+
+	benchmarks = append(benchmarks, benchmark{name, fn})
+}
+
+// measure repeatedly invokes the argument function, processing size bytes
+// for each invocation, until total bytes are processed.
+func measure(name string, size int, total int, fn func() error) (r BenchmarkResult) {
+	r.Name = name
+
+	start := time.Now()
+
+	for r.Bytes < total {
+		if r.Err = fn(); r.Err != nil {
+			break
+		}
+
+		r.Bytes += size
+	}
+
+	r.Duration = time.Since(start)
+
+	return
+}
+
+// Benchmark measures and prints on the console, returning them as well, the
+// throughput of memory copies and of the available hardware engines.
+//
+// The measurements include CPU copies on buffers which fit the L1 data cache,
+// on cacheable buffers which exceed the L2 cache, therefore served by DDR
+// through cache line fills and evictions, and on buffers within the DMA
+// region, which is mapped as uncached (see dma.InitHandler()). When available
+// SDMA memory-to-memory copies (see DMACopy()), RNGB random number generation
+// and any measurement registered by external drivers (e.g. DCP AES-128-CBC
+// encryption, see RegisterBenchmark()) are also included.
+//
+// CPU and SDMA copies are also compared for increasing sizes, on the same DMA
+// buffers, to report the size from which SDMA is faster.
+//
+// The results allow to choose between CPU and DMA data paths, and to verify
+// that caches are enabled (a cached copy is expected to be several times
+// faster than an uncached one), the suite takes a few seconds to execute.
+func Benchmark() (results []BenchmarkResult) {
+	add := func(r BenchmarkResult) {
+		fmt.Println(r)
+		results = append(results, r)
+	}
+
+	src := make([]byte, benchDRAMSize)
+	dst := make([]byte, benchDRAMSize)
+
+	add(measure("memcpy (cached)", benchCachedSize, benchTotal, func() error {
+		copy(dst[0:benchCachedSize], src[0:benchCachedSize])
+		return nil
+	}))
+
+	add(measure("memcpy (DDR, cached)", benchDRAMSize, benchTotal, func() error {
+		copy(dst, src)
+		return nil
+	}))
+
+	srcAddr, srcBuf := dma.Reserve(benchDMASize, 4)
+	defer dma.Release(srcAddr)
+
+	dstAddr, dstBuf := dma.Reserve(benchDMASize, 4)
+	defer dma.Release(dstAddr)
+
+	add(measure("memcpy (DDR, uncached)", benchDMASize, benchDMATotal, func() error {
+		copy(dstBuf, srcBuf)
+		return nil
+	}))
+
+	if SDMA.ccb != 0 {
+		add(measure("SDMA copy", benchDMASize, benchDMATotal, func() error {
+			return DMACopy(dstAddr, srcAddr, benchDMASize)
+		}))
+
+		crossover := 0
+
+		// compare CPU and SDMA copies, on the same buffers, to find
+		// the smallest size for which SDMA is faster
+		for size := benchCrossoverMin; size <= benchDMASize; size *= 2 {
+			cpu := measure(fmt.Sprintf("memcpy (uncached, %d bytes)", size), size, benchDMATotal, func() error {
+				copy(dstBuf[0:size], srcBuf[0:size])
+				return nil
+			})
+
+			sdma := measure(fmt.Sprintf("SDMA copy (%d bytes)", size), size, benchDMATotal, func() error {
+				return DMACopy(dstAddr, srcAddr, size)
+			})
+
+			add(cpu)
+			add(sdma)
+
+			if crossover == 0 && sdma.Err == nil && sdma.Duration < cpu.Duration {
+				crossover = size
+			}
+		}
+
+		if crossover != 0 {
+			fmt.Printf("SDMA copy faster than CPU from %d bytes\n", crossover)
+		} else {
+			fmt.Printf("SDMA copy slower than CPU up to %d bytes\n", benchDMASize)
+		}
+	}
+
+	if Family == IMX6ULL && Native {
+		add(measure("RNGB", benchDMASize, benchDMATotal, func() error {
+			rngb.GetRandomData(dst[0:benchDMASize])
+			return nil
+		}))
+	}
+
+	benchmarksMutex.Lock()
+	defer benchmarksMutex.Unlock()
+
+	for _, b := range benchmarks {
+		fn := b.fn
+
+		add(measure(b.name, benchDMASize, benchDMATotal, func() error {
+			return fn(dst[0:benchDMASize])
+		}))
+	}
+
+	return
+}
+
+// BenchmarkWrite measures, printing the results on the console and returning
+// them as well, the UART transmit throughput with the argument amount of data,
+// transmitted character by character (see Tx()) and in bulk through the TX
+// FIFO (see WriteString()).
+//
+// The data, consisting of NUL characters, is transmitted on the serial line,
+// the measurement should therefore be performed on a UART which is not used
+// as console. Both measurements are bound by the port speed, the bulk one is
+// expected to approach it more closely as the transmitter is never starved
+// between characters.
+func (hw *UART) BenchmarkWrite(size int) (results []BenchmarkResult) {
+	add := func(r BenchmarkResult) {
+		fmt.Println(r)
+		results = append(results, r)
+	}
+
+	buf := make([]byte, size)
+	s := string(buf)
+
+	add(measure(fmt.Sprintf("UART%d Tx", hw.n), size, size, func() error {
+		for _, c := range buf {
+			hw.Tx(c)
+		}
+
+		return nil
+	}))
+
+	add(measure(fmt.Sprintf("UART%d WriteString", hw.n), size, size, func() (err error) {
+		_, err = hw.WriteString(s)
+		return
+	}))
+
+	return
+}
@@ -0,0 +1,105 @@
+// NXP i.MX6 boot time measurement
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"sync"
+	"time"
+)
+
+// maximum number of boot phase timestamps
+const maxBootMarks = 8
+
+// BootPhase represents the duration of an initialization phase.
+type BootPhase struct {
+	// phase name
+	Name string
+	// phase duration
+	Duration time.Duration
+}
+
+type bootMark struct {
+	name string
+	ns   int64
+}
+
+// Boot phase timestamps, the first ones are recorded by Init() and initRNG(),
+// before the runtime heap is initialized.
+var bootMarks [maxBootMarks]bootMark
+var bootCount int
+var bootDone bool
+var bootMutex sync.Mutex
+
+// markBoot records the end of the argument boot phase, timestamps are taken
+// from the CPU timer and are therefore only available after its
+// initialization in Init().
+func markBoot(name string) {
+	if ARM.Timer == nil {
+		return
+	}
+
+	bootMutex.Lock()
+	defer bootMutex.Unlock()
+
+	if bootDone || bootCount == maxBootMarks {
+		return
+	}
+
+	bootMarks[bootCount] = bootMark{
+		name: name,
+		ns:   ARM.Timer.Nanos(),
+	}
+
+	bootCount++
+}
+
+func init() {
+	markBoot("runtime (scheduler)")
+
+	bootMutex.Lock()
+	bootDone = true
+	bootMutex.Unlock()
+}
+
+// BootTiming returns the duration of each boot phase, in execution order,
+// measured from the CPU timer initialization in Init(), therefore excluding
+// the time spent by the boot ROM, any bootloader and the earliest processor
+// setup (e.g. cache enabling).
+//
+// The following phases are reported:
+//   * SoC init:            remaining SoC initialization in Init()
+//   * board init:          initialization functions executed by the board
+//                          package within runtime.hwinit (see RunInit())
+//   * runtime (early):     runtime initialization up to entropy source setup
+//   * RNG init:            entropy source initialization
+//   * runtime (scheduler): runtime initialization up to this package init()
+//
+// The measurement is limited to timestamping each phase boundary, so that it
+// can be left enabled in production builds, the results can be retrieved at
+// any time once the console is available (e.g. from main()).
+func BootTiming() (phases []BootPhase) {
+	bootMutex.Lock()
+	defer bootMutex.Unlock()
+
+	var prev int64
+
+	for i := 0; i < bootCount; i++ {
+		m := bootMarks[i]
+
+		phases = append(phases, BootPhase{
+			Name:     m.name,
+			Duration: time.Duration(m.ns - prev),
+		})
+
+		prev = m.ns
+	}
+
+	return
+}
@@ -0,0 +1,82 @@
+// NXP i.MX6 cache maintenance
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"unsafe"
+
+	"github.com/f-secure-foundry/tamago/arm"
+)
+
+// ddrBase returns the external RAM base address for the detected processor
+// family (see Family).
+func ddrBase() uint32 {
+	if Family == IMX6Q {
+		return DDR_BASE_IMX6Q
+	}
+
+	return DDR_BASE_IMX6UL
+}
+
+// initMMU enables the MMU with the memory attributes of the i.MX6 address
+// space, on every board, the data cache is only effective on external RAM,
+// while internal RAM, which holds the default DMA region, and any DMA region
+// placed in external RAM are left non-cacheable (see initDMARegion()).
+func initMMU() {
+	ddr := ddrBase()
+
+	ARM.InitMMU()
+
+	// boot ROM, peripherals and internal RAM
+	ARM.ConfigureMMU(0, ddr, arm.MEMORY_DEVICE)
+	ARM.ConfigureMMU(iramStart, iramStart+iramSize, arm.MEMORY_NORMAL_UNCACHED)
+	// external RAM, up to the top of the 4GB range
+	ARM.ConfigureMMU(ddr, 1<<32-1, arm.MEMORY_NORMAL)
+}
+
+// FlushCache cleans and invalidates the data cache lines which hold the
+// argument buffer, so that its content is visible to DMA masters (e.g. before
+// passing the buffer to a peripheral for transmission).
+func FlushCache(buf []byte) {
+	if len(buf) == 0 {
+		return
+	}
+
+	ARM.CacheFlushRange(uint32(uintptr(unsafe.Pointer(&buf[0]))), len(buf))
+}
+
+// CleanCache cleans the data cache lines which hold the argument buffer, so
+// that its content is visible to DMA masters, without evicting it from the
+// cache (e.g. before passing descriptors to a peripheral which only reads
+// them).
+func CleanCache(buf []byte) {
+	if len(buf) == 0 {
+		return
+	}
+
+	ARM.CacheCleanRange(uint32(uintptr(unsafe.Pointer(&buf[0]))), len(buf))
+}
+
+// InvalidateCache invalidates the data cache lines which hold the argument
+// buffer, so that data written by DMA masters is visible to the CPU (e.g.
+// after a peripheral completes a reception on the buffer).
+//
+// Cache lines only partially covered by the buffer are cleaned first, to
+// preserve adjacent memory, buffers intended for reception should therefore
+// be aligned to, and sized in multiples of, the cache line size (32 bytes on
+// Cortex-A9, 64 bytes on Cortex-A7) to prevent CPU writes to adjacent memory
+// from racing with the transfer.
+func InvalidateCache(buf []byte) {
+	if len(buf) == 0 {
+		return
+	}
+
+	ARM.CacheInvalidateRange(uint32(uintptr(unsafe.Pointer(&buf[0]))), len(buf))
+}
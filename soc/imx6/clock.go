@@ -114,6 +114,15 @@ func ARMFreq() (hz uint32) {
 	return uint32((OSC_FREQ * ARMPLLDiv()) / ARMCoreDiv())
 }
 
+// IPGFreq returns the IPG_CLK_ROOT frequency, which clocks peripheral
+// register access and timing logic (e.g. OCOTP)
+// (p629, Figure 18-2. Clock Tree - Part 1, IMX6ULLRM).
+func IPGFreq() (hz uint32) {
+	// IPG_CLK_ROOT derived from AHB_CLK_ROOT which is 132 MHz
+	ipg_podf := reg.Get(CCM_CBCDR, CBCDR_IPG_PODF, 0b11)
+	return 132000000 / (ipg_podf + 1)
+}
+
 func setOperatingPointIMX6ULL(uV uint32) {
 	var reg0Targ uint32
 	var reg2Targ uint32
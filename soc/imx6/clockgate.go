@@ -0,0 +1,227 @@
+// NXP i.MX6 peripheral clock gating
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/f-secure-foundry/tamago/internal/clock"
+	"github.com/f-secure-foundry/tamago/internal/reg"
+)
+
+// Clock gating registers
+// (CCM Clock Gating Register 0-6, IMX6ULLRM).
+const (
+	CCM_CCGR0  = 0x020c4068
+	CCGR0_CG14 = 28
+
+	CCGR1_CG12 = 24
+	CCGR1_CG5  = 10
+
+	CCM_CCGR3 = 0x020c4074
+	CCGR3_CG3 = 6
+	CCGR3_CG1 = 2
+
+	CCGR5_CG13 = 26
+	CCGR5_CG12 = 24
+
+	CCGR6_CG7 = 14
+)
+
+// Clock gate modes (CCM Clock Gating Register 0-6, IMX6ULLRM).
+const (
+	// clock is off during all modes
+	CLOCK_OFF = 0b00
+	// clock is on in run mode, but off in WAIT and STOP modes
+	CLOCK_ON_RUN = 0b01
+	// clock is on during all modes, except STOP mode
+	CLOCK_ON = 0b11
+)
+
+// ClockGate represents a peripheral clock gate, as the CCGR register and the
+// bit position of its two-bit field.
+type ClockGate struct {
+	CCGR uint32
+	CG   int
+}
+
+// Clock gates of common peripherals on i.MX 6UltraLite, i.MX 6ULL and i.MX
+// 6ULZ.
+var (
+	CLOCK_ECSPI1 = ClockGate{CCM_CCGR1, CCGR1_CG0}
+	CLOCK_ECSPI2 = ClockGate{CCM_CCGR1, CCGR1_CG1}
+	CLOCK_ECSPI3 = ClockGate{CCM_CCGR1, CCGR1_CG2}
+	CLOCK_ECSPI4 = ClockGate{CCM_CCGR1, CCGR1_CG3}
+	CLOCK_I2C1   = ClockGate{CCM_CCGR2, CCGR2_CG3}
+	CLOCK_I2C2   = ClockGate{CCM_CCGR2, CCGR2_CG4}
+	CLOCK_I2C3   = ClockGate{CCM_CCGR2, CCGR2_CG5}
+	CLOCK_I2C4   = ClockGate{CCM_CCGR6, CCGR6_CG12}
+	CLOCK_OCOTP  = ClockGate{CCM_CCGR2, CCGR2_CG6}
+	CLOCK_SDMA   = ClockGate{CCM_CCGR5, CCGR5_CG3}
+	CLOCK_USBOH3 = ClockGate{CCM_CCGR6, CCGR6_CG0}
+	CLOCK_USDHC1 = ClockGate{CCM_CCGR6, CCGR6_CG1}
+	CLOCK_USDHC2 = ClockGate{CCM_CCGR6, CCGR6_CG2}
+	CLOCK_UART1  = ClockGate{CCM_CCGR5, CCGR5_CG12}
+	CLOCK_UART2  = ClockGate{CCM_CCGR0, CCGR0_CG14}
+)
+
+// UART1-8 clock gates on i.MX 6UltraLite, i.MX 6ULL and i.MX 6ULZ.
+var uartClockGate = [8]ClockGate{
+	{CCM_CCGR5, CCGR5_CG12},
+	{CCM_CCGR0, CCGR0_CG14},
+	{CCM_CCGR1, CCGR1_CG5},
+	{CCM_CCGR1, CCGR1_CG12},
+	{CCM_CCGR3, CCGR3_CG1},
+	{CCM_CCGR3, CCGR3_CG3},
+	{CCM_CCGR5, CCGR5_CG13},
+	{CCM_CCGR6, CCGR6_CG7},
+}
+
+// Clock gates of peripherals supported by tamago drivers, which are the only
+// ones affected by GateUnusedClocks(). Gates of the remaining peripherals,
+// as well as the ones required for core operation (e.g. ARM platform, bus
+// fabric, memory controllers, OCRAM, GPIO, IOMUXC, timers, SNVS), are left
+// untouched.
+var driverClockGates = [...]ClockGate{
+	// ECSPI1-4
+	{CCM_CCGR1, CCGR1_CG0},
+	{CCM_CCGR1, CCGR1_CG1},
+	{CCM_CCGR1, CCGR1_CG2},
+	{CCM_CCGR1, CCGR1_CG3},
+	// I2C1-4
+	{CCM_CCGR2, CCGR2_CG3},
+	{CCM_CCGR2, CCGR2_CG4},
+	{CCM_CCGR2, CCGR2_CG5},
+	{CCM_CCGR6, CCGR6_CG12},
+	// GPMI/BCH
+	{CCM_CCGR4, CCGR4_CG12},
+	{CCM_CCGR4, CCGR4_CG13},
+	{CCM_CCGR4, CCGR4_CG14},
+	{CCM_CCGR4, CCGR4_CG15},
+	// SDMA
+	{CCM_CCGR5, CCGR5_CG3},
+	// USB OTG1/OTG2
+	{CCM_CCGR6, CCGR6_CG0},
+	// uSDHC1-2
+	{CCM_CCGR6, CCGR6_CG1},
+	{CCM_CCGR6, CCGR6_CG2},
+}
+
+// Clock gates in use, as masks for each CCGR register (CCM_CCGR0-CCM_CCGR6).
+var clocksInUse [7]uint32
+var clocksMutex sync.Mutex
+
+// ccgrIndex returns the index of the argument CCGR register, or -1 if the
+// address does not belong to a clock gating register.
+func ccgrIndex(ccgr uint32) int {
+	return clock.GateIndex(CCM_CCGR0, len(clocksInUse), ccgr)
+}
+
+// RegisterClock records that the clock gate, at the argument CCGR register
+// and bit position, is required by an initialized driver, preventing its
+// gating by GateUnusedClocks().
+//
+// Peripheral drivers invoke this function on initialization, drivers external
+// to this package which manage their own clocks should do the same.
+func RegisterClock(ccgr uint32, cg int) {
+	i := ccgrIndex(ccgr)
+
+	if i < 0 || cg < 0 || cg > 30 {
+		return
+	}
+
+	clocksMutex.Lock()
+	clocksInUse[i] |= 0b11 << cg
+	clocksMutex.Unlock()
+}
+
+// SetClock sets the mode (CLOCK_OFF, CLOCK_ON_RUN, CLOCK_ON) of the argument
+// clock gate, gates which are not off are registered as in use (see
+// RegisterClock()).
+//
+// Peripherals with a gated clock must not be accessed, as any register access
+// stalls the bus.
+func SetClock(gate ClockGate, mode uint32) (err error) {
+	i := ccgrIndex(gate.CCGR)
+
+	if i < 0 || gate.CG < 0 || gate.CG > 30 || gate.CG%2 != 0 {
+		return errors.New("invalid clock gate")
+	}
+
+	switch mode {
+	case CLOCK_OFF, CLOCK_ON_RUN, CLOCK_ON:
+	default:
+		return errors.New("invalid clock gate mode")
+	}
+
+	clocksMutex.Lock()
+	defer clocksMutex.Unlock()
+
+	if mode == CLOCK_OFF {
+		clocksInUse[i] &^= 0b11 << gate.CG
+	} else {
+		clocksInUse[i] |= 0b11 << gate.CG
+	}
+
+	reg.SetN(gate.CCGR, gate.CG, 0b11, mode)
+
+	return
+}
+
+// EnableClock turns on, during all modes except STOP, the argument clock gate
+// and registers it as in use (see RegisterClock()). Peripheral drivers invoke
+// this function on initialization, to declare their clock dependency.
+func EnableClock(gate ClockGate) {
+	SetClock(gate, CLOCK_ON)
+}
+
+// DisableClock turns off the argument clock gate and unregisters it as in use
+// (see RegisterClock()).
+func DisableClock(gate ClockGate) {
+	SetClock(gate, CLOCK_OFF)
+}
+
+// GateUnusedClocks turns off the clocks of peripherals, supported by drivers
+// in tamago, which have not been registered as in use (see RegisterClock())
+// by the initialization of their driver. It is meant to be optionally called
+// by board packages, or applications, after all required peripherals have
+// been initialized to reduce power consumption.
+//
+// Peripherals with a gated clock must not be accessed, as any register access
+// stalls the bus, until their driver is initialized again.
+//
+// Only i.MX 6UltraLite and i.MX 6ULL clock gate assignments are supported.
+func GateUnusedClocks() (err error) {
+	switch Family {
+	case IMX6UL, IMX6ULL:
+	default:
+		return errors.New("unsupported")
+	}
+
+	clocksMutex.Lock()
+	defer clocksMutex.Unlock()
+
+	gate := func(g ClockGate) {
+		if clocksInUse[ccgrIndex(g.CCGR)]&(0b11<<g.CG) == 0 {
+			reg.SetN(g.CCGR, g.CG, 0b11, CLOCK_OFF)
+		}
+	}
+
+	for _, g := range uartClockGate {
+		gate(g)
+	}
+
+	for _, g := range driverClockGates {
+		gate(g)
+	}
+
+	return
+}
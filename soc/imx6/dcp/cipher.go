@@ -30,7 +30,7 @@ func (pkt *WorkPacket) SetCipherDefaults() {
 	pkt.Control1 |= CIPHER_MODE_CBC << DCP_CTRL1_CIPHER_MODE
 }
 
-func cipher(buf []byte, index int, iv []byte, enc bool) (err error) {
+func cipher(buf []byte, index int, iv []byte, mode uint32, enc bool) (err error) {
 	if len(buf)%aes.BlockSize != 0 {
 		return errors.New("invalid input size")
 	}
@@ -39,13 +39,18 @@ func cipher(buf []byte, index int, iv []byte, enc bool) (err error) {
 		return errors.New("key index must be between 0 and 3")
 	}
 
-	if len(iv) != aes.BlockSize {
+	if mode == CIPHER_MODE_CBC && len(iv) != aes.BlockSize {
 		return errors.New("invalid IV size")
 	}
 
 	pkt := &WorkPacket{}
 	pkt.SetCipherDefaults()
 
+	if mode != CIPHER_MODE_CBC {
+		bits.Clear(&pkt.Control0, DCP_CTRL0_CIPHER_INIT)
+		bits.SetN(&pkt.Control1, DCP_CTRL1_CIPHER_MODE, 0xf, mode)
+	}
+
 	if enc {
 		pkt.Control0 |= 1 << DCP_CTRL0_CIPHER_ENCRYPT
 	}
@@ -60,8 +65,10 @@ func cipher(buf []byte, index int, iv []byte, enc bool) (err error) {
 
 	pkt.DestinationBufferAddress = pkt.SourceBufferAddress
 
-	pkt.PayloadPointer = dma.Alloc(iv, 4)
-	defer dma.Free(pkt.PayloadPointer)
+	if mode == CIPHER_MODE_CBC {
+		pkt.PayloadPointer = dma.Alloc(iv, 4)
+		defer dma.Free(pkt.PayloadPointer)
+	}
 
 	ptr := dma.Alloc(pkt.Bytes(), 4)
 	defer dma.Free(ptr)
@@ -80,13 +87,31 @@ func cipher(buf []byte, index int, iv []byte, enc bool) (err error) {
 // Encrypt performs in-place buffer encryption using AES-128-CBC, the key can
 // be selected with the index argument from one previously set with SetKey().
 func Encrypt(buf []byte, index int, iv []byte) (err error) {
-	return cipher(buf, index, iv, true)
+	return cipher(buf, index, iv, CIPHER_MODE_CBC, true)
 }
 
 // Decrypt performs in-place buffer decryption using AES-128-CBC, the key can
 // be selected with the index argument from one previously set with SetKey().
 func Decrypt(buf []byte, index int, iv []byte) (err error) {
-	return cipher(buf, index, iv, false)
+	return cipher(buf, index, iv, CIPHER_MODE_CBC, false)
+}
+
+// EncryptECB performs in-place buffer encryption using AES-128-ECB, the key
+// can be selected with the index argument from one previously set with
+// SetKey().
+//
+// As identical plaintext blocks result in identical ciphertext blocks, this
+// mode is only meant for single block operations, such as key wrapping or the
+// implementation of other modes in software.
+func EncryptECB(buf []byte, index int) (err error) {
+	return cipher(buf, index, nil, CIPHER_MODE_ECB, true)
+}
+
+// DecryptECB performs in-place buffer decryption using AES-128-ECB, the key
+// can be selected with the index argument from one previously set with
+// SetKey().
+func DecryptECB(buf []byte, index int) (err error) {
+	return cipher(buf, index, nil, CIPHER_MODE_ECB, false)
 }
 
 // CipherChain performs chained in-place buffer encryption/decryption using
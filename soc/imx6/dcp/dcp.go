@@ -17,12 +17,14 @@ package dcp
 
 import (
 	"bytes"
+	"crypto/aes"
 	"encoding/binary"
 	"fmt"
 	"sync"
 
 	"github.com/f-secure-foundry/tamago/bits"
 	"github.com/f-secure-foundry/tamago/internal/reg"
+	"github.com/f-secure-foundry/tamago/soc/imx6"
 )
 
 // DCP registers
@@ -89,6 +91,7 @@ const (
 	KEY_SELECT_UNIQUE_KEY = 0xfe
 
 	DCP_CTRL1_CIPHER_MODE = 4
+	CIPHER_MODE_ECB       = 0x00
 	CIPHER_MODE_CBC       = 0x01
 
 	DCP_CTRL1_CIPHER_SELECT = 0
@@ -133,6 +136,18 @@ func Init() {
 
 	// enable channel 0
 	reg.Write(DCP_CHANNELCTRL, DCP_CHANNEL_0)
+
+	// accelerate image integrity verification
+	imx6.ImageHash = sum256Chunked
+
+	imx6.RegisterBenchmark("DCP AES-128-CBC", benchmark)
+}
+
+// benchmark encrypts the argument buffer with the device unique key, for
+// throughput measurement (see imx6.Benchmark()).
+func benchmark(buf []byte) error {
+	iv := make([]byte, aes.BlockSize)
+	return cipherUniqueKey(buf, iv, true)
 }
 
 func cmd(ptr uint32, count int) (err error) {
@@ -0,0 +1,120 @@
+// NXP Data Co-Processor (DCP) driver
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package dcp
+
+import (
+	"errors"
+)
+
+const (
+	ipad = 0x36
+	opad = 0x5c
+)
+
+type hmac struct {
+	inner Hash
+	opad  []byte
+	sum   []byte
+}
+
+// NewHMAC256 returns a new Hash computing HMAC-SHA256 (RFC2104) with the
+// argument key, using the DCP hardware SHA256 engine.
+//
+// The same restrictions of New256() apply, as only one digest instance (either
+// HMAC or not) can be kept at any given time, if this condition is not met an
+// error is returned.
+//
+// The instance terminates when Sum() is invoked, after which the digest state
+// can no longer be changed.
+func NewHMAC256(key []byte) (Hash, error) {
+	if len(key) > blockSize {
+		sum, err := Sum256(key)
+
+		if err != nil {
+			return nil, err
+		}
+
+		key = sum[:]
+	}
+
+	inner, err := New256()
+
+	if err != nil {
+		return nil, err
+	}
+
+	ipadKey := make([]byte, blockSize)
+	opadKey := make([]byte, blockSize)
+
+	copy(ipadKey, key)
+	copy(opadKey, key)
+
+	for i := 0; i < blockSize; i++ {
+		ipadKey[i] ^= ipad
+		opadKey[i] ^= opad
+	}
+
+	if _, err = inner.Write(ipadKey); err != nil {
+		inner.Sum(nil)
+		return nil, err
+	}
+
+	h := &hmac{
+		inner: inner,
+		opad:  opadKey,
+	}
+
+	return h, nil
+}
+
+// Write adds more data to the running HMAC. It returns an error if Sum has
+// been already invoked or in case of hardware errors.
+//
+// There must be sufficient DMA memory allocated to hold the data, otherwise
+// the function will panic.
+func (h *hmac) Write(p []byte) (n int, err error) {
+	if len(h.sum) != 0 {
+		return 0, errors.New("digest instance can no longer be used")
+	}
+
+	return h.inner.Write(p)
+}
+
+// Sum appends the current HMAC to in and returns the resulting slice. Its
+// invocation terminates the digest instance, for this reason Write will return
+// errors after Sum is invoked.
+func (h *hmac) Sum(in []byte) (sum []byte, err error) {
+	if len(h.sum) != 0 {
+		return append(in, h.sum...), nil
+	}
+
+	// terminating the inner digest releases the DCP channel, allowing the
+	// outer hash to be computed in a single operation
+	innerSum, err := h.inner.Sum(nil)
+
+	if err != nil {
+		return
+	}
+
+	outerSum, err := Sum256(append(h.opad, innerSum...))
+
+	if err != nil {
+		return
+	}
+
+	h.sum = outerSum[:]
+
+	return append(in, h.sum...), nil
+}
+
+// BlockSize returns the hash's underlying block size.
+func (h *hmac) BlockSize() int {
+	return blockSize
+}
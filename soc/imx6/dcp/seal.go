@@ -0,0 +1,158 @@
+// NXP Data Co-Processor (DCP) driver
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package dcp
+
+import (
+	"crypto/aes"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+
+	"github.com/f-secure-foundry/tamago/dma"
+)
+
+const tagSize = 32
+
+// diversifier for the derivation of the sealed blob authentication key
+var sealMACDiversifier = []byte("tamago-dcp-seal-hmac")
+
+func cipherUniqueKey(buf []byte, iv []byte, enc bool) (err error) {
+	pkt := &WorkPacket{}
+	pkt.SetCipherDefaults()
+
+	if enc {
+		pkt.Control0 |= 1 << DCP_CTRL0_CIPHER_ENCRYPT
+	}
+
+	// Use device-specific hardware key.
+	pkt.Control0 |= 1 << DCP_CTRL0_OTP_KEY
+	pkt.Control1 |= KEY_SELECT_UNIQUE_KEY << DCP_CTRL1_KEY_SELECT
+
+	pkt.BufferSize = uint32(len(buf))
+
+	pkt.SourceBufferAddress = dma.Alloc(buf, aes.BlockSize)
+	defer dma.Free(pkt.SourceBufferAddress)
+
+	pkt.DestinationBufferAddress = pkt.SourceBufferAddress
+
+	pkt.PayloadPointer = dma.Alloc(iv, 4)
+	defer dma.Free(pkt.PayloadPointer)
+
+	ptr := dma.Alloc(pkt.Bytes(), 4)
+	defer dma.Free(ptr)
+
+	err = cmd(ptr, 1)
+
+	if err != nil {
+		return
+	}
+
+	dma.Read(pkt.DestinationBufferAddress, 0, buf)
+
+	return
+}
+
+func sealTag(data []byte) (tag []byte, err error) {
+	iv := make([]byte, aes.BlockSize)
+	key, err := DeriveKey(sealMACDiversifier, iv, -1)
+
+	if err != nil {
+		return
+	}
+
+	mac, err := NewHMAC256(key)
+
+	if err != nil {
+		return
+	}
+
+	if _, err = mac.Write(data); err != nil {
+		mac.Sum(nil)
+		return
+	}
+
+	return mac.Sum(nil)
+}
+
+// Seal encrypts and authenticates the argument plaintext with keys bound to
+// the device, so that the returned blob can be stored on untrusted media and
+// only unsealed (see Unseal()) on the same SoC.
+//
+// The plaintext is padded (PKCS#7) and AES-128-CBC encrypted, with a random
+// IV, using the internal OTPMK key (when SNVS is enabled), the key is never
+// exposed to software. The IV and ciphertext are authenticated with
+// HMAC-SHA256 using a key derived from the OTPMK (see DeriveKey()), the
+// resulting blob format is IV || ciphertext || tag.
+//
+// *WARNING*: when SNVS is not enabled a default non-unique test vector is used
+// and therefore sealing is *unsafe*, see imx6.SNVS().
+//
+// The HMAC computation requires the DCP digest instance, therefore an error
+// is returned if another one is in use (see New256()).
+func Seal(plaintext []byte) (blob []byte, err error) {
+	iv := make([]byte, aes.BlockSize)
+
+	if _, err = rand.Read(iv); err != nil {
+		return
+	}
+
+	buf := pad(append([]byte{}, plaintext...), true)
+
+	// the IV is cloned as the payload buffer is updated by the DCP
+	if err = cipherUniqueKey(buf, append([]byte{}, iv...), true); err != nil {
+		return
+	}
+
+	blob = append(iv, buf...)
+	tag, err := sealTag(blob)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append(blob, tag...), nil
+}
+
+// Unseal authenticates and decrypts a blob previously returned by Seal() on
+// the same device.
+//
+// An error is returned if the blob has been tampered with or if it has been
+// sealed on a different device (or with SNVS in a different state).
+func Unseal(blob []byte) (plaintext []byte, err error) {
+	if len(blob) < 2*aes.BlockSize+tagSize || (len(blob)-tagSize)%aes.BlockSize != 0 {
+		return nil, errors.New("invalid blob size")
+	}
+
+	data := blob[0 : len(blob)-tagSize]
+	tag, err := sealTag(data)
+
+	if err != nil {
+		return
+	}
+
+	if subtle.ConstantTimeCompare(tag, blob[len(data):]) != 1 {
+		return nil, errors.New("invalid blob tag")
+	}
+
+	iv := append([]byte{}, data[0:aes.BlockSize]...)
+	buf := append([]byte{}, data[aes.BlockSize:]...)
+
+	if err = cipherUniqueKey(buf, iv, false); err != nil {
+		return
+	}
+
+	padLen := int(buf[len(buf)-1])
+
+	if padLen == 0 || padLen > aes.BlockSize {
+		return nil, errors.New("invalid padding")
+	}
+
+	return buf[0 : len(buf)-padLen], nil
+}
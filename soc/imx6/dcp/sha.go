@@ -19,6 +19,9 @@ import (
 
 const blockSize = 64
 
+// chunk size for hashing of buffers larger than the available DMA memory
+const sumChunkSize = 16 * 1024
+
 // A single DCP channel is used for all operations, this entails that only one
 // digest state can be kept at any given time.
 var sem = semaphore.NewWeighted(1)
@@ -173,3 +176,39 @@ func Sum256(data []byte) (sum [32]byte, err error) {
 
 	return
 }
+
+// sum256Chunked returns the SHA256 checksum of the data, processed in chunks
+// to support buffers larger than the available DMA memory.
+func sum256Chunked(data []byte) (sum [32]byte, err error) {
+	d, err := New256()
+
+	if err != nil {
+		return
+	}
+
+	for len(data) > 0 {
+		n := len(data)
+
+		if n > sumChunkSize {
+			n = sumChunkSize
+		}
+
+		if _, err = d.Write(data[:n]); err != nil {
+			// terminate the digest instance to release the channel
+			d.Sum(nil)
+			return
+		}
+
+		data = data[n:]
+	}
+
+	s, err := d.Sum(nil)
+
+	if err != nil {
+		return
+	}
+
+	copy(sum[:], s)
+
+	return
+}
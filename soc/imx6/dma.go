@@ -10,6 +10,7 @@
 package imx6
 
 import (
+	"github.com/f-secure-foundry/tamago/arm"
 	"github.com/f-secure-foundry/tamago/dma"
 )
 
@@ -17,6 +18,28 @@ const iramStart uint32 = 0x00900000
 const iramSize = 0x20000
 
 func init() {
+	dma.InitHandler(initDMARegion)
+
 	// use internal OCRAM (iRAM) by default
 	dma.Init(iramStart, iramSize)
 }
+
+// DMA regions placed in external RAM must match the MMU section size.
+const dmaRegionAlignment = 1 << 20
+
+// initDMARegion sets DMA regions as non-cacheable, as USB, uSDHC and DCP
+// transfers are performed without cache maintenance, regions placed in
+// external RAM are otherwise cached (see initMMU()). This applies to every
+// region initialized with dma.Region.Init(), including those not used for DMA
+// (e.g. a RAM disk, see ramdisk.NewRegion()).
+//
+// Memory attributes are set on 1MB sections, to avoid silently disabling
+// caching on adjacent memory a panic occurs if a region placed in external RAM
+// is not aligned to, and sized in multiples of, 1MB.
+func initDMARegion(start uint32, size int) {
+	if start >= ddrBase() && (start%dmaRegionAlignment != 0 || size%dmaRegionAlignment != 0) {
+		panic("DMA region in external RAM must be 1MB aligned and sized")
+	}
+
+	ARM.ConfigureMMU(start, start+uint32(size), arm.MEMORY_NORMAL_UNCACHED)
+}
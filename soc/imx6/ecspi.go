@@ -0,0 +1,458 @@
+// NXP Enhanced Configurable SPI (ECSPI) driver
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/f-secure-foundry/tamago/dma"
+	"github.com/f-secure-foundry/tamago/internal/reg"
+)
+
+// ECSPI registers
+// (ECSPI Memory Map/Register Definition, IMX6ULLRM).
+const (
+	ECSPI1_BASE = 0x02008000
+	ECSPI2_BASE = 0x0200c000
+	ECSPI3_BASE = 0x02010000
+	ECSPI4_BASE = 0x02014000
+
+	ECSPIx_RXDATA = 0x0000
+	ECSPIx_TXDATA = 0x0004
+
+	ECSPIx_CONREG         = 0x0008
+	CONREG_BURST_LENGTH   = 20
+	CONREG_CHANNEL_SELECT = 18
+	CONREG_PRE_DIVIDER    = 12
+	CONREG_POST_DIVIDER   = 8
+	CONREG_CHANNEL_MODE   = 4
+	CONREG_SMC            = 3
+	CONREG_XCH            = 2
+	CONREG_EN             = 0
+	ECSPIx_CONFIGREG      = 0x000c
+	CONFIGREG_SCLK_CTL    = 20
+	CONFIGREG_DATA_CTL    = 16
+	CONFIGREG_SS_POL      = 12
+	CONFIGREG_SS_CTL      = 8
+	CONFIGREG_SCLK_POL    = 4
+	CONFIGREG_SCLK_PHA    = 0
+	ECSPIx_INTREG         = 0x0010
+	ECSPIx_DMAREG         = 0x0014
+	DMAREG_RXTDEN         = 31
+	DMAREG_RX_DMA_LENGTH  = 24
+	DMAREG_RXDEN          = 23
+	DMAREG_RX_THRESHOLD   = 16
+	DMAREG_TEDEN          = 7
+	DMAREG_TX_THRESHOLD   = 0
+	ECSPIx_STATREG        = 0x0018
+	STATREG_TC            = 7
+	STATREG_RO            = 6
+	STATREG_RR            = 3
+	STATREG_TF            = 2
+	STATREG_TE            = 0
+	ECSPIx_PERIODREG      = 0x001c
+	ECSPIx_TESTREG        = 0x0020
+
+	CCM_CSCDR2            = 0x020c4038
+	CSCDR2_ECSPI_CLK_PODF = 19
+	CSCDR2_ECSPI_CLK_SEL  = 18
+
+	CCM_CCGR1 = 0x020c406c
+	CCGR1_CG3 = 6
+	CCGR1_CG2 = 4
+	CCGR1_CG1 = 2
+	CCGR1_CG0 = 0
+
+	// ECSPI FIFO depth (32-bit words)
+	ECSPI_FIFO_DEPTH = 64
+)
+
+const (
+	// PLL3_60M frequency
+	ecspiPLL3Freq = 60000000
+
+	// maximum transfer size for each SDMA transfer, bound by the DMA
+	// region size
+	ecspiDMAChunk = 16384
+)
+
+// ECSPI represents an SPI port instance.
+type ECSPI struct {
+	sync.Mutex
+
+	// controller index
+	n int
+	// clock gate
+	cg int
+	// SDMA request events
+	rxEvent int
+	txEvent int
+
+	// control registers
+	rxdata    uint32
+	txdata    uint32
+	conreg    uint32
+	configreg uint32
+	dmareg    uint32
+	statreg   uint32
+
+	// SCLK frequency (Hz), the closest lower frequency achievable with
+	// the root clock dividers is used
+	Speed uint32
+	// SPI mode (0-3), CPOL and CPHA are bit 1 and bit 0 respectively
+	Mode int
+	// native chip select channel (0-3)
+	Channel int
+	// Slave mode (see Serve()), when set the controller responds to an
+	// external master clock and Speed is ignored.
+	Slave bool
+
+	// Optional GPIO used as chip select (active low), when set the line
+	// is asserted for the entire transaction.
+	//
+	// The native chip select is negated whenever the transmit FIFO
+	// empties, transactions requiring continuous chip select assertion
+	// (e.g. SPI-NOR reads) must therefore use a GPIO.
+	CS *GPIO
+
+	// Transactions of at least DMAThreshold bytes use SDMA transfers, when
+	// the SDMA controller is initialized (see SDMA.Init()), shorter ones
+	// use programmed I/O. A zero value disables SDMA transfers.
+	//
+	// SDMA transfers are not supported on the i.MX6Q, as its transmit FIFO
+	// is affected by ERR009165, which causes data duplication with the
+	// SDMA ROM scripts.
+	DMAThreshold int
+
+	// Timeout for ECSPI operations
+	Timeout time.Duration
+}
+
+// ECSPI1 instance
+var ECSPI1 = &ECSPI{n: 1}
+
+// ECSPI2 instance
+var ECSPI2 = &ECSPI{n: 2}
+
+// ECSPI3 instance
+var ECSPI3 = &ECSPI{n: 3}
+
+// ECSPI4 instance
+var ECSPI4 = &ECSPI{n: 4}
+
+// Init initializes and enables the ECSPI controller instance, in master mode
+// with 8-bit words, according to the Speed, Mode and Channel fields, or in
+// slave mode according to the Slave field.
+func (hw *ECSPI) Init() (err error) {
+	var base uint32
+
+	hw.Lock()
+	defer hw.Unlock()
+
+	switch hw.n {
+	case 1:
+		base = ECSPI1_BASE
+		hw.cg = CCGR1_CG0
+	case 2:
+		base = ECSPI2_BASE
+		hw.cg = CCGR1_CG1
+	case 3:
+		base = ECSPI3_BASE
+		hw.cg = CCGR1_CG2
+	case 4:
+		base = ECSPI4_BASE
+		hw.cg = CCGR1_CG3
+	default:
+		panic("invalid ECSPI controller instance")
+	}
+
+	RegisterRegion("ECSPI", base, AIPS_SLOT_SIZE)
+
+	if hw.Mode < 0 || hw.Mode > 3 || hw.Channel < 0 || hw.Channel > 3 {
+		return errors.New("invalid mode or channel")
+	}
+
+	// SDMA request events (SDMA Event Mapping, IMX6ULLRM)
+	hw.rxEvent = 2*hw.n + 1
+	hw.txEvent = 2*hw.n + 2
+
+	hw.rxdata = base + ECSPIx_RXDATA
+	hw.txdata = base + ECSPIx_TXDATA
+	hw.conreg = base + ECSPIx_CONREG
+	hw.configreg = base + ECSPIx_CONFIGREG
+	hw.dmareg = base + ECSPIx_DMAREG
+	hw.statreg = base + ECSPIx_STATREG
+
+	if hw.Timeout == 0 {
+		hw.Timeout = 100 * time.Millisecond
+	}
+
+	if hw.CS != nil && !hw.Slave {
+		hw.CS.Out()
+		hw.CS.High()
+	}
+
+	return hw.enable()
+}
+
+// getRootClock returns the ECSPI_CLK_ROOT frequency
+// (Clock Tree, IMX6ULLRM).
+func (hw *ECSPI) getRootClock() (freq uint32) {
+	freq = ecspiPLL3Freq
+
+	if Family != IMX6Q && reg.Get(CCM_CSCDR2, CSCDR2_ECSPI_CLK_SEL, 1) == 1 {
+		freq = OSC_FREQ
+	}
+
+	podf := reg.Get(CCM_CSCDR2, CSCDR2_ECSPI_CLK_PODF, 0x3f)
+
+	return freq / (podf + 1)
+}
+
+// dividers returns the pre and post divider values for the requested SCLK
+// frequency, where SCLK = root / ((pre + 1) * 2^post).
+func (hw *ECSPI) dividers() (pre uint32, post uint32, err error) {
+	if hw.Speed == 0 {
+		return 0, 0, errors.New("invalid speed")
+	}
+
+	root := hw.getRootClock()
+	div := (root + hw.Speed - 1) / hw.Speed
+
+	for div > 16 {
+		div = (div + 1) / 2
+		post++
+	}
+
+	if post > 15 {
+		return 0, 0, errors.New("unsupported speed")
+	}
+
+	if div > 0 {
+		pre = div - 1
+	}
+
+	return
+}
+
+// Configuring the ECSPI for master or slave mode
+// (ECSPI Initialization, IMX6ULLRM).
+func (hw *ECSPI) enable() (err error) {
+	var pre, post uint32
+
+	if !hw.Slave {
+		if pre, post, err = hw.dividers(); err != nil {
+			return
+		}
+	}
+
+	EnableClock(ClockGate{CCM_CCGR1, hw.cg})
+
+	// reset the controller
+	reg.Write(hw.conreg, 0)
+
+	// The control register must be written first, as the remaining
+	// registers can be accessed only with the controller enabled.
+	conreg := uint32(7) << CONREG_BURST_LENGTH
+	conreg |= uint32(hw.Channel) << CONREG_CHANNEL_SELECT
+	conreg |= 1 << CONREG_EN
+
+	if !hw.Slave {
+		conreg |= pre << CONREG_PRE_DIVIDER
+		conreg |= post << CONREG_POST_DIVIDER
+		conreg |= 1 << (CONREG_CHANNEL_MODE + hw.Channel)
+		conreg |= 1 << CONREG_SMC
+	}
+
+	reg.Write(hw.conreg, conreg)
+
+	var configreg uint32
+
+	if hw.Mode&0b10 != 0 {
+		configreg |= 1 << (CONFIGREG_SCLK_CTL + hw.Channel)
+		configreg |= 1 << (CONFIGREG_SCLK_POL + hw.Channel)
+	}
+
+	if hw.Mode&0b01 != 0 {
+		configreg |= 1 << (CONFIGREG_SCLK_PHA + hw.Channel)
+	}
+
+	reg.Write(hw.configreg, configreg)
+	reg.Write(hw.dmareg, 0)
+
+	return
+}
+
+// Txn performs a full duplex transaction, the argument buffer is transmitted
+// and overwritten with the data received from the slave device.
+//
+// Transactions of at least DMAThreshold bytes are performed with SDMA
+// transfers, to avoid the MMIO overhead of programmed I/O on bulk data (e.g.
+// firmware image reads from SPI-NOR flash).
+//
+// An error wrapping ErrTimeout is returned if the reception of any character,
+// or the SDMA transfer, does not complete in time (see Timeout, SDMATimeout).
+func (hw *ECSPI) Txn(buf []byte) (err error) {
+	if len(buf) == 0 {
+		return
+	}
+
+	hw.Lock()
+	defer hw.Unlock()
+
+	if hw.conreg == 0 {
+		return errors.New("ECSPI controller is not initialized")
+	}
+
+	if hw.Slave {
+		return errors.New("ECSPI controller is in slave mode")
+	}
+
+	if hw.CS != nil {
+		hw.CS.Low()
+		defer hw.CS.High()
+	}
+
+	if hw.DMAThreshold > 0 && len(buf) >= hw.DMAThreshold && SDMA.ccb != 0 && Family != IMX6Q {
+		return hw.txnDMA(buf)
+	}
+
+	return hw.txn(buf)
+}
+
+// txn performs a transaction with programmed I/O, filling the FIFOs for up to
+// their depth at a time.
+func (hw *ECSPI) txn(buf []byte) (err error) {
+	for off := 0; off < len(buf); off += ECSPI_FIFO_DEPTH {
+		end := off + ECSPI_FIFO_DEPTH
+
+		if end > len(buf) {
+			end = len(buf)
+		}
+
+		for i := off; i < end; i++ {
+			reg.Write(hw.txdata, uint32(buf[i]))
+		}
+
+		for i := off; i < end; i++ {
+			if !reg.WaitFor(hw.Timeout, hw.statreg, STATREG_RR, 1, 1) {
+				return fmt.Errorf("ECSPI receive %w", ErrTimeout)
+			}
+
+			buf[i] = byte(reg.Read(hw.rxdata))
+		}
+	}
+
+	return
+}
+
+// wml returns the largest SDMA watermark level, up to half the FIFO depth,
+// which divides the transfer size, so that the last receive request is always
+// triggered.
+func wml(n int) (level int) {
+	level = ECSPI_FIFO_DEPTH / 2
+
+	for n%level != 0 {
+		level /= 2
+	}
+
+	return
+}
+
+// txnDMA performs a transaction with SDMA transfers, serviced by the
+// mcu_2_app and app_2_mcu ROM scripts on ECSPI DMA request events.
+func (hw *ECSPI) txnDMA(buf []byte) (err error) {
+	chunk := ecspiDMAChunk
+
+	if len(buf) < chunk {
+		chunk = len(buf)
+	}
+
+	addr, dmaBuf := dma.Reserve(chunk, 4)
+	defer dma.Release(addr)
+
+	for off := 0; off < len(buf); off += chunk {
+		n := len(buf) - off
+
+		if n > chunk {
+			n = chunk
+		}
+
+		copy(dmaBuf, buf[off:off+n])
+
+		if err = hw.transfer(addr, n); err != nil {
+			return
+		}
+
+		copy(buf[off:off+n], dmaBuf[:n])
+	}
+
+	return
+}
+
+// transfer performs a single SDMA transaction, in place, on a DMA buffer.
+func (hw *ECSPI) transfer(addr uint32, n int) (err error) {
+	level := wml(n)
+
+	// 8-bit transfers
+	tx := &sdmaTransfer{
+		script: SDMA_MCU_2_APP,
+		event:  hw.txEvent,
+		fifo:   hw.txdata,
+		wml:    level,
+		cmd:    1,
+		addr:   addr,
+		size:   n,
+	}
+
+	rx := &sdmaTransfer{
+		script: SDMA_APP_2_MCU,
+		event:  hw.rxEvent,
+		fifo:   hw.rxdata,
+		wml:    level,
+		cmd:    1,
+		addr:   addr,
+		size:   n,
+	}
+
+	ARM.CacheFlushData()
+	defer ARM.CacheFlushData()
+
+	defer reg.Write(hw.dmareg, 0)
+
+	err = SDMA.transfer(func() {
+		// A transmit request is issued when the TXFIFO holds no more
+		// than the watermark level, a receive request when the RXFIFO
+		// holds more than the watermark level minus one.
+		dmareg := uint32(level) << DMAREG_TX_THRESHOLD
+		dmareg |= uint32(level-1) << DMAREG_RX_THRESHOLD
+		dmareg |= uint32(level) << DMAREG_RX_DMA_LENGTH
+		dmareg |= 1 << DMAREG_TEDEN
+		dmareg |= 1 << DMAREG_RXDEN
+		dmareg |= 1 << DMAREG_RXTDEN
+
+		reg.Write(hw.dmareg, dmareg)
+	}, tx, rx)
+
+	if err != nil {
+		return
+	}
+
+	if reg.Get(hw.statreg, STATREG_RO, 1) == 1 {
+		// clear overflow status
+		reg.Write(hw.statreg, 1<<STATREG_RO)
+		return errors.New("ECSPI receive overflow")
+	}
+
+	return
+}
@@ -0,0 +1,148 @@
+// NXP Enhanced Configurable SPI (ECSPI) driver
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"errors"
+	"runtime"
+
+	"github.com/f-secure-foundry/tamago/internal/reg"
+)
+
+// Respond loads the transmit FIFO with the data to be shifted out, in slave
+// mode, on the next transaction clocked by the master, replacing any data not
+// yet transmitted.
+//
+// As the master drives the clock, the response must be loaded before the
+// transaction starts and it is therefore limited to the FIFO depth (64
+// bytes). The data shifted out once the response is exhausted is undefined.
+func (hw *ECSPI) Respond(tx []byte) (err error) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	if hw.conreg == 0 || !hw.Slave {
+		return errors.New("ECSPI controller is not initialized in slave mode")
+	}
+
+	return hw.respond(tx)
+}
+
+func (hw *ECSPI) respond(tx []byte) (err error) {
+	if len(tx) > ECSPI_FIFO_DEPTH {
+		return errors.New("response exceeds FIFO depth")
+	}
+
+	// Data left over by a shorter transaction can only be flushed by
+	// resetting the controller.
+	if reg.Get(hw.statreg, STATREG_TE, 1) == 0 {
+		if err = hw.enable(); err != nil {
+			return
+		}
+	}
+
+	for _, b := range tx {
+		reg.Write(hw.txdata, uint32(b))
+	}
+
+	return
+}
+
+// Serve responds, in slave mode, to the transactions clocked by an external
+// master until the handler returns an error, which is then returned.
+//
+// The handler is invoked at the end of each transaction (chip select
+// negation) with the data received in the argument buffer, data which exceeds
+// the buffer size is discarded. The handler response is loaded in the
+// transmit FIFO (see Respond()) and shifted out on the following transaction,
+// therefore the response to each request is read by the master with a
+// subsequent transaction.
+//
+// This allows the SoC to act as an SPI attached coprocessor, the master must
+// leave enough time between transactions for the handler to complete, and
+// any initial response must be loaded with Respond() before Serve() is
+// invoked. The controller cannot be used for other operations until Serve()
+// returns.
+func (hw *ECSPI) Serve(buf []byte, handler func(rx []byte) (tx []byte, err error)) (err error) {
+	if handler == nil {
+		return errors.New("invalid handler")
+	}
+
+	hw.Lock()
+	defer hw.Unlock()
+
+	if hw.conreg == 0 || !hw.Slave {
+		return errors.New("ECSPI controller is not initialized in slave mode")
+	}
+
+	for {
+		n := hw.receive(buf)
+
+		if reg.Get(hw.statreg, STATREG_RO, 1) == 1 {
+			// clear overflow status
+			reg.Write(hw.statreg, 1<<STATREG_RO)
+			return errors.New("ECSPI receive overflow")
+		}
+
+		if n > len(buf) {
+			n = len(buf)
+		}
+
+		var tx []byte
+
+		if tx, err = handler(buf[:n]); err != nil {
+			return
+		}
+
+		if err = hw.respond(tx); err != nil {
+			return
+		}
+	}
+}
+
+// receive waits for a master transaction, storing received data until the
+// transfer completes, it returns the number of bytes clocked by the master.
+func (hw *ECSPI) receive(buf []byte) (n int) {
+	for {
+		stat := reg.Read(hw.statreg)
+
+		if (stat>>STATREG_RR)&1 == 1 {
+			b := byte(reg.Read(hw.rxdata))
+
+			if n < len(buf) {
+				buf[n] = b
+			}
+
+			n++
+			continue
+		}
+
+		if (stat>>STATREG_TC)&1 == 1 {
+			// clear transfer completed status
+			reg.Write(hw.statreg, 1<<STATREG_TC)
+
+			// drain any data received before chip select negation
+			for reg.Get(hw.statreg, STATREG_RR, 1) == 1 {
+				b := byte(reg.Read(hw.rxdata))
+
+				if n < len(buf) {
+					buf[n] = b
+				}
+
+				n++
+			}
+
+			if n > 0 {
+				return
+			}
+		}
+
+		runtime.Gosched()
+	}
+}
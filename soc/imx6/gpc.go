@@ -0,0 +1,113 @@
+// NXP i.MX6 General Power Controller (GPC) support
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"errors"
+
+	"github.com/f-secure-foundry/tamago/internal/reg"
+)
+
+// GPC registers
+// (GPC Memory Map/Register Definition, IMX6ULLRM).
+const (
+	GPC_BASE = 0x020dc000
+
+	GPC_CNTR = GPC_BASE
+	GPC_PGR  = GPC_BASE + 0x04
+	GPC_IMR1 = GPC_BASE + 0x08
+	GPC_ISR1 = GPC_BASE + 0x18
+
+	// number of interrupt mask registers (IMR1-IMR4)
+	GPC_IMR_COUNT = 4
+)
+
+// IOMUXC registers used for low power mode entry
+const (
+	IOMUXC_GPR_GPR1 = 0x020e4004
+	GPR1_GINT       = 12
+)
+
+// gpcMask masks (or unmasks) the argument shared peripheral interrupt ID as
+// wake-up source.
+func gpcMask(id int, mask bool) bool {
+	if id < 32 || id >= 32+32*GPC_IMR_COUNT {
+		return false
+	}
+
+	n := id - 32
+	imr := GPC_IMR1 + uint32(4*(n/32))
+
+	if mask {
+		reg.Set(imr, n%32)
+	} else {
+		reg.Clear(imr, n%32)
+	}
+
+	return true
+}
+
+func gpcSave() (imr [GPC_IMR_COUNT]uint32) {
+	for i := range imr {
+		imr[i] = reg.Read(GPC_IMR1 + uint32(4*i))
+	}
+
+	return
+}
+
+func gpcRestore(imr [GPC_IMR_COUNT]uint32) {
+	for i := range imr {
+		reg.Write(GPC_IMR1+uint32(4*i), imr[i])
+	}
+}
+
+// initGPC masks all interrupts as wake-up sources, those required by the
+// application can be enabled with EnableWakeSource().
+func initGPC() {
+	for i := 0; i < GPC_IMR_COUNT; i++ {
+		reg.Write(GPC_IMR1+uint32(4*i), 0xffffffff)
+	}
+}
+
+// EnableWakeSource unmasks the argument shared peripheral interrupt ID as
+// wake-up source in the GPC interrupt mask registers, to resume the SoC from
+// low power mode (see Suspend()).
+//
+// The peripheral must be configured by its driver to assert the interrupt
+// while in low power mode (e.g. see UART.WakeSource()).
+func EnableWakeSource(irq int) (err error) {
+	if !gpcMask(irq, false) {
+		return errors.New("invalid interrupt ID")
+	}
+
+	return
+}
+
+// DisableWakeSource masks the argument shared peripheral interrupt ID as
+// wake-up source in the GPC interrupt mask registers.
+func DisableWakeSource(irq int) (err error) {
+	if !gpcMask(irq, true) {
+		return errors.New("invalid interrupt ID")
+	}
+
+	return
+}
+
+// WakeSourceEnabled returns whether the argument shared peripheral interrupt
+// ID is unmasked as wake-up source.
+func WakeSourceEnabled(irq int) bool {
+	if irq < 32 || irq >= 32+32*GPC_IMR_COUNT {
+		return false
+	}
+
+	n := irq - 32
+
+	return reg.Get(GPC_IMR1+uint32(4*(n/32)), n%32, 1) == 0
+}
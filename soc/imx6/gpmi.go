@@ -0,0 +1,635 @@
+// NXP General Purpose Media Interface (GPMI) NAND flash driver
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/f-secure-foundry/tamago/dma"
+	"github.com/f-secure-foundry/tamago/internal/reg"
+)
+
+// GPMI registers
+// (GPMI Memory Map/Register Definition, IMX6ULLRM).
+const (
+	// i.MX 6UltraLite, i.MX 6ULL
+	GPMI_BASE = 0x01806000
+	// i.MX 6Quad
+	GPMI_BASE_IMX6Q = 0x00112000
+
+	GPMI_CTRL0        = 0x000
+	CTRL0_SFTRST      = 31
+	CTRL0_CLKGATE     = 30
+	CTRL0_RUN         = 29
+	CTRL0_CMD_MODE    = 24
+	CTRL0_WORD_LENGTH = 23
+	CTRL0_CS          = 20
+	CTRL0_ADDRESS     = 17
+	CTRL0_ADDR_INCR   = 16
+	CTRL0_XFER_COUNT  = 0
+
+	GPMI_ECCCTRL        = 0x020
+	ECCCTRL_ECC_CMD     = 13
+	ECCCTRL_ENABLE_ECC  = 12
+	ECCCTRL_BUFFER_MASK = 0
+
+	GPMI_ECCCOUNT  = 0x030
+	GPMI_PAYLOAD   = 0x040
+	GPMI_AUXILIARY = 0x050
+
+	GPMI_CTRL1                = 0x060
+	CTRL1_DECOUPLE_CS         = 24
+	CTRL1_BCH_MODE            = 18
+	CTRL1_DEV_RESET           = 3
+	CTRL1_ATA_IRQRDY_POLARITY = 2
+	CTRL1_GPMI_MODE           = 0
+
+	GPMI_TIMING0         = 0x070
+	TIMING0_ADDR_SETUP   = 16
+	TIMING0_DATA_HOLD    = 8
+	TIMING0_DATA_SETUP   = 0
+	GPMI_TIMING1         = 0x080
+	TIMING1_BUSY_TIMEOUT = 16
+
+	GPMI_DATA = 0x0a0
+
+	GPMI_STAT        = 0x0b0
+	STAT_READY_BUSY  = 24
+	STAT_FIFO_EMPTY  = 5
+	STAT_FIFO_FULL   = 4
+	STAT_INVALID_BUF = 2
+
+	CCM_CCGR4  = 0x020c4078
+	CCGR4_CG15 = 30
+	CCGR4_CG14 = 28
+	CCGR4_CG13 = 26
+	CCGR4_CG12 = 24
+)
+
+// BCH registers
+// (BCH Memory Map/Register Definition, IMX6ULLRM).
+const (
+	// i.MX 6UltraLite, i.MX 6ULL
+	BCH_BASE = 0x01808000
+	// i.MX 6Quad
+	BCH_BASE_IMX6Q = 0x00114000
+
+	BCH_CTRL             = 0x000
+	BCH_CTRL_SFTRST      = 31
+	BCH_CTRL_CLKGATE     = 30
+	BCH_CTRL_COMPLETE_EN = 8
+	BCH_CTRL_COMPLETE    = 0
+
+	BCH_LAYOUTSELECT = 0x070
+
+	BCH_FLASH0LAYOUT0 = 0x080
+	LAYOUT0_NBLOCKS   = 24
+	LAYOUT0_META_SIZE = 16
+	LAYOUT0_ECC0      = 11
+	LAYOUT0_GF        = 10
+	LAYOUT0_DATA0     = 0
+
+	BCH_FLASH0LAYOUT1 = 0x090
+	LAYOUT1_PAGE_SIZE = 16
+	LAYOUT1_ECCN      = 11
+	LAYOUT1_GF        = 10
+	LAYOUT1_DATAN     = 0
+)
+
+// GPMI command modes and addresses
+const (
+	cmdModeWrite        = 0b00
+	cmdModeRead         = 0b01
+	cmdModeWaitForReady = 0b11
+
+	addrData = 0b000
+	addrCLE  = 0b001
+	addrALE  = 0b010
+
+	eccDecode     = 0b00
+	eccEncode     = 0b01
+	eccBufferPage = 0x1ff
+)
+
+// NAND flash commands
+const (
+	NAND_READ0        = 0x00
+	NAND_READSTART    = 0x30
+	NAND_READID       = 0x90
+	NAND_RESET        = 0xff
+	NAND_SEQIN        = 0x80
+	NAND_PAGEPROG     = 0x10
+	NAND_ERASE1       = 0x60
+	NAND_ERASE2       = 0xd0
+	NAND_STATUS       = 0x70
+	NAND_STATUS_FAIL  = 0
+	NAND_STATUS_READY = 6
+)
+
+// BCH ECC parameters
+const (
+	// ECC chunk size
+	bchChunkSize = 512
+	// Galois field order
+	bchGF = 13
+	// metadata size
+	bchMetaSize = 10
+	// maximum ECC strength
+	bchMaxStrength = 40
+
+	// chunk status values
+	bchStatusUncorrectable = 0xfe
+	bchStatusErased        = 0xff
+)
+
+type gpmi struct {
+	sync.Mutex
+
+	// controller base addresses
+	gpmi uint32
+	bch  uint32
+
+	// number of ECC chunks for each page
+	chunks int
+	// ECC strength (bits)
+	strength int
+	// auxiliary buffer size and status bytes offset
+	auxSize   int
+	statusOff int
+
+	// DMA buffers for BCH payload and auxiliary data
+	payload uint32
+	aux     uint32
+	auxBuf  []byte
+
+	// Chip select
+	CS int
+	// Page data size (bytes)
+	PageSize int
+	// Page spare area size (bytes)
+	OOBSize int
+	// Page address cycles
+	RowCycles int
+
+	// Timeout for NAND operations
+	Timeout time.Duration
+}
+
+// GPMI represents the General Purpose Media Interface instance, which drives
+// raw NAND flash devices with hardware BCH error correction.
+//
+// The default configuration (see Init()) matches 2048+64 bytes pages, on chip
+// select 0, with 3 row address cycles.
+var GPMI = &gpmi{}
+
+// resetBlock performs the soft reset sequence shared by GPMI and BCH
+// controllers.
+func resetBlock(ctrl uint32) (err error) {
+	reg.ClearBits(ctrl, 1<<CTRL0_SFTRST)
+	reg.ClearBits(ctrl, 1<<CTRL0_CLKGATE)
+
+	reg.SetBits(ctrl, 1<<CTRL0_SFTRST)
+
+	// wait for the clock to be gated, signaling reset completion
+	if !reg.WaitFor(10*time.Millisecond, ctrl, CTRL0_CLKGATE, 1, 1) {
+		return errors.New("soft reset timeout")
+	}
+
+	reg.ClearBits(ctrl, 1<<CTRL0_SFTRST)
+	reg.ClearBits(ctrl, 1<<CTRL0_CLKGATE)
+
+	if !reg.WaitFor(10*time.Millisecond, ctrl, CTRL0_CLKGATE, 1, 0) {
+		return errors.New("clock ungate timeout")
+	}
+
+	return
+}
+
+// Init initializes the GPMI and BCH controllers for NAND flash operation and
+// resets the flash device. The PageSize, OOBSize, CS and RowCycles fields
+// are set to their defaults when not initialized.
+//
+// The NAND pads must be configured for the GPMI function by the board
+// package. Timings are conservatively set to ONFI mode 0, for GPMI clock
+// frequencies up to 100 MHz.
+func (hw *gpmi) Init() (err error) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	switch Family {
+	case IMX6UL, IMX6ULL:
+		hw.gpmi = GPMI_BASE
+		hw.bch = BCH_BASE
+	case IMX6Q:
+		hw.gpmi = GPMI_BASE_IMX6Q
+		hw.bch = BCH_BASE_IMX6Q
+	default:
+		return errors.New("unsupported processor family")
+	}
+
+	RegisterRegion("GPMI", hw.gpmi, 0x2000)
+	RegisterRegion("BCH", hw.bch, 0x2000)
+
+	if hw.PageSize == 0 {
+		hw.PageSize = 2048
+		hw.OOBSize = 64
+	}
+
+	if hw.RowCycles == 0 {
+		hw.RowCycles = 3
+	}
+
+	if hw.Timeout == 0 {
+		hw.Timeout = 100 * time.Millisecond
+	}
+
+	if hw.PageSize%bchChunkSize != 0 || hw.CS < 0 || hw.CS > 3 {
+		return errors.New("invalid configuration")
+	}
+
+	hw.chunks = hw.PageSize / bchChunkSize
+	hw.strength = ((hw.OOBSize - bchMetaSize) * 8) / (bchGF * hw.chunks)
+	hw.strength &^= 1
+
+	if hw.strength > bchMaxStrength {
+		hw.strength = bchMaxStrength
+	}
+
+	if hw.strength <= 0 {
+		return errors.New("spare area too small for ECC")
+	}
+
+	// metadata and chunk status bytes, both word aligned
+	hw.statusOff = (bchMetaSize + 3) &^ 3
+	hw.auxSize = hw.statusOff + (hw.chunks+3)&^3
+
+	for _, cg := range []int{CCGR4_CG12, CCGR4_CG13, CCGR4_CG14, CCGR4_CG15} {
+		EnableClock(ClockGate{CCM_CCGR4, cg})
+	}
+
+	if err = resetBlock(hw.gpmi + GPMI_CTRL0); err != nil {
+		return
+	}
+
+	if err = resetBlock(hw.bch + BCH_CTRL); err != nil {
+		return
+	}
+
+	// NAND mode, BCH ECC, ready signal active high, device reset
+	// disabled
+	reg.Write(hw.gpmi+GPMI_CTRL1, 1<<CTRL1_DECOUPLE_CS|1<<CTRL1_BCH_MODE|1<<CTRL1_DEV_RESET|1<<CTRL1_ATA_IRQRDY_POLARITY)
+
+	reg.Write(hw.gpmi+GPMI_TIMING0, 6<<TIMING0_ADDR_SETUP|4<<TIMING0_DATA_HOLD|6<<TIMING0_DATA_SETUP)
+	reg.Write(hw.gpmi+GPMI_TIMING1, 0xffff<<TIMING1_BUSY_TIMEOUT)
+
+	hw.setLayout()
+
+	if hw.payload != 0 {
+		dma.Release(hw.payload)
+		dma.Release(hw.aux)
+	}
+
+	hw.payload, _ = dma.Reserve(hw.PageSize, 4)
+	hw.aux, hw.auxBuf = dma.Reserve(hw.auxSize, 4)
+
+	return hw.reset()
+}
+
+// setLayout configures the BCH flash layout 0, used for all chip selects, where
+// the first chunk carries the metadata.
+func (hw *gpmi) setLayout() {
+	ecc := uint32(hw.strength / 2)
+
+	layout0 := uint32(hw.chunks-1) << LAYOUT0_NBLOCKS
+	layout0 |= bchMetaSize << LAYOUT0_META_SIZE
+	layout0 |= ecc << LAYOUT0_ECC0
+	// data size in words
+	layout0 |= (bchChunkSize >> 2) << LAYOUT0_DATA0
+
+	layout1 := uint32(hw.PageSize+hw.OOBSize) << LAYOUT1_PAGE_SIZE
+	layout1 |= ecc << LAYOUT1_ECCN
+	layout1 |= (bchChunkSize >> 2) << LAYOUT1_DATAN
+
+	reg.Write(hw.bch+BCH_LAYOUTSELECT, 0)
+	reg.Write(hw.bch+BCH_FLASH0LAYOUT0, layout0)
+	reg.Write(hw.bch+BCH_FLASH0LAYOUT1, layout1)
+}
+
+// run starts a GPMI transfer, data is exchanged with programmed I/O through
+// the GPMI_DATA register unless the BCH engine is enabled.
+func (hw *gpmi) run(mode uint32, addr uint32, count int) {
+	ctrl0 := mode << CTRL0_CMD_MODE
+	// 8-bit bus
+	ctrl0 |= 1 << CTRL0_WORD_LENGTH
+	ctrl0 |= uint32(hw.CS) << CTRL0_CS
+	ctrl0 |= addr << CTRL0_ADDRESS
+	ctrl0 |= uint32(count) << CTRL0_XFER_COUNT
+
+	if addr == addrALE {
+		ctrl0 |= 1 << CTRL0_ADDR_INCR
+	}
+
+	reg.Write(hw.gpmi+GPMI_CTRL0, ctrl0|1<<CTRL0_RUN)
+}
+
+// wait waits for completion of the running GPMI transfer.
+func (hw *gpmi) wait() (err error) {
+	if !reg.WaitFor(hw.Timeout, hw.gpmi+GPMI_CTRL0, CTRL0_RUN, 1, 0) {
+		reg.ClearBits(hw.gpmi+GPMI_CTRL0, 1<<CTRL0_RUN)
+		return errors.New("GPMI transfer timeout")
+	}
+
+	return
+}
+
+// write transmits bytes, packed in 32-bit words, to the data FIFO.
+func (hw *gpmi) write(mode uint32, addr uint32, buf []byte) (err error) {
+	hw.run(mode, addr, len(buf))
+
+	for i := 0; i < len(buf); i += 4 {
+		var word uint32
+
+		for j := 0; j < 4 && i+j < len(buf); j++ {
+			word |= uint32(buf[i+j]) << (8 * j)
+		}
+
+		if !reg.WaitFor(hw.Timeout, hw.gpmi+GPMI_STAT, STAT_FIFO_FULL, 1, 0) {
+			return errors.New("GPMI FIFO timeout")
+		}
+
+		reg.Write(hw.gpmi+GPMI_DATA, word)
+	}
+
+	return hw.wait()
+}
+
+// read receives bytes, packed in 32-bit words, from the data FIFO.
+func (hw *gpmi) read(buf []byte) (err error) {
+	hw.run(cmdModeRead, addrData, len(buf))
+
+	for i := 0; i < len(buf); i += 4 {
+		if !reg.WaitFor(hw.Timeout, hw.gpmi+GPMI_STAT, STAT_FIFO_EMPTY, 1, 0) {
+			return errors.New("GPMI FIFO timeout")
+		}
+
+		word := reg.Read(hw.gpmi + GPMI_DATA)
+
+		for j := 0; j < 4 && i+j < len(buf); j++ {
+			buf[i+j] = byte(word >> (8 * j))
+		}
+	}
+
+	return hw.wait()
+}
+
+// command issues a NAND command, followed by optional address cycles.
+func (hw *gpmi) command(cmd byte, addr []byte) (err error) {
+	if err = hw.write(cmdModeWrite, addrCLE, []byte{cmd}); err != nil {
+		return
+	}
+
+	if len(addr) > 0 {
+		err = hw.write(cmdModeWrite, addrALE, addr)
+	}
+
+	return
+}
+
+// waitReady waits for the NAND device ready/busy signal to be released.
+func (hw *gpmi) waitReady() (err error) {
+	hw.run(cmdModeWaitForReady, addrData, 0)
+
+	if err = hw.wait(); err != nil {
+		return
+	}
+
+	if !reg.WaitFor(hw.Timeout, hw.gpmi+GPMI_STAT, STAT_READY_BUSY+hw.CS, 1, 1) {
+		return errors.New("NAND device busy timeout")
+	}
+
+	return
+}
+
+// status returns the NAND device status, an error is returned if the last
+// program or erase operation failed.
+func (hw *gpmi) status() (err error) {
+	buf := make([]byte, 1)
+
+	if err = hw.command(NAND_STATUS, nil); err != nil {
+		return
+	}
+
+	if err = hw.read(buf); err != nil {
+		return
+	}
+
+	if buf[0]&(1<<NAND_STATUS_FAIL) != 0 {
+		return errors.New("NAND operation failed")
+	}
+
+	return
+}
+
+// reset resets the NAND device.
+func (hw *gpmi) reset() (err error) {
+	if err = hw.command(NAND_RESET, nil); err != nil {
+		return
+	}
+
+	return hw.waitReady()
+}
+
+// address returns the address cycles for the argument page and column.
+func (hw *gpmi) address(page int, column int, withColumn bool) (addr []byte) {
+	if withColumn {
+		addr = append(addr, byte(column), byte(column>>8))
+	}
+
+	for i := 0; i < hw.RowCycles; i++ {
+		addr = append(addr, byte(page>>(8*i)))
+	}
+
+	return
+}
+
+// ReadID returns the NAND device identification bytes.
+func (hw *gpmi) ReadID() (id []byte, err error) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	if err = hw.command(NAND_READID, []byte{0x00}); err != nil {
+		return
+	}
+
+	id = make([]byte, 5)
+	err = hw.read(id)
+
+	return
+}
+
+// ecc runs a full page transfer through the BCH engine, the data FIFO is
+// bypassed as the BCH engine accesses the payload and auxiliary buffers
+// directly.
+func (hw *gpmi) ecc(cmd uint32, mode uint32) (err error) {
+	n := hw.PageSize + hw.OOBSize
+
+	ARM.CacheFlushData()
+	defer ARM.CacheFlushData()
+
+	reg.ClearBits(hw.bch+BCH_CTRL, 1<<BCH_CTRL_COMPLETE)
+
+	reg.Write(hw.gpmi+GPMI_PAYLOAD, hw.payload)
+	reg.Write(hw.gpmi+GPMI_AUXILIARY, hw.aux)
+	reg.Write(hw.gpmi+GPMI_ECCCOUNT, uint32(n))
+	reg.Write(hw.gpmi+GPMI_ECCCTRL, cmd<<ECCCTRL_ECC_CMD|1<<ECCCTRL_ENABLE_ECC|eccBufferPage<<ECCCTRL_BUFFER_MASK)
+	defer reg.Write(hw.gpmi+GPMI_ECCCTRL, 0)
+
+	hw.run(mode, addrData, n)
+
+	if err = hw.wait(); err != nil {
+		return
+	}
+
+	if !reg.WaitFor(hw.Timeout, hw.bch+BCH_CTRL, BCH_CTRL_COMPLETE, 1, 1) {
+		return errors.New("BCH timeout")
+	}
+
+	reg.ClearBits(hw.bch+BCH_CTRL, 1<<BCH_CTRL_COMPLETE)
+
+	return
+}
+
+// ReadPage reads a page, with BCH error correction, to the argument buffer
+// which must be PageSize bytes long. The number of bit errors corrected is
+// returned, an error is returned if any chunk is uncorrectable.
+//
+// Erased pages are returned as all 0xff bytes without errors, bad block
+// management is left to the caller (e.g. through the bad block marker in the
+// first metadata byte).
+func (hw *gpmi) ReadPage(page int, buf []byte) (corrected int, err error) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	if hw.payload == 0 {
+		return 0, errors.New("GPMI controller is not initialized")
+	}
+
+	if len(buf) != hw.PageSize {
+		return 0, errors.New("invalid buffer size")
+	}
+
+	if err = hw.command(NAND_READ0, hw.address(page, 0, true)); err != nil {
+		return
+	}
+
+	if err = hw.command(NAND_READSTART, nil); err != nil {
+		return
+	}
+
+	if err = hw.waitReady(); err != nil {
+		return
+	}
+
+	if err = hw.ecc(eccDecode, cmdModeRead); err != nil {
+		return
+	}
+
+	erased := 0
+
+	for i := 0; i < hw.chunks; i++ {
+		switch s := hw.auxBuf[hw.statusOff+i]; s {
+		case bchStatusUncorrectable:
+			return corrected, fmt.Errorf("uncorrectable ECC error, page %d chunk %d", page, i)
+		case bchStatusErased:
+			erased++
+		default:
+			corrected += int(s)
+		}
+	}
+
+	if erased == hw.chunks {
+		for i := range buf {
+			buf[i] = 0xff
+		}
+
+		return
+	}
+
+	dma.Read(hw.payload, 0, buf)
+
+	return
+}
+
+// WritePage programs a page, with BCH error correction, from the argument
+// buffer which must be PageSize bytes long. The metadata bytes are left
+// erased (0xff), preserving the bad block marker.
+func (hw *gpmi) WritePage(page int, buf []byte) (err error) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	if hw.payload == 0 {
+		return errors.New("GPMI controller is not initialized")
+	}
+
+	if len(buf) != hw.PageSize {
+		return errors.New("invalid buffer size")
+	}
+
+	dma.Write(hw.payload, buf, 0)
+
+	for i := range hw.auxBuf {
+		hw.auxBuf[i] = 0xff
+	}
+
+	if err = hw.command(NAND_SEQIN, hw.address(page, 0, true)); err != nil {
+		return
+	}
+
+	if err = hw.ecc(eccEncode, cmdModeWrite); err != nil {
+		return
+	}
+
+	if err = hw.command(NAND_PAGEPROG, nil); err != nil {
+		return
+	}
+
+	if err = hw.waitReady(); err != nil {
+		return
+	}
+
+	return hw.status()
+}
+
+// EraseBlock erases the block which contains the argument page.
+func (hw *gpmi) EraseBlock(page int) (err error) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	if hw.payload == 0 {
+		return errors.New("GPMI controller is not initialized")
+	}
+
+	if err = hw.command(NAND_ERASE1, hw.address(page, 0, false)); err != nil {
+		return
+	}
+
+	if err = hw.command(NAND_ERASE2, nil); err != nil {
+		return
+	}
+
+	if err = hw.waitReady(); err != nil {
+		return
+	}
+
+	return hw.status()
+}
@@ -0,0 +1,127 @@
+// NXP i.MX6 memory dump
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+// DDR base addresses
+const (
+	DDR_BASE_IMX6Q  = 0x10000000
+	DDR_BASE_IMX6UL = 0x80000000
+)
+
+// hexdump line size
+const hexDumpWidth = 16
+
+type memoryRegion struct {
+	start uint32
+	end   uint32
+}
+
+// memoryRegions returns the memory regions which can be safely read, excluding
+// peripheral address space as register reads can have side effects (e.g.
+// FIFO draining).
+func memoryRegions() (regions []memoryRegion) {
+	regions = append(regions, memoryRegion{iramStart, iramStart + iramSize})
+
+	base := uint64(ddrBase())
+
+	if size := MMDC.Size(); size > 0 {
+		end := base + size
+
+		// the DDR address space ends at the top of the 4GB range
+		if end > 1<<32-1 {
+			end = 1<<32 - 1
+		}
+
+		regions = append(regions, memoryRegion{uint32(base), uint32(end)})
+	}
+
+	return
+}
+
+// HexDump writes a formatted hexadecimal and ASCII dump of the argument
+// physical memory range to w (e.g. the console), to aid inspection of memory
+// structures (e.g. DMA descriptors, framebuffers) while debugging.
+//
+// The range must be entirely contained within internal RAM, or external DDR
+// memory as configured in the MMDC, to avoid faulting on unmapped addresses,
+// otherwise an error is returned without reading any memory. Peripheral
+// registers are not accessible, as reads can have side effects.
+func HexDump(w io.Writer, addr uint32, length int) (err error) {
+	if length <= 0 {
+		return
+	}
+
+	end := uint64(addr) + uint64(length)
+	valid := false
+
+	for _, r := range memoryRegions() {
+		if addr >= r.start && end <= uint64(r.end) {
+			valid = true
+			break
+		}
+	}
+
+	if !valid {
+		return fmt.Errorf("invalid memory range %#x-%#x", addr, end)
+	}
+
+	// the range is accessed one line at a time, as it can exceed the
+	// largest array type
+	for off := 0; off < length; {
+		n := length - off
+
+		if n > hexDumpWidth {
+			n = hexDumpWidth
+		}
+
+		a := addr + uint32(off)
+		line := (*[hexDumpWidth]byte)(unsafe.Pointer(uintptr(a)))[:n:n]
+
+		if err = hexDumpLine(w, a, line); err != nil {
+			return
+		}
+
+		off += n
+	}
+
+	return
+}
+
+func hexDumpLine(w io.Writer, addr uint32, line []byte) (err error) {
+	var hex [3 * hexDumpWidth]byte
+	var ascii [hexDumpWidth]byte
+
+	const digits = "0123456789abcdef"
+
+	for i := range hex {
+		hex[i] = ' '
+	}
+
+	for i, c := range line {
+		hex[3*i] = digits[c>>4]
+		hex[3*i+1] = digits[c&0xf]
+
+		if c >= 0x20 && c < 0x7f {
+			ascii[i] = c
+		} else {
+			ascii[i] = '.'
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "%08x  %s |%s|\n", addr, hex[:], ascii[:len(line)])
+
+	return
+}
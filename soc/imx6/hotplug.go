@@ -0,0 +1,146 @@
+// NXP i.MX6 hot-pluggable device detection
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"sync"
+	"time"
+)
+
+// DevicePollInterval is the polling interval for hot-pluggable devices
+// registered with RegisterDevice().
+var DevicePollInterval = 250 * time.Millisecond
+
+// device event channels buffer size
+const deviceEventBuffer = 16
+
+// Device represents a hot-pluggable peripheral (e.g. usdhc.USDHC card
+// detection, usb.USB VBUS detection).
+type Device interface {
+	// Present returns whether the device is currently attached.
+	Present() bool
+}
+
+// DeviceEvent represents a device insertion or removal.
+type DeviceEvent struct {
+	// device name, as registered
+	Name string
+	// device presence after the event
+	Present bool
+}
+
+type watchedDevice struct {
+	name    string
+	dev     Device
+	present bool
+}
+
+var devices struct {
+	sync.Mutex
+
+	list     []*watchedDevice
+	watchers []chan DeviceEvent
+	running  bool
+}
+
+// RegisterDevice adds a device, under the argument name, to those polled for
+// insertion and removal events (see WatchDevices()), replacing any device
+// previously registered with the same name. The device is assumed initially
+// absent, therefore an insertion event is generated on the first poll for
+// devices already attached.
+//
+// Board packages, or applications, register devices for which a detection
+// method is available (e.g. a card detect GPIO on an SD slot), drivers only
+// implement the Device interface.
+func RegisterDevice(name string, dev Device) {
+	if dev == nil {
+		return
+	}
+
+	devices.Lock()
+	defer devices.Unlock()
+
+	for _, d := range devices.list {
+		if d.name == name {
+			d.dev = dev
+			d.present = false
+			return
+		}
+	}
+
+	devices.list = append(devices.list, &watchedDevice{
+		name: name,
+		dev:  dev,
+	})
+}
+
+// UnregisterDevice removes a device from those polled for insertion and
+// removal events.
+func UnregisterDevice(name string) {
+	devices.Lock()
+	defer devices.Unlock()
+
+	for i, d := range devices.list {
+		if d.name == name {
+			devices.list = append(devices.list[:i], devices.list[i+1:]...)
+			return
+		}
+	}
+}
+
+// WatchDevices returns a channel which receives insertion and removal events
+// for all registered devices (see RegisterDevice()), polled at
+// DevicePollInterval from a background goroutine, started on the first
+// invocation.
+//
+// Events are discarded, rather than blocking the poll, when the channel
+// buffer is full, receivers requiring the current state should therefore
+// invoke the Device Present() method after each event.
+func WatchDevices() <-chan DeviceEvent {
+	devices.Lock()
+	defer devices.Unlock()
+
+	c := make(chan DeviceEvent, deviceEventBuffer)
+	devices.watchers = append(devices.watchers, c)
+
+	if !devices.running {
+		devices.running = true
+		go pollDevices()
+	}
+
+	return c
+}
+
+func pollDevices() {
+	for {
+		devices.Lock()
+
+		for _, d := range devices.list {
+			present := d.dev.Present()
+
+			if present == d.present {
+				continue
+			}
+
+			d.present = present
+
+			for _, c := range devices.watchers {
+				select {
+				case c <- DeviceEvent{Name: d.name, Present: present}:
+				default:
+				}
+			}
+		}
+
+		devices.Unlock()
+
+		time.Sleep(DevicePollInterval)
+	}
+}
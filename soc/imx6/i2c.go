@@ -11,9 +11,11 @@ package imx6
 
 import (
 	"errors"
+	"fmt"
 	"sync"
 	"time"
 
+	"github.com/f-secure-foundry/tamago/internal/clock"
 	"github.com/f-secure-foundry/tamago/internal/reg"
 )
 
@@ -44,13 +46,26 @@ const (
 
 	I2Cx_I2SR = 0x000c
 	I2SR_IBB  = 5
+	I2SR_IAL  = 4
 	I2SR_IIF  = 1
 	I2SR_RXAK = 0
 
 	I2Cx_I2DR = 0x0010
 )
 
+// ErrArbitrationLost is returned, by I2C transactions, when the controller
+// loses bus arbitration to another master.
+var ErrArbitrationLost = errors.New("I2C arbitration lost")
+
 // I2C represents a I2C port instance.
+//
+// Each instance has its own lock, held for the entire duration of a Read() or
+// Write() transaction, so that transactions on different buses never block
+// each other while transactions on the same bus are serialized. The lock is
+// not reentrant, therefore a transaction must never be issued from code that
+// can preempt another transaction on the same bus (e.g. an interrupt handler
+// used on power management paths), the driver itself polls for completion and
+// does not use interrupts.
 type I2C struct {
 	sync.Mutex
 
@@ -68,18 +83,32 @@ type I2C struct {
 	i2sr uint32
 	i2dr uint32
 
-	// Timeout for I2C operations
+	// SCL frequency (Hz), the closest lower frequency achievable with the
+	// clock divider is used, a zero value selects the default (~85 kHz)
+	Speed uint32
+
+	// Timeout for each I2C bus operation (e.g. waiting for the bus to be
+	// free, byte transmission or reception), set to 100 ms by Init()
 	Timeout time.Duration
 }
 
+// default I2Cx_IFDR value, 66 MHz / 768 = 85 kbps
+const i2cDefaultIFDR = 0x16
+
 // I2C1 instance
 var I2C1 = &I2C{n: 1}
 
 // I2C2 instance
 var I2C2 = &I2C{n: 2}
 
-// Init initializes the I2C controller instance. At this time only master mode
-// is supported by this driver.
+// I2C3 instance (not available on all i.MX6UL/i.MX6ULL variants)
+var I2C3 = &I2C{n: 3}
+
+// I2C4 instance (not available on all i.MX6UL/i.MX6ULL variants)
+var I2C4 = &I2C{n: 4}
+
+// Init initializes the I2C controller instance, according to the Speed
+// field. At this time only master mode is supported by this driver.
 func (hw *I2C) Init() {
 	var base uint32
 
@@ -107,6 +136,8 @@ func (hw *I2C) Init() {
 		panic("invalid I2C controller instance")
 	}
 
+	RegisterRegion("I2C", base, AIPS_SLOT_SIZE)
+
 	hw.iadr = base + I2Cx_IADR
 	hw.ifdr = base + I2Cx_IFDR
 	hw.i2cr = base + I2Cx_I2CR
@@ -126,9 +157,7 @@ func (hw *I2C) getRootClock() uint32 {
 	if reg.Get(CCM_CSCMR1, CSCMR1_PERCLK_SEL, 1) == 1 {
 		freq = OSC_FREQ
 	} else {
-		// IPG_CLK_ROOT derived from AHB_CLK_ROOT which is 132 MHz
-		ipg_podf := reg.Get(CCM_CBCDR, CBCDR_IPG_PODF, 0b11)
-		freq = 132000000 / (ipg_podf + 1)
+		freq = IPGFreq()
 	}
 
 	podf := reg.Get(CCM_CSCMR1, CSCMR1_PERCLK_PODF, 0x3f)
@@ -138,16 +167,25 @@ func (hw *I2C) getRootClock() uint32 {
 
 // p1452, 31.5.1 Initialization sequence, IMX6ULLRM
 func (hw *I2C) enable() {
-	reg.SetN(hw.ccgr, hw.cg, 0b11, 0b11)
+	EnableClock(ClockGate{hw.ccgr, hw.cg})
 
 	// Set SCL frequency
-	// 66 MHz / 768 = 85 kbps
-	// TODO: allow Init() to set the baudrate.
-	reg.Write16(hw.ifdr, 0x16)
+	reg.Write16(hw.ifdr, hw.dividerCode())
 
 	reg.Set16(hw.i2cr, I2CR_IEN)
 }
 
+// dividerCode returns the I2Cx_IFDR value for the smallest clock divider
+// resulting in an SCL frequency not greater than Speed, the largest divider is
+// selected when none is sufficient.
+func (hw *I2C) dividerCode() uint16 {
+	if hw.Speed == 0 {
+		return i2cDefaultIFDR
+	}
+
+	return clock.I2CDivider(hw.getRootClock(), hw.Speed)
+}
+
 // Read reads a sequence of bytes from a slave device
 // (p167, 16.4.2 Programming the I2C controller for I2C Read, IMX6FG).
 //
@@ -158,6 +196,9 @@ func (hw *I2C) enable() {
 // ordinary I2C reads (`SLAVE W|ADDR|SLAVE R|DATA`), equal to 0 when not
 // sending a register address (`SLAVE W|SLAVE R|DATA`) and less than 0 only to
 // send a slave read (`SLAVE R|DATA`).
+//
+// An error wrapping ErrTimeout is returned if any bus operation exceeds
+// Timeout, ErrArbitrationLost if another master takes over the bus.
 func (hw *I2C) Read(slave uint8, addr uint32, alen int, size int) (buf []byte, err error) {
 	hw.Lock()
 	defer hw.Unlock()
@@ -198,6 +239,9 @@ func (hw *I2C) Read(slave uint8, addr uint32, alen int, size int) (buf []byte, e
 // The address length (`alen`) parameter should be set greater then 0 for
 // ordinary I2C writes (`SLAVE W|ADDR|DATA`), equal to 0 when not sending a
 // register address (`SLAVE W|DATA`), values less than 0 are not valid.
+//
+// An error wrapping ErrTimeout is returned if any bus operation exceeds
+// Timeout, ErrArbitrationLost if another master takes over the bus.
 func (hw *I2C) Write(buf []byte, slave uint8, addr uint32, alen int) (err error) {
 	if alen < 0 {
 		return errors.New("invalid address length")
@@ -263,7 +307,11 @@ func (hw *I2C) rx(buf []byte) (err error) {
 
 	for i := 0; i < size; i++ {
 		if !reg.WaitFor16(hw.Timeout, hw.i2sr, I2SR_IIF, 1, 1) {
-			return errors.New("timeout on byte reception")
+			return fmt.Errorf("%w on byte reception", ErrTimeout)
+		}
+
+		if err = hw.arbitration(); err != nil {
+			return
 		}
 
 		if i == size-2 {
@@ -285,7 +333,11 @@ func (hw *I2C) tx(buf []byte) (err error) {
 		reg.Write16(hw.i2dr, uint16(buf[i]))
 
 		if !reg.WaitFor16(hw.Timeout, hw.i2sr, I2SR_IIF, 1, 1) {
-			return errors.New("timeout on byte transmission")
+			return fmt.Errorf("%w on byte transmission", ErrTimeout)
+		}
+
+		if err = hw.arbitration(); err != nil {
+			return
 		}
 
 		if reg.Get16(hw.i2sr, I2SR_RXAK, 1) == 1 {
@@ -302,7 +354,7 @@ func (hw *I2C) start(repeat bool) (err error) {
 	if repeat == false {
 		// wait for bus to be free
 		if !reg.WaitFor16(hw.Timeout, hw.i2sr, I2SR_IBB, 1, 0) {
-			return errors.New("timeout waiting bus to be free")
+			return fmt.Errorf("%w waiting bus to be free", ErrTimeout)
 		}
 
 		// enable master mode, generates START signal
@@ -316,7 +368,11 @@ func (hw *I2C) start(repeat bool) (err error) {
 	// wait for bus to be busy
 	if !reg.WaitFor16(hw.Timeout, hw.i2sr, I2SR_IBB, 1, 1) {
 		reg.Clear16(hw.i2cr, pos)
-		return errors.New("timeout waiting bus to be busy")
+		return fmt.Errorf("%w waiting bus to be busy", ErrTimeout)
+	}
+
+	if err = hw.arbitration(); err != nil {
+		return
 	}
 
 	if repeat == false {
@@ -327,6 +383,20 @@ func (hw *I2C) start(repeat bool) (err error) {
 	return
 }
 
+// arbitration returns ErrArbitrationLost, clearing the condition, if the
+// controller lost bus arbitration, in which case it has already switched to
+// slave mode.
+func (hw *I2C) arbitration() (err error) {
+	if reg.Get16(hw.i2sr, I2SR_IAL, 1) == 0 {
+		return
+	}
+
+	reg.Clear16(hw.i2sr, I2SR_IAL)
+	reg.Clear16(hw.i2cr, I2CR_MSTA)
+
+	return ErrArbitrationLost
+}
+
 func (hw *I2C) stop() {
 	reg.Clear16(hw.i2cr, I2CR_MSTA)
 	reg.Clear16(hw.i2cr, I2CR_MTX)
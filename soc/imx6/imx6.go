@@ -28,6 +28,7 @@ package imx6
 
 import (
 	"encoding/binary"
+	"errors"
 	_ "unsafe"
 
 	"github.com/f-secure-foundry/tamago/arm"
@@ -40,6 +41,11 @@ const (
 	OCOTP_CFG0         = 0x021bc410
 	OCOTP_CFG1         = 0x021bc420
 	USB_ANALOG_DIGPROG = 0x020c8260
+
+	// i.MX 6ULZ parts report the i.MX 6ULL family, they are told apart by
+	// SRC_SBMR2 bit 6 (as in U-Boot get_cpu_rev()).
+	SRC_SBMR2     = 0x020d801c
+	SBMR2_IMX6ULZ = 6
 )
 
 // Reset registers
@@ -63,19 +69,46 @@ const (
 // Processor family
 var Family uint32
 
-// Flag for native or emulated processor
+// Flag for native or emulated processor (see Emulated())
 var Native bool
 
+// Flag for i.MX 6ULZ processors, within the i.MX 6ULL family (see Model())
+var ULZ bool
+
 // ARM processor instance
 var ARM = &arm.CPU{}
 
+// ErrTimeout is returned, possibly wrapped, by drivers whenever a peripheral
+// operation does not complete within its timeout (e.g. a bus held by a stuck
+// or missing device), so that a misbehaving peripheral cannot freeze the
+// system.
+var ErrTimeout = errors.New("timeout")
+
+// nanotime1 provides the runtime monotonic time, which the time package
+// (e.g. time.Now(), time.Sleep()) depends on. A descriptive panic is raised,
+// rather than a nil pointer dereference, when invoked before the timer is
+// initialized by Init().
+//
+// The time package can only be used once the runtime scheduler is running,
+// from package init() functions onwards, earlier initialization stages (e.g.
+// runtime.hwinit after Init()) must use Delay() instead.
+//
 //go:linkname nanotime1 runtime.nanotime1
 func nanotime1() int64 {
-	return int64(ARM.TimerFn() * ARM.TimerMultiplier)
+	if ARM.Timer == nil {
+		panic("time used before timer initialization (see imx6.Init())")
+	}
+
+	return ARM.Timer.Nanos()
 }
 
 // Init takes care of the lower level SoC initialization triggered early in
 // runtime setup.
+//
+// The MMU is enabled for all boards, with external RAM set as cacheable, DMA
+// regions (see dma.Region.Init()) are set as non-cacheable on 1MB sections
+// and must therefore be aligned to, and sized in multiples of, 1MB when
+// placed in external RAM.
 func Init() {
 	ARM.Init()
 	ARM.EnableVFP()
@@ -85,16 +118,15 @@ func Init() {
 
 	ARM.CacheEnable()
 
-	_, fam, revMajor, revMinor := SiliconVersion()
+	_, fam, _, _ := SiliconVersion()
 	Family = fam
-
-	if revMajor != 0 || revMinor != 0 {
-		Native = true
-	}
+	Native = !Emulated()
+	ULZ = Family == IMX6ULL && reg.Get(SRC_SBMR2, SBMR2_IMX6ULZ, 1) == 1
 
 	switch Family {
 	case IMX6Q:
 		ARM.InitGlobalTimers()
+		ARM.InitGIC(GIC_A9_DIST_BASE, GIC_A9_CPU_BASE)
 	case IMX6UL, IMX6ULL:
 		if !Native {
 			// use QEMU fixed CNTFRQ value (62.5MHz)
@@ -103,9 +135,16 @@ func Init() {
 			// U-Boot value for i.MX6 family (8.0MHz)
 			ARM.InitGenericTimers(SYS_CNT_BASE, 8000000)
 		}
+
+		ARM.InitGIC(GIC_A7_DIST_BASE, GIC_A7_CPU_BASE)
 	default:
 		ARM.InitGlobalTimers()
 	}
+
+	initMMU()
+	initGPC()
+
+	markBoot("SoC init")
 }
 
 // SiliconVersion returns the SoC silicon version information
@@ -120,10 +159,12 @@ func SiliconVersion() (sv, family, revMajor, revMinor uint32) {
 	return
 }
 
-// UniqueID returns the NXP SoC Device Unique 64-bit ID.
+// UniqueID returns the NXP SoC Device Unique 64-bit ID, read from its OTP
+// locations (see ReadOTP()).
 func UniqueID() (uid [8]byte) {
-	cfg0 := reg.Read(OCOTP_CFG0)
-	cfg1 := reg.Read(OCOTP_CFG1)
+	// OCOTP_CFG0 and OCOTP_CFG1
+	cfg0, _ := ReadOTP(0, 1)
+	cfg1, _ := ReadOTP(0, 2)
 
 	binary.LittleEndian.PutUint32(uid[0:4], cfg0)
 	binary.LittleEndian.PutUint32(uid[4:8], cfg1)
@@ -131,6 +172,17 @@ func UniqueID() (uid [8]byte) {
 	return
 }
 
+// Emulated returns whether the processor is emulated (e.g. QEMU).
+//
+// Emulation is detected by the absence of the Device Unique ID, which is
+// programmed in OCOTP fuses on every production part, while the OCOTP is not
+// modeled under QEMU and its shadow registers read as zero. The silicon
+// revision (see SiliconVersion()) is not used as its value is unreliable for
+// this purpose, as emulators might report a real revision.
+func Emulated() bool {
+	return reg.Read(OCOTP_CFG0)|reg.Read(OCOTP_CFG1) == 0
+}
+
 // Model returns the SoC model name.
 func Model() (model string) {
 	switch Family {
@@ -139,7 +191,11 @@ func Model() (model string) {
 	case IMX6UL:
 		model = "i.MX6UL"
 	case IMX6ULL:
-		model = "i.MX6ULL"
+		if ULZ {
+			model = "i.MX6ULZ"
+		} else {
+			model = "i.MX6ULL"
+		}
 	default:
 		model = "unknown"
 	}
@@ -147,9 +203,31 @@ func Model() (model string) {
 	return
 }
 
-// Reboot resets the watchdog timer causing the SoC to restart.
+// Reboot restarts the SoC with a cold reset (see ColdReboot()).
 func Reboot() {
+	ColdReboot()
+}
+
+// ColdReboot asserts a software reset through the watchdog timer, with warm
+// reset disabled (SCR_WARM_RESET_ENABLE cleared), causing the SoC to restart
+// with a cold reset, which resets all modules.
+//
+// The warm reset enable bit must be cleared, rather than left set, for a cold
+// reset to take place, as when set the SRC performs a warm reset instead
+// (SRC Control Register (SRC_SCR), IMX6ULLRM).
+func ColdReboot() {
 	reg.Clear(SRC_SCR, SCR_WARM_RESET_ENABLE)
 	// WDOG1_WCR is a 16-bit register, 32-bit access should be avoided
 	reg.Write16(WDOG1_WCR, 0)
 }
+
+// WarmReboot asserts a software reset through the watchdog timer, with warm
+// reset enabled (SCR_WARM_RESET_ENABLE set), causing the SoC to restart with
+// a warm reset, which preserves the contents of memory controller attached
+// external memory (e.g. for post-mortem logs, see InitPostMortemLog()). The
+// SRC falls back to a cold reset if warm reset conditions are not met.
+func WarmReboot() {
+	reg.Set(SRC_SCR, SCR_WARM_RESET_ENABLE)
+	// WDOG1_WCR is a 16-bit register, 32-bit access should be avoided
+	reg.Write16(WDOG1_WCR, 0)
+}
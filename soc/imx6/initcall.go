@@ -0,0 +1,112 @@
+// NXP i.MX6 initialization sequence
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"sync"
+)
+
+// Initialization priorities, lower values run first (see RegisterInit()).
+const (
+	INIT_CLOCK   = 100
+	INIT_CONSOLE = 200
+	INIT_DRIVER  = 300
+	INIT_BOARD   = 400
+)
+
+// maximum number of registered initialization functions
+const maxInitFuncs = 32
+
+type initFunc struct {
+	priority int
+	fn       func()
+	done     bool
+}
+
+// Registered initialization functions, kept sorted by priority (see
+// RegisterInit()).
+var initFuncs [maxInitFuncs]initFunc
+var initCount int
+var initMutex sync.Mutex
+
+// RegisterInit adds a function to the initialization sequence executed by
+// RunInit(), functions are executed by increasing priority (see INIT_*
+// constants) and, for equal priority, in registration order.
+//
+// Board packages register their initialization steps, and invoke RunInit(),
+// within runtime.hwinit which executes before heap initialization, for this
+// reason the argument must be a top-level function, rather than a closure or
+// method value, to avoid any allocation.
+//
+// A panic occurs if more than 32 functions are registered.
+func RegisterInit(priority int, fn func()) {
+	if fn == nil {
+		return
+	}
+
+	initMutex.Lock()
+	defer initMutex.Unlock()
+
+	if initCount == maxInitFuncs {
+		panic("too many init functions")
+	}
+
+	// insertion sort, placing fn after any entry with equal priority
+	i := initCount
+
+	for i > 0 && initFuncs[i-1].priority > priority {
+		initFuncs[i] = initFuncs[i-1]
+		i--
+	}
+
+	initFuncs[i] = initFunc{
+		priority: priority,
+		fn:       fn,
+	}
+
+	initCount++
+}
+
+// RunInit executes, in priority order, all registered initialization
+// functions (see RegisterInit()) which have not been executed by a previous
+// invocation.
+//
+// The function is meant to be invoked by board packages at the end of
+// runtime.hwinit, it can be invoked again afterwards (e.g. by an application
+// after package init() functions, which run after runtime.hwinit, registered
+// further steps).
+func RunInit() {
+	for {
+		initMutex.Lock()
+
+		var f *initFunc
+
+		for i := 0; i < initCount; i++ {
+			if !initFuncs[i].done {
+				f = &initFuncs[i]
+				break
+			}
+		}
+
+		if f == nil {
+			initMutex.Unlock()
+			markBoot("board init")
+			return
+		}
+
+		f.done = true
+		fn := f.fn
+
+		// allow registration from an initialization function
+		initMutex.Unlock()
+
+		fn()
+	}
+}
@@ -0,0 +1,77 @@
+// NXP i.MX6 image integrity verification
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"unsafe"
+)
+
+// defined in integrity.s
+func imageRange() (start uint32, end uint32)
+
+// ImageHash, when set, replaces the software SHA-256 implementation used by
+// VerifySelf(). It is set by the dcp package initialization to use the Data
+// Co-Processor hashing engine.
+var ImageHash func(buf []byte) (sum [32]byte, err error)
+
+// ImageRange returns the memory range, as start and end (exclusive)
+// addresses, occupied by the executable code and read-only data of the
+// running image, as defined by the linker.
+func ImageRange() (start uint32, end uint32) {
+	return imageRange()
+}
+
+// ImageSum returns the SHA-256 digest of the running image executable code
+// and read-only data (see ImageRange()).
+func ImageSum() (sum [32]byte, err error) {
+	start, end := ImageRange()
+
+	if end <= start {
+		return sum, errors.New("invalid image range")
+	}
+
+	size := end - start
+	buf := (*[1 << 30]byte)(unsafe.Pointer(uintptr(start)))[:size:size]
+
+	if ImageHash != nil {
+		return ImageHash(buf)
+	}
+
+	return sha256.Sum256(buf), nil
+}
+
+// VerifySelf computes the SHA-256 digest of the running image executable code
+// and read-only data (see ImageSum()) and compares it against the argument
+// expected value, returning an error on mismatch.
+//
+// The verification complements secure boot by detecting runtime corruption,
+// or tampering, of the code region, the expected value must therefore be
+// obtained from a trusted source (e.g. authenticated storage) as the image
+// cannot embed its own digest within the verified range.
+func VerifySelf(expected []byte) (err error) {
+	if len(expected) != sha256.Size {
+		return errors.New("invalid digest size")
+	}
+
+	sum, err := ImageSum()
+
+	if err != nil {
+		return
+	}
+
+	if subtle.ConstantTimeCompare(sum[:], expected) != 1 {
+		return errors.New("image digest mismatch")
+	}
+
+	return
+}
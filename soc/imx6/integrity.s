@@ -0,0 +1,18 @@
+// NXP i.MX6 image integrity verification
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// func imageRange() (start uint32, end uint32)
+TEXT ·imageRange(SB),$0-8
+	// linker defined symbols, the read-only data section immediately
+	// follows the text section
+	MOVW	$runtime·text(SB), R0
+	MOVW	R0, start+0(FP)
+	MOVW	$runtime·erodata(SB), R0
+	MOVW	R0, end+4(FP)
+	RET
@@ -0,0 +1,59 @@
+// NXP i.MX6 interrupt support
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+// ARM Generic Interrupt Controller (GIC) registers
+// (ARM Platform Memory Map, IMX6ULLRM).
+const (
+	GIC_BASE = 0x00a00000
+
+	// Cortex™-A7 MPCore® Technical Reference Manual r0p5
+	// Table 8-1 GIC register map
+	GIC_A7_DIST_BASE = GIC_BASE + 0x1000
+	GIC_A7_CPU_BASE  = GIC_BASE + 0x2000
+
+	// Cortex™-A9 MPCore® Technical Reference Manual
+	// Table 1-3 Cortex-A9 MPCore private memory region
+	GIC_A9_DIST_BASE = GIC_BASE + 0x1000
+	GIC_A9_CPU_BASE  = GIC_BASE + 0x0100
+)
+
+// Interrupt IDs, shared peripheral interrupts (SPI) are numbered starting at
+// 32 (Table 3-1, ARM Cortex A7 domain interrupt summary, IMX6ULLRM).
+const (
+	IOMUXC_IRQ = 32 + 0
+
+	SDMA_IRQ = 32 + 2
+
+	SNVS_IRQ = 32 + 19
+
+	TEMPMON_IRQ = 32 + 49
+
+	UART1_IRQ = 32 + 26
+	UART2_IRQ = 32 + 27
+	UART3_IRQ = 32 + 28
+	UART4_IRQ = 32 + 29
+	UART5_IRQ = 32 + 30
+	UART6_IRQ = 32 + 17
+	UART7_IRQ = 32 + 39
+	UART8_IRQ = 32 + 40
+
+	// GPIO interrupts are combined for signals 0-15 (LO) and 16-31 (HI)
+	GPIO1_LO_IRQ = 32 + 66
+	GPIO1_HI_IRQ = 32 + 67
+	GPIO2_LO_IRQ = 32 + 68
+	GPIO2_HI_IRQ = 32 + 69
+	GPIO3_LO_IRQ = 32 + 70
+	GPIO3_HI_IRQ = 32 + 71
+	GPIO4_LO_IRQ = 32 + 72
+	GPIO4_HI_IRQ = 32 + 73
+	GPIO5_LO_IRQ = 32 + 74
+	GPIO5_HI_IRQ = 32 + 75
+)
@@ -0,0 +1,219 @@
+// NXP i.MX6 Keypad Port (KPP) driver
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/f-secure-foundry/tamago/internal/reg"
+)
+
+// KPP registers
+// (KPP Memory Map/Register Definition, IMX6ULLRM).
+const (
+	KPP_BASE = 0x020b8000
+
+	KPP_KPCR = KPP_BASE + 0x00
+	KPCR_KCO = 8
+	KPCR_KRE = 0
+
+	KPP_KPSR  = KPP_BASE + 0x02
+	KPSR_KRIE = 9
+	KPSR_KDIE = 8
+	KPSR_KRSS = 3
+	KPSR_KDSC = 2
+	KPSR_KPKR = 1
+	KPSR_KPKD = 0
+
+	KPP_KDDR  = KPP_BASE + 0x04
+	KDDR_KCDD = 8
+	KDDR_KRDD = 0
+
+	KPP_KPDR = KPP_BASE + 0x06
+	KPDR_KCD = 8
+	KPDR_KRD = 0
+
+	KPP_MAX_ROWS = 8
+	KPP_MAX_COLS = 8
+)
+
+const (
+	// matrix scan interval
+	kppScanInterval = 10 * time.Millisecond
+	// consecutive matching scans for a stable key state
+	kppDebounceScans = 3
+	// column strobe settling time
+	kppSettleTime = 5 * time.Microsecond
+	// key event channel buffer size
+	kppEventBuffer = 16
+)
+
+// KeyEvent represents a key press or release on the keypad matrix.
+type KeyEvent struct {
+	// matrix row and column
+	Row int
+	Col int
+	// key state after the event
+	Pressed bool
+}
+
+type kpp struct {
+	sync.Mutex
+
+	rows int
+	cols int
+
+	// debounced key state, one bitmap of rows for each column
+	state [KPP_MAX_COLS]uint8
+	// last scan and number of consecutive matching scans
+	last    [KPP_MAX_COLS]uint8
+	matches int
+
+	events chan KeyEvent
+}
+
+// KPP represents the Keypad Port instance.
+var KPP = &kpp{}
+
+// Init initializes the Keypad Port for a matrix with the argument number of
+// rows (KPP_ROWx inputs) and columns (KPP_COLx open drain outputs), each up to
+// 8. The pads must be configured by the caller (e.g. board package), with
+// pull-ups enabled on row inputs.
+func (hw *kpp) Init(rows int, cols int) (err error) {
+	if rows <= 0 || rows > KPP_MAX_ROWS || cols <= 0 || cols > KPP_MAX_COLS {
+		return errors.New("invalid matrix size")
+	}
+
+	hw.Lock()
+	defer hw.Unlock()
+
+	RegisterRegion("KPP", KPP_BASE, AIPS_SLOT_SIZE)
+
+	hw.rows = rows
+	hw.cols = cols
+
+	rowMask := uint16(1<<rows - 1)
+	colMask := uint16(1<<cols - 1)
+
+	// enable rows, set columns as open drain
+	reg.Write16(KPP_KPCR, colMask<<KPCR_KCO|rowMask<<KPCR_KRE)
+	// drive columns low, to detect any key depression
+	reg.Write16(KPP_KPDR, 0)
+	// rows as inputs, columns as outputs
+	reg.Write16(KPP_KDDR, colMask<<KDDR_KCDD)
+
+	// clear status and synchronizers
+	reg.Write16(KPP_KPSR, 1<<KPSR_KPKD|1<<KPSR_KPKR|1<<KPSR_KDSC|1<<KPSR_KRSS)
+
+	for i := range hw.state {
+		hw.state[i] = 0
+		hw.last[i] = 0
+	}
+
+	return
+}
+
+// scan reads the keypad matrix by strobing each column low and reading the
+// rows, a pressed key pulls its row low.
+func (hw *kpp) scan() (keys [KPP_MAX_COLS]uint8) {
+	colMask := uint16(1<<hw.cols - 1)
+	rowMask := uint16(1<<hw.rows - 1)
+
+	for col := 0; col < hw.cols; col++ {
+		// release all columns, then strobe the scanned one
+		reg.Write16(KPP_KPDR, colMask<<KPDR_KCD)
+		reg.Write16(KPP_KPDR, (colMask&^(1<<col))<<KPDR_KCD)
+
+		time.Sleep(kppSettleTime)
+
+		keys[col] = uint8(^reg.Read16(KPP_KPDR) & rowMask)
+	}
+
+	// restore key depression detection
+	reg.Write16(KPP_KPDR, 0)
+
+	return
+}
+
+// ScanEvents returns a channel which receives key press and release events,
+// the matrix is scanned every 10 ms by a background goroutine, started on the
+// first invocation, and a key state change is reported once observed on 3
+// consecutive scans.
+//
+// Events are discarded, rather than blocking the scan, when the channel buffer
+// is full. The Keypad Port must be initialized (see Init()).
+func (hw *kpp) ScanEvents() <-chan KeyEvent {
+	hw.Lock()
+	defer hw.Unlock()
+
+	if hw.events == nil {
+		hw.events = make(chan KeyEvent, kppEventBuffer)
+		go hw.poll()
+	}
+
+	return hw.events
+}
+
+func (hw *kpp) poll() {
+	for {
+		time.Sleep(kppScanInterval)
+
+		hw.Lock()
+
+		if hw.rows != 0 {
+			hw.debounce(hw.scan())
+		}
+
+		hw.Unlock()
+	}
+}
+
+// debounce updates the key state once the matrix scans are stable, emitting
+// events for changed keys.
+func (hw *kpp) debounce(keys [KPP_MAX_COLS]uint8) {
+	if keys != hw.last {
+		hw.last = keys
+		hw.matches = 1
+		return
+	}
+
+	if hw.matches < kppDebounceScans {
+		hw.matches++
+	}
+
+	if hw.matches < kppDebounceScans || keys == hw.state {
+		return
+	}
+
+	for col := 0; col < hw.cols; col++ {
+		changed := keys[col] ^ hw.state[col]
+
+		for row := 0; row < hw.rows; row++ {
+			if changed&(1<<row) == 0 {
+				continue
+			}
+
+			ev := KeyEvent{
+				Row:     row,
+				Col:     col,
+				Pressed: keys[col]&(1<<row) != 0,
+			}
+
+			select {
+			case hw.events <- ev:
+			default:
+			}
+		}
+	}
+
+	hw.state = keys
+}
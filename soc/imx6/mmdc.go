@@ -0,0 +1,139 @@
+// NXP Multi Mode DDR Controller (MMDC) status
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"github.com/f-secure-foundry/tamago/bits"
+	"github.com/f-secure-foundry/tamago/internal/reg"
+)
+
+// MMDC registers
+// (MMDC Memory Map/Register Definition, IMX6ULLRM).
+const (
+	MMDC_BASE = 0x021b0000
+
+	MMDC_MDCTL  = MMDC_BASE + 0x000
+	MDCTL_SDE_0 = 31
+	MDCTL_SDE_1 = 30
+	MDCTL_ROW   = 24
+	MDCTL_COL   = 20
+	MDCTL_DSIZ  = 16
+
+	MMDC_MDMISC       = MMDC_BASE + 0x018
+	MDMISC_DDR_4_BANK = 5
+
+	MMDC_MPWLGCR      = MMDC_BASE + 0x808
+	MPWLGCR_WL_HW_ERR = 8
+
+	MMDC_MPWLDECTRL0 = MMDC_BASE + 0x80c
+	MMDC_MPWLDECTRL1 = MMDC_BASE + 0x810
+
+	MMDC_MPDGCTRL0      = MMDC_BASE + 0x83c
+	MPDGCTRL0_HW_DG_ERR = 12
+	MMDC_MPDGCTRL1      = MMDC_BASE + 0x840
+
+	MMDC_MPRDDLCTL = MMDC_BASE + 0x848
+	MMDC_MPWRDLCTL = MMDC_BASE + 0x850
+
+	MMDC_MPRDDLHWCTL         = MMDC_BASE + 0x860
+	MPRDDLHWCTL_HW_RD_DL_ERR = 0
+
+	MMDC_MPWRDLHWCTL         = MMDC_BASE + 0x864
+	MPWRDLHWCTL_HW_WR_DL_ERR = 0
+)
+
+// DDRStatus represents the MMDC configuration and calibration results.
+type DDRStatus struct {
+	// control (MDCTL) and miscellaneous (MDMISC) configuration
+	Control       uint32
+	Miscellaneous uint32
+
+	// write leveling delays (MPWLDECTRL0, MPWLDECTRL1)
+	WriteLeveling [2]uint32
+	// read DQS gating delays (MPDGCTRL0, MPDGCTRL1)
+	ReadDQSGating [2]uint32
+	// read delay-lines (MPRDDLCTL)
+	ReadDelay uint32
+	// write delay-lines (MPWRDLCTL)
+	WriteDelay uint32
+
+	// hardware calibration errors, one bit for each byte lane
+	WriteLevelingErrors uint32
+	ReadDelayErrors     uint32
+	WriteDelayErrors    uint32
+	// hardware DQS gating calibration error
+	ReadDQSGatingError bool
+}
+
+type mmdc struct{}
+
+// MMDC represents the Multi Mode DDR Controller instance.
+var MMDC = &mmdc{}
+
+// Status returns the DDR controller configuration and the calibration
+// results, as programmed by the boot loader (e.g. through the DCD) or by
+// hardware calibration, to help diagnosing memory stability issues.
+//
+// The MMDC does not implement ECC, therefore no memory error counters are
+// available.
+func (hw *mmdc) Status() (status DDRStatus) {
+	status.Control = reg.Read(MMDC_MDCTL)
+	status.Miscellaneous = reg.Read(MMDC_MDMISC)
+
+	status.WriteLeveling[0] = reg.Read(MMDC_MPWLDECTRL0)
+	status.WriteLeveling[1] = reg.Read(MMDC_MPWLDECTRL1)
+	status.ReadDQSGating[0] = reg.Read(MMDC_MPDGCTRL0)
+	status.ReadDQSGating[1] = reg.Read(MMDC_MPDGCTRL1)
+	status.ReadDelay = reg.Read(MMDC_MPRDDLCTL)
+	status.WriteDelay = reg.Read(MMDC_MPWRDLCTL)
+
+	status.WriteLevelingErrors = reg.Get(MMDC_MPWLGCR, MPWLGCR_WL_HW_ERR, 0b1111)
+	status.ReadDelayErrors = reg.Get(MMDC_MPRDDLHWCTL, MPRDDLHWCTL_HW_RD_DL_ERR, 0b1111)
+	status.WriteDelayErrors = reg.Get(MMDC_MPWRDLHWCTL, MPWRDLHWCTL_HW_WR_DL_ERR, 0b1111)
+	status.ReadDQSGatingError = bits.Get(&status.ReadDQSGating[0], MPDGCTRL0_HW_DG_ERR, 1) == 1
+
+	return
+}
+
+// Size returns the size of the external DDR memory, as configured by the boot
+// loader in the MMDC, zero is returned if the MMDC is not configured.
+func (hw *mmdc) Size() (size uint64) {
+	ctl := reg.Read(MMDC_MDCTL)
+	misc := reg.Read(MMDC_MDMISC)
+
+	cs := bits.Get(&ctl, MDCTL_SDE_0, 1) + bits.Get(&ctl, MDCTL_SDE_1, 1)
+
+	if cs == 0 {
+		return
+	}
+
+	row := bits.Get(&ctl, MDCTL_ROW, 0b111) + 11
+	col := bits.Get(&ctl, MDCTL_COL, 0b111)
+
+	switch col {
+	case 3:
+		col = 8
+	case 4:
+		col = 12
+	default:
+		col += 9
+	}
+
+	banks := uint64(8)
+
+	if bits.Get(&misc, MDMISC_DDR_4_BANK, 1) == 1 {
+		banks = 4
+	}
+
+	// data bus width in bytes
+	width := uint64(2) << bits.Get(&ctl, MDCTL_DSIZ, 0b11)
+
+	return uint64(cs) * (1 << row) * (1 << col) * banks * width
+}
@@ -0,0 +1,69 @@
+// NXP i.MX6 memory mapped I/O regions
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Peripheral address space size for each AIPS slot
+// (ARM Platform Memory Map, IMX6ULLRM).
+const AIPS_SLOT_SIZE = 0x4000
+
+type mmioRegion struct {
+	name  string
+	start uint32
+	end   uint32
+}
+
+// Claimed memory mapped I/O regions, statically sized as the board console
+// UART claims its region within runtime.hwinit (see UART.Init()).
+var mmioRegions [32]mmioRegion
+var mmioCount int
+var mmioMutex sync.Mutex
+
+// RegisterRegion records the memory mapped I/O region, at the argument base
+// address and size, claimed by a driver on initialization. The function
+// panics if the region overlaps with a different one previously claimed, to
+// detect invalid base addresses at bring-up. Claiming again an identical
+// region (e.g. on driver re-initialization) has no effect.
+//
+// Drivers external to this package should claim their regions as well.
+func RegisterRegion(name string, base uint32, size uint32) {
+	if size == 0 {
+		return
+	}
+
+	mmioMutex.Lock()
+	defer mmioMutex.Unlock()
+
+	end := base + size
+
+	for i := 0; i < mmioCount; i++ {
+		r := &mmioRegions[i]
+
+		if r.start == base && r.end == end {
+			return
+		}
+
+		if base < r.end && r.start < end {
+			panic(fmt.Sprintf("%s region %#x-%#x overlaps %s region %#x-%#x",
+				name, base, end, r.name, r.start, r.end))
+		}
+	}
+
+	if mmioCount == len(mmioRegions) {
+		panic("too many memory mapped I/O regions")
+	}
+
+	mmioRegions[mmioCount] = mmioRegion{name, base, end}
+	mmioCount++
+}
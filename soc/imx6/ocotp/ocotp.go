@@ -25,6 +25,8 @@ package ocotp
 
 import (
 	"errors"
+	"fmt"
+	"math/bits"
 	"sync"
 	"time"
 
@@ -45,26 +47,77 @@ const (
 	CTRL_ADDR           = 0
 
 	OCOTP_CTRL_CLR = OCOTP_BASE + 0x0008
-	OCOTP_DATA     = OCOTP_BASE + 0x0020
+
+	OCOTP_TIMING       = OCOTP_BASE + 0x0010
+	TIMING_WAIT        = 22
+	TIMING_STROBE_READ = 16
+	TIMING_RELAX       = 12
+	TIMING_STROBE_PROG = 0
+
+	OCOTP_DATA = OCOTP_BASE + 0x0020
 
 	OCOTP_VERSION = OCOTP_BASE + 0x0090
 	VERSION_MAJOR = 24
 	VERSION_MINOR = 16
 	VERSION_STEP  = 0
 
-	OCOTP_BANK0_WORD0 = OCOTP_BASE + 0x0400
+	OCOTP_BANK0_WORD0 = imx6.OCOTP_BANK0_WORD0
+
+	// Value of OTP Bank0 Word0 (Lock controls) (HW_OCOTP_LOCK), IMX6ULLRM
+	OCOTP_LOCK    = OCOTP_BANK0_WORD0
+	LOCK_ANALOG   = 20
+	LOCK_SRK      = 14
+	LOCK_GP2      = 12
+	LOCK_GP1      = 10
+	LOCK_MAC_ADDR = 8
+	LOCK_SJC_RESP = 6
+	LOCK_MEM_TRIM = 4
+	LOCK_BOOT_CFG = 2
+	LOCK_TESTER   = 0
 )
 
+// lockRegion maps a range of fuse words, within a single bank, to its
+// controlling OCOTP_LOCK field.
+type lockRegion struct {
+	bank  int
+	first int
+	last  int
+	pos   int
+}
+
+// Lock controls for fuse regions, for regions with a 2-bit lock field the
+// lowest bit blocks OTP writes while the highest one blocks shadow register
+// writes (HW_OCOTP_LOCK field descriptions, IMX6ULLRM).
+var lockRegions = []lockRegion{
+	{bank: 0, first: 1, last: 4, pos: LOCK_TESTER},
+	{bank: 0, first: 5, last: 7, pos: LOCK_BOOT_CFG},
+	{bank: 1, first: 0, last: 4, pos: LOCK_MEM_TRIM},
+	{bank: 1, first: 5, last: 7, pos: LOCK_ANALOG},
+	{bank: 3, first: 0, last: 7, pos: LOCK_SRK},
+	{bank: 4, first: 0, last: 1, pos: LOCK_SJC_RESP},
+	{bank: 4, first: 2, last: 4, pos: LOCK_MAC_ADDR},
+	{bank: 4, first: 6, last: 6, pos: LOCK_GP1},
+	{bank: 4, first: 7, last: 7, pos: LOCK_GP2},
+}
+
 // Configuration constants
 const (
 	// WordSize represents the number of bytes per OTP word.
 	WordSize = 4
 	// BankSize represents the number of words per OTP bank.
-	BankSize = 8
+	BankSize = imx6.OTP_BANK_SIZE
 )
 
 var mux sync.Mutex
 
+// OTP access timings, in nanoseconds
+// (p2384, 37.3.1.3 Fuse and Shadow Register Writes, IMX6ULLRM).
+const (
+	tRelax      = 17
+	tStrobeRead = 37
+	tStrobeProg = 10000
+)
+
 // Timeout for OCOTP controller operations
 var Timeout = 10 * time.Millisecond
 
@@ -74,42 +127,18 @@ func Init() (err error) {
 	defer mux.Unlock()
 
 	// enable clock
-	reg.SetN(imx6.CCM_CCGR2, imx6.CCGR2_CG6, 0b11, 0b11)
+	imx6.EnableClock(imx6.CLOCK_OCOTP)
 
 	return
 }
 
-// Read returns the value in the argument bank and word location.
+// Read returns the value in the argument bank and word location, from its
+// shadow register (see imx6.ReadOTP()).
 func Read(bank int, word int) (value uint32, err error) {
-	var banks int
-
-	switch imx6.Model() {
-	case "i.MX6UL":
-		banks = 16
-	case "i.MX6ULL":
-		banks = 8
-	}
-
-	if bank > banks || word > BankSize {
-		return 0, errors.New("invalid argument")
-	}
-
-	// Within the shadow register address map the addresses are spaced 0x10
-	// apart.
-	offset := 0x10 * uint32(BankSize*bank+word)
-
-	// Account for the gap in shadow registers address map between bank 5
-	// and bank 6.
-	if bank > 5 {
-		offset += 0x100
-	}
-
 	mux.Lock()
 	defer mux.Unlock()
 
-	value = reg.Read(OCOTP_BANK0_WORD0 + offset)
-
-	return
+	return imx6.ReadOTP(bank, word)
 }
 
 // Blow fuses a value in the argument bank and word location.
@@ -121,17 +150,30 @@ func Read(bank int, word int) (value uint32, err error) {
 // **bricked** device.
 //
 // The use of this function is therefore **at your own risk**.
-func Blow(bank int, word int, value uint32) (err error) {
+//
+// As a safeguard against unintended invocations the confirm argument must be
+// true, otherwise an error is returned without any fuse access.
+//
+// The programming timings are configured according to the current
+// IPG_CLK_ROOT frequency, once the shadow registers are reloaded the fused
+// value is verified and an error is returned if any of its bits is not set.
+func Blow(bank int, word int, value uint32, confirm bool) (err error) {
+	if !confirm {
+		return errors.New("fuse programming not confirmed")
+	}
+
 	mux.Lock()
 	defer mux.Unlock()
 
+	if _, err = imx6.ReadOTP(bank, word); err != nil {
+		return
+	}
+
 	if !reg.WaitFor(Timeout, OCOTP_CTRL, CTRL_BUSY, 1, 0) {
 		return errors.New("OCOTP controller busy")
 	}
 
-	// FIXME: configure OCOTP_TIMING register. Timings depend on
-	// IPG_CLK_ROOT frequency. Default values work for default frequency of
-	// 66 MHz.
+	setTiming()
 
 	// p2393, OCOTP_CTRLn field descriptions, IMX6ULLRM
 
@@ -153,11 +195,69 @@ func Blow(bank int, word int, value uint32) (err error) {
 	time.Sleep(2 * time.Microsecond)
 
 	// ensure update of shadow registers
-	err = shadowReload()
+	if err = shadowReload(); err != nil {
+		return
+	}
+
+	res, err := imx6.ReadOTP(bank, word)
+
+	if err != nil {
+		return
+	}
+
+	// fuses can only be set, previously blown bits are preserved
+	if res&value != value {
+		return fmt.Errorf("fuse verification failed (%#x)", res)
+	}
 
 	return
 }
 
+// setTiming configures the OTP read and programming timings
+// (p2384, 37.3.1.3 Fuse and Shadow Register Writes, IMX6ULLRM).
+func setTiming() {
+	clk := uint64(imx6.IPGFreq())
+
+	relax := (clk*tRelax+1e9-1)/1e9 - 1
+	strobeRead := (clk*tStrobeRead+1e9-1)/1e9 + 2*(relax+1) - 1
+	strobeProg := (clk*tStrobeProg+1e9/2)/1e9 + 2*(relax+1) - 1
+
+	timing := reg.Read(OCOTP_TIMING) & (0x3f << TIMING_WAIT)
+	timing |= uint32(strobeRead&0x3f) << TIMING_STROBE_READ
+	timing |= uint32(relax&0xf) << TIMING_RELAX
+	timing |= uint32(strobeProg&0xfff) << TIMING_STROBE_PROG
+
+	reg.Write(OCOTP_TIMING, timing)
+}
+
+// Locked returns whether OTP writes to the argument bank and word location are
+// blocked by its lock fuse, an error is returned for locations without a known
+// lock control.
+//
+// Provisioning code should use this function to refuse fusing operations on
+// locked locations, as their outcome is undefined.
+func Locked(bank int, word int) (locked bool, err error) {
+	if bank < 0 || word < 0 || word >= BankSize {
+		return false, errors.New("invalid argument")
+	}
+
+	for _, r := range lockRegions {
+		if bank != r.bank || word < r.first || word > r.last {
+			continue
+		}
+
+		lock, err := Read(0, 0)
+
+		if err != nil {
+			return false, err
+		}
+
+		return (lock>>r.pos)&1 == 1, nil
+	}
+
+	return false, errors.New("no lock control for location")
+}
+
 func checkOp() (err error) {
 	if !reg.WaitFor(Timeout, OCOTP_CTRL, CTRL_BUSY, 1, 0) {
 		return errors.New("operation timeout")
@@ -186,3 +286,59 @@ func shadowReload() (err error) {
 
 	return
 }
+
+// MonotonicCounter returns the value of a fuse backed monotonic counter,
+// stored in the argument bank and word location (e.g. a general purpose fuse
+// word) with unary encoding, as the number of consecutive bits set starting
+// from the least significant one. A single word therefore holds a counter up
+// to 32.
+//
+// An error is returned if the word does not hold a valid unary value.
+func MonotonicCounter(bank int, word int) (cnt int, err error) {
+	val, err := Read(bank, word)
+
+	if err != nil {
+		return
+	}
+
+	cnt = bits.OnesCount32(val)
+
+	if val != uint32(uint64(1)<<cnt-1) {
+		return 0, errors.New("invalid monotonic counter encoding")
+	}
+
+	return
+}
+
+// IncrementMonotonicCounter increments by one a fuse backed monotonic counter
+// (see MonotonicCounter()) by fusing its next bit, it returns the new counter
+// value.
+//
+// WARNING: Fusing SoC OTPs is an **irreversible** action, each increment
+// permanently consumes one fuse bit and the counter can never be decreased.
+// The location must be reserved to the counter, as any other use of its fuses
+// might result in a **bricked** device.
+//
+// The use of this function is therefore **at your own risk**.
+//
+// As with Blow(), the confirm argument must be true, otherwise an error is
+// returned without any fuse programming.
+func IncrementMonotonicCounter(bank int, word int, confirm bool) (cnt int, err error) {
+	if cnt, err = MonotonicCounter(bank, word); err != nil {
+		return
+	}
+
+	if cnt == 32 {
+		return cnt, errors.New("monotonic counter exhausted")
+	}
+
+	if locked, _ := Locked(bank, word); locked {
+		return cnt, errors.New("fuse location is locked")
+	}
+
+	if err = Blow(bank, word, 1<<cnt, confirm); err != nil {
+		return
+	}
+
+	return MonotonicCounter(bank, word)
+}
@@ -0,0 +1,61 @@
+// NXP i.MX6 OTP fuse shadow registers
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"errors"
+
+	"github.com/f-secure-foundry/tamago/internal/reg"
+)
+
+// OTP shadow registers
+// (p2388, 37.5 OCOTP Memory Map/Register Definition, IMX6ULLRM).
+const (
+	OCOTP_BANK0_WORD0 = 0x021bc400
+
+	// number of words per OTP bank
+	OTP_BANK_SIZE = 8
+)
+
+// otpBanks returns the number of OTP banks for the detected processor family,
+// banks 0-5 share the same layout across the i.MX6 series and are the only
+// ones returned for other families.
+func otpBanks() int {
+	switch Family {
+	case IMX6UL:
+		return 16
+	case IMX6ULL:
+		return 8
+	default:
+		return 6
+	}
+}
+
+// ReadOTP returns the value of the argument bank and word OTP location, read
+// from its shadow register. The shadow registers are loaded from fuses at
+// boot, fuse programming and the subsequent reload are performed by the ocotp
+// package (see ocotp.Blow()).
+func ReadOTP(bank int, word int) (value uint32, err error) {
+	if bank < 0 || bank >= otpBanks() || word < 0 || word >= OTP_BANK_SIZE {
+		return 0, errors.New("invalid argument")
+	}
+
+	// Within the shadow register address map the addresses are spaced 0x10
+	// apart.
+	offset := 0x10 * uint32(OTP_BANK_SIZE*bank+word)
+
+	// Account for the gap in shadow registers address map between bank 5
+	// and bank 6.
+	if bank > 5 {
+		offset += 0x100
+	}
+
+	return reg.Read(OCOTP_BANK0_WORD0 + offset), nil
+}
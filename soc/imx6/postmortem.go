@@ -0,0 +1,148 @@
+// NXP i.MX6 post-mortem log
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"errors"
+	"unsafe"
+
+	"github.com/f-secure-foundry/tamago/arm"
+	"github.com/f-secure-foundry/tamago/internal/reg"
+)
+
+const (
+	// post-mortem log header magic
+	pmMagic = 0x706d6c67
+	// post-mortem log header size: magic, size, write index
+	pmHeaderSize = 12
+)
+
+type postMortemLog struct {
+	// log region, header included
+	addr uint32
+	size uint32
+
+	// log buffer start
+	buf uint32
+	// log buffer write index
+	index uint32
+
+	// previous boot log
+	prev []byte
+}
+
+var postMortem postMortemLog
+
+// InitPostMortemLog configures a memory region as log buffer, which is
+// preserved across warm resets, to allow retrieval of the last log entries
+// recorded before a reset.
+//
+// The log survives watchdog timeouts (see EnableWatchdog(), RebootAfter()) and
+// WarmReboot(), SRSR_WARM_BOOT in ResetStatus() reports whether the last reset
+// was a warm one. It does not survive power-on resets, Reboot() and
+// ColdReboot(), or any reset for which the SRC falls back to a cold reset, as
+// the memory controller is then reset along with the rest of the SoC.
+//
+// The memory region must be placed in external RAM (as internal RAM is used by
+// the boot ROM), and the application must guarantee that it is never used by
+// the Go runtime or the boot loader, which is typically achieved by defining
+// runtime.ramSize to exclude the end of the RAM module (see board package
+// `linkramsize` build tag).
+//
+// The 1MB sections holding the region are set as non-cacheable (see
+// arm.CPU.ConfigureMMU()), so that log entries are not lost in the data cache
+// on reset, any memory sharing those sections (e.g. the end of the runtime
+// RAM) is therefore no longer cached. Memory attributes can only be set once
+// the MMU is enabled, by SoC initialization (see Init()), an error is returned
+// if the function is invoked earlier.
+//
+// If the region contains a valid log, from the previous boot, its content is
+// made available with PostMortemLog() before the region is reset for new log
+// entries (see LogPostMortem()).
+func InitPostMortemLog(addr uint32, size int) (err error) {
+	if addr&3 != 0 || size <= pmHeaderSize {
+		return errors.New("invalid post-mortem log region")
+	}
+
+	pm := &postMortem
+
+	// disable logging during initialization
+	pm.addr = 0
+
+	if err = ARM.ConfigureMMU(addr, addr+uint32(size), arm.MEMORY_NORMAL_UNCACHED); err != nil {
+		return
+	}
+
+	pm.size = uint32(size)
+	pm.buf = addr + pmHeaderSize
+	pm.prev = nil
+
+	if reg.Read(addr) == pmMagic && reg.Read(addr+4) == pm.size {
+		pm.prev = pm.read(reg.Read(addr + 8))
+	}
+
+	pm.index = 0
+
+	reg.Write(addr+4, pm.size)
+	reg.Write(addr+8, 0)
+	reg.Write(addr, pmMagic)
+
+	pm.addr = addr
+
+	return
+}
+
+// read returns the log buffer content, in order, for the argument write
+// index.
+func (pm *postMortemLog) read(index uint32) (buf []byte) {
+	n := pm.size - pmHeaderSize
+	start := uint32(0)
+
+	if index >= n {
+		// the buffer wrapped around, the oldest entry is at the write
+		// index
+		start = index % n
+		index = n
+	}
+
+	buf = make([]byte, index)
+
+	for i := uint32(0); i < index; i++ {
+		off := (start + i) % n
+		buf[i] = *(*byte)(unsafe.Pointer(uintptr(pm.buf + off)))
+	}
+
+	return
+}
+
+// LogPostMortem appends a character to the post-mortem log, if configured
+// (see InitPostMortemLog()). It does not allocate and it can therefore be used
+// within the standard output function (see board package printk).
+func LogPostMortem(c byte) {
+	pm := &postMortem
+
+	if pm.addr == 0 {
+		return
+	}
+
+	n := pm.size - pmHeaderSize
+
+	*(*byte)(unsafe.Pointer(uintptr(pm.buf + pm.index%n))) = c
+	pm.index++
+
+	reg.Write(pm.addr+8, pm.index)
+}
+
+// PostMortemLog returns the log recorded, before the last reset, in the
+// post-mortem log region (see InitPostMortemLog()), nil is returned if no
+// valid log was found.
+func PostMortemLog() []byte {
+	return postMortem.prev
+}
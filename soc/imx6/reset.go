@@ -0,0 +1,225 @@
+// NXP i.MX6 reset control
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"errors"
+	"time"
+
+	"github.com/f-secure-foundry/tamago/internal/reg"
+)
+
+// Reset status and watchdog registers
+// (SRC Memory Map/Register Definition, WDOG Memory Map/Register Definition,
+// IMX6ULLRM).
+const (
+	SRC_SRSR              = 0x020d8008
+	SRSR_WARM_BOOT        = 16
+	SRSR_TEMPSENSE_RST_B  = 8
+	SRSR_WDOG3_RST_B      = 7
+	SRSR_JTAG_SW_RST      = 6
+	SRSR_JTAG_RST_B       = 5
+	SRSR_WDOG_RST_B       = 4
+	SRSR_IPP_USER_RESET_B = 3
+	SRSR_CSU_RESET_B      = 2
+	SRSR_IPP_RESET_B      = 0
+
+	WCR_WT  = 8
+	WCR_WDA = 5
+	WCR_SRS = 4
+	WCR_WDE = 2
+
+	WDOG1_WSR = 0x020bc002
+
+	WDOG1_WRSR = 0x020bc004
+	WRSR_TOUT  = 1
+	WRSR_SFTW  = 0
+
+	WDOG1_WMCR = 0x020bc008
+	WMCR_PDE   = 0
+
+	// SNVS low power general purpose register
+	SNVS_LPGPR = SNVS_LP_BASE + 0x68
+)
+
+// double reset detection flag
+const doubleResetFlag = 0x64726466
+
+// ResetStatus returns the SRC Reset Status Register, whose bits (see SRSR_*
+// constants) report the source of the last reset. The register is sticky,
+// therefore sources of previous resets are reported until a power-on reset
+// takes place, unless explicitly cleared with ClearResetStatus() or
+// ResetReason().
+func ResetStatus() (srsr uint32) {
+	return reg.Read(SRC_SRSR)
+}
+
+// ClearResetStatus clears the SRC Reset Status Register.
+func ClearResetStatus() {
+	reg.Write(SRC_SRSR, reg.Read(SRC_SRSR))
+}
+
+// ResetCause represents the source of the last reset (see ResetReason()).
+type ResetCause int
+
+// Reset causes
+const (
+	ResetPowerOn ResetCause = iota
+	ResetWatchdog
+	ResetSoftware
+	ResetJTAG
+	ResetTemperature
+	ResetUser
+	ResetSecurity
+)
+
+// String returns the reset cause name.
+func (c ResetCause) String() string {
+	switch c {
+	case ResetPowerOn:
+		return "power-on"
+	case ResetWatchdog:
+		return "watchdog"
+	case ResetSoftware:
+		return "software"
+	case ResetJTAG:
+		return "JTAG"
+	case ResetTemperature:
+		return "temperature sensor"
+	case ResetUser:
+		return "user"
+	case ResetSecurity:
+		return "security violation"
+	default:
+		return "unknown"
+	}
+}
+
+// ResetReason decodes the SRC Reset Status Register (see ResetStatus()) into
+// the source of the last reset, and clears it so that the source of the
+// following reset is reported unambiguously. An error is returned if no
+// reset source is flagged (e.g. if already cleared).
+//
+// Software resets (see Reboot(), ColdReboot(), WarmReboot()) and watchdog
+// timeouts (see EnableWatchdog()) are both flagged as watchdog resets in the
+// SRC and are told apart through the watchdog reset status register
+// (WDOG1_WRSR). Whether the reset was a warm one is reported by the
+// SRSR_WARM_BOOT bit of ResetStatus(), therefore it must be checked before
+// invoking this function.
+func ResetReason() (cause ResetCause, err error) {
+	srsr := ResetStatus()
+
+	switch {
+	case srsr&(1<<SRSR_IPP_RESET_B) != 0:
+		cause = ResetPowerOn
+	case srsr&(1<<SRSR_WDOG_RST_B) != 0:
+		// WDOG1_WRSR is a 16-bit register, 32-bit access should be avoided
+		if reg.Get16(WDOG1_WRSR, WRSR_SFTW, 1) == 1 {
+			cause = ResetSoftware
+		} else {
+			cause = ResetWatchdog
+		}
+	case srsr&(1<<SRSR_WDOG3_RST_B) != 0:
+		cause = ResetWatchdog
+	case srsr&(1<<SRSR_JTAG_RST_B|1<<SRSR_JTAG_SW_RST) != 0:
+		cause = ResetJTAG
+	case srsr&(1<<SRSR_TEMPSENSE_RST_B) != 0:
+		cause = ResetTemperature
+	case srsr&(1<<SRSR_IPP_USER_RESET_B) != 0:
+		cause = ResetUser
+	case srsr&(1<<SRSR_CSU_RESET_B) != 0:
+		cause = ResetSecurity
+	default:
+		return 0, errors.New("unknown reset cause")
+	}
+
+	ClearResetStatus()
+
+	return
+}
+
+// RebootAfter enables the watchdog timer to restart the SoC after the
+// argument delay, which must be a multiple of 500 ms in the 0.5 to 128 seconds
+// range (otherwise it is rounded down).
+//
+// As the watchdog cannot be disabled once enabled, the reboot cannot be
+// cancelled and it takes place even if the application stops responding.
+func RebootAfter(d time.Duration) (err error) {
+	if err = EnableWatchdog(d); err != nil {
+		return errors.New("invalid reboot delay")
+	}
+
+	return
+}
+
+// EnableWatchdog enables the watchdog timer (WDOG1) to restart the SoC unless
+// serviced (see ServiceWatchdog()) within the argument timeout, which must be
+// a multiple of 500 ms in the 0.5 to 128 seconds range (otherwise it is
+// rounded down). It allows to recover from a hung application, the timeout
+// can be changed with further invocations.
+//
+// The watchdog timeout triggers a warm reset (SCR_WARM_RESET_ENABLE set, see
+// WarmReboot()), preserving external memory contents such as the post-mortem
+// log (see InitPostMortemLog()), the SRC falls back to a cold reset if warm
+// reset conditions are not met.
+//
+// The watchdog cannot be disabled in hardware once enabled, until the next
+// reset, Reboot() remains available as software reset.
+func EnableWatchdog(timeout time.Duration) (err error) {
+	wt := timeout / (500 * time.Millisecond)
+
+	if wt < 1 || wt > 256 {
+		return errors.New("invalid watchdog timeout")
+	}
+
+	reg.Set(SRC_SCR, SCR_WARM_RESET_ENABLE)
+
+	// disable the power-down counter, which resets the SoC 16 seconds
+	// after boot unless cleared
+	reg.Write16(WDOG1_WMCR, 0)
+
+	// WDOG1_WCR is a 16-bit register, 32-bit access should be avoided
+	reg.Write16(WDOG1_WCR, uint16(wt-1)<<WCR_WT|1<<WCR_WDA|1<<WCR_SRS|1<<WCR_WDE)
+
+	ServiceWatchdog()
+
+	return
+}
+
+// ServiceWatchdog reloads the watchdog timer counter (see EnableWatchdog()),
+// it must be invoked periodically, within the watchdog timeout, to prevent
+// the SoC restart.
+func ServiceWatchdog() {
+	reg.Write16(WDOG1_WSR, 0x5555)
+	reg.Write16(WDOG1_WSR, 0xaaaa)
+}
+
+// DoubleResetDetected returns whether the SoC has been reset twice within the
+// argument time window, it allows to implement user actions (e.g. entering a
+// recovery mode) triggered by two consecutive resets.
+//
+// The function must be invoked once, as early as possible after boot, as the
+// detection window starts at its invocation. A flag is kept, for the window
+// duration, in the SNVS low power general purpose register, which retains its
+// value across all reset types as long as the SNVS domain is powered.
+func DoubleResetDetected(window time.Duration) bool {
+	if reg.Read(SNVS_LPGPR) == doubleResetFlag {
+		reg.Write(SNVS_LPGPR, 0)
+		return true
+	}
+
+	reg.Write(SNVS_LPGPR, doubleResetFlag)
+
+	time.AfterFunc(window, func() {
+		reg.Write(SNVS_LPGPR, 0)
+	})
+
+	return false
+}
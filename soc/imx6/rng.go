@@ -10,27 +10,142 @@
 package imx6
 
 import (
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"sync"
 	_ "unsafe"
 
 	"github.com/f-secure-foundry/tamago/soc/imx6/rngb"
 )
 
+// RNGB output pool size
+const rngPoolSize = 512
+
 var lcg uint32
+
 var getRandomDataFn func([]byte)
+var getRandomDataMutex sync.Mutex
+
+// flag for a cryptographically secure entropy source (see RNG.Secure())
+var rngSecure bool
+
+// rngPool buffers RNGB output so that small requests (e.g. nonces, IVs) are
+// served from memory rather than by polling the hardware FIFO.
+type rngPool struct {
+	sync.Mutex
+
+	buf [rngPoolSize]byte
+	// available bytes, at the beginning of buf
+	n int
+
+	// refill requests, nil until asynchronous refill is started (see
+	// init())
+	refill chan struct{}
+}
+
+var pool rngPool
 
 //go:linkname initRNG runtime.initRNG
 func initRNG() {
+	markBoot("runtime (early)")
+
 	if Family == IMX6ULL && Native {
 		rngb.Init()
-		getRandomDataFn = rngb.GetRandomData
+		getRandomDataFn = pool.read
+		rngSecure = true
 	} else {
 		getRandomDataFn = getLCGData
 	}
+
+	markBoot("RNG init")
 }
 
 //go:linkname getRandomData runtime.getRandomData
 func getRandomData(b []byte) {
-	getRandomDataFn(b)
+	getRandomDataMutex.Lock()
+	fn := getRandomDataFn
+	getRandomDataMutex.Unlock()
+
+	fn(b)
+}
+
+// SetEntropySource replaces the system entropy source, used by the runtime
+// and therefore by crypto/rand, with the argument function which must fill
+// the entire buffer with random data on each invocation.
+//
+// This allows boards to install a driver for an external TRNG (e.g. over SPI
+// or I2C) in place of the default source (RNGB on the i.MX6ULL, a Linear
+// Congruential Generator otherwise). The function is invoked concurrently by
+// any goroutine requiring random data, it must therefore be thread safe and
+// it must not panic.
+//
+// The argument source is assumed to be cryptographically secure (see
+// RNG.Secure()).
+func SetEntropySource(fn func(b []byte)) (err error) {
+	if fn == nil {
+		return errors.New("invalid entropy source")
+	}
+
+	getRandomDataMutex.Lock()
+	getRandomDataFn = fn
+	rngSecure = true
+	getRandomDataMutex.Unlock()
+
+	return
+}
+
+type rng struct{}
+
+// RNG is an io.Reader for the system entropy source, the same used by the
+// runtime and therefore by crypto/rand (RNGB on the i.MX6ULL, a Linear
+// Congruential Generator otherwise, unless replaced with SetEntropySource()).
+//
+// It allows applications to read from, and verify, the system entropy source
+// without replicating its selection logic.
+var RNG = &rng{}
+
+// Read fills b with random data from the system entropy source, it
+// implements io.Reader.
+func (r *rng) Read(b []byte) (n int, err error) {
+	getRandomData(b)
+	return len(b), nil
+}
+
+// Secure returns whether the system entropy source is cryptographically
+// secure, which is not the case for the Linear Congruential Generator used on
+// SoCs without RNGB (i.MX6UL, i.MX6Q) and under emulation.
+func (r *rng) Secure() bool {
+	getRandomDataMutex.Lock()
+	defer getRandomDataMutex.Unlock()
+
+	return rngSecure
+}
+
+// SelfTest runs the RNGB built-in self-test (see rngb.SelfTest()), an error
+// is returned if the test fails or if the RNGB is not available.
+func (r *rng) SelfTest() (err error) {
+	if Family != IMX6ULL || !Native {
+		return errors.New("RNGB not available")
+	}
+
+	return rngb.SelfTest()
+}
+
+// NewRand returns a pseudo-random number generator, meant for non
+// cryptographic uses (e.g. retry backoff jitter, load distribution), seeded
+// once from the SoC random number generator (RNGB on the i.MX6ULL, see
+// rngb.Init()).
+//
+// Unlike the hardware entropy source, which should be consumed through
+// crypto/rand for security sensitive uses, the returned generator is fast,
+// however it is not safe for concurrent use by multiple goroutines.
+func NewRand() *rand.Rand {
+	var seed [8]byte
+
+	getRandomData(seed[:])
+
+	return rand.New(rand.NewSource(int64(binary.LittleEndian.Uint64(seed[:]))))
 }
 
 // getLCGData implements a Linear Congruential Generator
@@ -48,3 +163,90 @@ func getLCGData(b []byte) {
 		read = rngb.Fill(b, read, lcg)
 	}
 }
+
+func init() {
+	if Family != IMX6ULL || !Native {
+		return
+	}
+
+	// initRNG runs before the scheduler, therefore refills are performed
+	// synchronously until this point.
+	pool.refill = make(chan struct{}, 1)
+
+	go func() {
+		for range pool.refill {
+			pool.fill()
+		}
+	}()
+}
+
+// fill tops up the pool from the RNGB, the hardware is polled without holding
+// the pool lock.
+func (p *rngPool) fill() {
+	var buf [rngPoolSize]byte
+
+	p.Lock()
+	need := len(p.buf) - p.n
+	p.Unlock()
+
+	if need == 0 {
+		return
+	}
+
+	rngb.GetRandomData(buf[0:need])
+
+	p.Lock()
+
+	n := copy(p.buf[p.n:], buf[0:need])
+	p.n += n
+
+	p.Unlock()
+
+	// do not leave copies of pool data around
+	for i := range buf {
+		buf[i] = 0
+	}
+}
+
+// read serves random data from the pool, requests which exceed the pool
+// available data read the remaining part directly from the RNGB. Consumed
+// pool bytes are zeroed.
+func (p *rngPool) read(b []byte) {
+	p.Lock()
+
+	n := len(b)
+
+	if n > p.n {
+		n = p.n
+	}
+
+	// serve from the end of the available data
+	copy(b, p.buf[p.n-n:p.n])
+
+	for i := p.n - n; i < p.n; i++ {
+		p.buf[i] = 0
+	}
+
+	p.n -= n
+	low := p.n < len(p.buf)/2
+
+	p.Unlock()
+
+	if n < len(b) {
+		rngb.GetRandomData(b[n:])
+	}
+
+	if !low {
+		return
+	}
+
+	if p.refill == nil {
+		p.fill()
+		return
+	}
+
+	select {
+	case p.refill <- struct{}{}:
+	default:
+	}
+}
@@ -10,13 +10,22 @@
 // Package rngb implements a driver for the NXP True Random Number Generator
 // (RNGB) included in i.MX6ULL/i.MX6ULZ SoCs.
 //
+// The RNGB output is always post-processed, as the entropy source is only
+// used to seed its internal pseudo-random number generator, and no raw
+// (unconditioned) entropy output mode is available. Therefore output
+// whitening cannot be disabled and applications which require raw entropy,
+// to run their own health tests and conditioning, cannot use this module as
+// source.
+//
 // This package is only meant to be used with `GOOS=tamago GOARCH=arm` as
 // supported by the TamaGo framework for bare metal Go on ARM SoCs, see
 // https://github.com/f-secure-foundry/tamago.
 package rngb
 
 import (
+	"errors"
 	"sync"
+	"time"
 
 	"github.com/f-secure-foundry/tamago/internal/reg"
 )
@@ -46,7 +55,19 @@ const (
 	RNG_OUT = RNG_BASE + 0x14
 )
 
+// Output read modes (see SetReadMode())
+const (
+	// drain all available FIFO words for each status poll
+	READ_FIFO = iota
+	// read a single word for each status poll
+	READ_REGISTER
+)
+
+// self-test timeout, after runtime initialization
+const selfTestTimeout = 100 * time.Millisecond
+
 var mux sync.Mutex
+var readMode = READ_FIFO
 
 // Reset resets the RNGB module.
 func Reset() {
@@ -77,7 +98,7 @@ func Init() {
 		// reg.Wait cannot be used before runtime initialization
 	}
 
-	if reg.Get(RNG_SR, RNG_SR_ERR, 1) != 0 || reg.Get(RNG_SR, RNG_SR_ST_PF, 1) != 0 {
+	if selfTestFailed() {
 		panic("imx6_rng: self-test failure\n")
 	}
 
@@ -91,20 +112,104 @@ func Init() {
 	}
 }
 
-// GetRandomData returns len(b) random bytes gathered from the RNGB module.
+func selfTestFailed() bool {
+	return reg.Get(RNG_SR, RNG_SR_ERR, 1) != 0 || reg.Get(RNG_SR, RNG_SR_ST_PF, 1) != 0
+}
+
+// SelfTest runs the RNGB built-in self-test, which verifies the entropy
+// source and the pseudo-random number generator by comparison with known
+// answers, and returns an error on failure.
+//
+// The self-test is also performed at initialization (see Init()), where a
+// failure causes a panic, this function allows applications to verify the
+// module health at any time afterwards (e.g. before generating long-term
+// keys). The module must be initialized and the runtime must be running.
+//
+// The self-test holds the module lock, shared with Read() and
+// GetRandomData(), which therefore wait for its completion rather than
+// reading the output FIFO while the module is in test mode.
+func SelfTest() (err error) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	// clear errors
+	reg.Set(RNG_CMD, RNG_CMD_CE)
+	// perform self-test
+	reg.Set(RNG_CMD, RNG_CMD_ST)
+
+	if !reg.WaitFor(selfTestTimeout, RNG_SR, RNG_SR_STDN, 1, 1) {
+		return errors.New("self-test timeout")
+	}
+
+	if selfTestFailed() {
+		return errors.New("self-test failure")
+	}
+
+	return
+}
+
+// SetReadMode selects how the RNGB output, which is only exposed through the
+// RNG_OUT read port of its 16 word output FIFO, is gathered by
+// GetRandomData().
+//
+// The default READ_FIFO mode drains, for each status register poll, all words
+// available in the FIFO, minimizing MMIO accesses for maximum throughput on
+// bulk requests (e.g. TLS handshakes). The READ_REGISTER mode reads a single
+// word for each status poll, checking the error status for each one, which
+// minimizes the work performed for a single word request (e.g. a nonce).
+func SetReadMode(mode int) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	switch mode {
+	case READ_FIFO, READ_REGISTER:
+		readMode = mode
+	}
+}
+
+// GetRandomData returns len(b) random bytes gathered from the RNGB module, a
+// panic occurs if the module reports an error.
 func GetRandomData(b []byte) {
+	if _, err := Read(b); err != nil {
+		panic("imx6_rng: error during getRandomData\n")
+	}
+}
+
+// Read fills b with random bytes gathered from the RNGB module, it implements
+// io.Reader. Unlike GetRandomData() an error is returned, rather than a
+// panic, if the module reports an error (e.g. a failed self-test or reseed).
+//
+// The output FIFO is read with the module lock held, so that concurrent
+// readers (e.g. the runtime random data buffer refill) do not interleave
+// their reads.
+func Read(b []byte) (n int, err error) {
+	mux.Lock()
+	defer mux.Unlock()
+
 	read := 0
 	need := len(b)
 
 	for read < need {
-		if reg.Get(RNG_SR, RNG_SR_ERR, 1) != 0 {
-			panic("imx6_rng: error during getRandomData\n")
+		sr := reg.Read(RNG_SR)
+
+		if (sr>>RNG_SR_ERR)&1 != 0 {
+			return read, errors.New("RNGB error")
 		}
 
-		if reg.Get(RNG_SR, RNG_SR_FIFO_LVL, 0b1111) > 0 {
+		// the FIFO level cannot decrease before the words are
+		// drained, as the FIFO is only read with the lock held
+		words := int((sr >> RNG_SR_FIFO_LVL) & 0b1111)
+
+		if words > 1 && readMode == READ_REGISTER {
+			words = 1
+		}
+
+		for ; words > 0 && read < need; words-- {
 			read = Fill(b, read, reg.Read(RNG_OUT))
 		}
 	}
+
+	return read, nil
 }
 
 func Fill(b []byte, index int, val uint32) int {
@@ -0,0 +1,201 @@
+// NXP Secure Non Volatile Storage (SNVS) Secure Real Time Counter (SRTC)
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/f-secure-foundry/tamago/internal/reg"
+)
+
+// SNVS low power domain registers
+// (SNVS Memory Map/Register Definition, IMX6ULLRM).
+const (
+	SNVS_LP_BASE = 0x020cc000
+
+	SNVS_LPCR     = SNVS_LP_BASE + 0x38
+	LPCR_LPWUI_EN = 3
+	LPCR_MC_ENV   = 2
+	LPCR_LPTA_EN  = 1
+	LPCR_SRTC_ENV = 0
+
+	SNVS_LPSR = SNVS_LP_BASE + 0x4c
+	LPSR_ESVD = 16
+	LPSR_PGD  = 3
+	LPSR_MCR  = 2
+	LPSR_LPTA = 0
+
+	SNVS_LPSRTCMR = SNVS_LP_BASE + 0x50
+	SNVS_LPSRTCLR = SNVS_LP_BASE + 0x54
+	SNVS_LPTAR    = SNVS_LP_BASE + 0x58
+	SNVS_LPSMCMR  = SNVS_LP_BASE + 0x5c
+	SNVS_LPSMCLR  = SNVS_LP_BASE + 0x60
+
+	// The SRTC is a 47-bit counter clocked at 32768 Hz.
+	SRTC_FREQ  = 32768
+	SRTC_SHIFT = 15
+)
+
+type rtc struct {
+	sync.Mutex
+
+	// alarm cancellation
+	cancel chan bool
+}
+
+// RTC represents the SNVS Secure Real Time Counter instance.
+//
+// The counter is part of the SNVS low power domain, it is therefore retained
+// across resets and low power modes but it is reset on power loss unless a
+// coin cell battery supplies the SNVS domain.
+var RTC = &rtc{}
+
+// Init enables the Secure Real Time Counter.
+func (r *rtc) Init() {
+	r.Lock()
+	defer r.Unlock()
+
+	reg.Set(SNVS_LPCR, LPCR_SRTC_ENV)
+	reg.Wait(SNVS_LPCR, LPCR_SRTC_ENV, 1, 1)
+}
+
+func (r *rtc) counter() uint64 {
+	var prev uint64
+
+	// the counter is read until two consecutive values match, as it is
+	// split across two registers
+	for {
+		msb := uint64(reg.Read(SNVS_LPSRTCMR) & 0x7fff)
+		lsb := uint64(reg.Read(SNVS_LPSRTCLR))
+		cnt := msb<<32 | lsb
+
+		if cnt == prev {
+			return cnt
+		}
+
+		prev = cnt
+	}
+}
+
+// Now returns the time represented by the Secure Real Time Counter, as set
+// with Set() or as elapsed since its last reset.
+func (r *rtc) Now() time.Time {
+	cnt := r.counter()
+	sec := int64(cnt >> SRTC_SHIFT)
+	nsec := (int64(cnt&(SRTC_FREQ-1)) * 1e9) / SRTC_FREQ
+
+	return time.Unix(sec, nsec)
+}
+
+// Set sets the Secure Real Time Counter to the argument time.
+func (r *rtc) Set(t time.Time) {
+	r.Lock()
+	defer r.Unlock()
+
+	cnt := uint64(t.Unix())<<SRTC_SHIFT | uint64(t.Nanosecond())*SRTC_FREQ/1e9
+
+	// the counter can only be written while disabled
+	reg.Clear(SNVS_LPCR, LPCR_SRTC_ENV)
+	reg.Wait(SNVS_LPCR, LPCR_SRTC_ENV, 1, 0)
+
+	reg.Write(SNVS_LPSRTCMR, uint32(cnt>>32)&0x7fff)
+	reg.Write(SNVS_LPSRTCLR, uint32(cnt))
+
+	reg.Set(SNVS_LPCR, LPCR_SRTC_ENV)
+	reg.Wait(SNVS_LPCR, LPCR_SRTC_ENV, 1, 1)
+}
+
+// SetAlarm programs the SNVS time alarm to the argument time, with seconds
+// resolution, and invokes the argument function, in its own goroutine, once
+// the alarm is triggered. Any previously set alarm is cancelled.
+//
+// The alarm asserts the SNVS interrupt and can therefore resume the SoC from
+// low power mode (see WakeSource()).
+//
+// The Secure Real Time Counter must be enabled (see Init()).
+func (r *rtc) SetAlarm(t time.Time, fn func()) (err error) {
+	r.Lock()
+	defer r.Unlock()
+
+	if reg.Get(SNVS_LPCR, LPCR_SRTC_ENV, 1) == 0 {
+		return errors.New("SRTC not enabled")
+	}
+
+	sec := t.Unix()
+
+	if sec <= r.Now().Unix() || sec > 0xffffffff {
+		return errors.New("invalid alarm time")
+	}
+
+	r.cancelAlarm()
+
+	// the alarm register can only be written while disabled
+	reg.Write(SNVS_LPTAR, uint32(sec))
+	// clear any previous alarm event
+	reg.Write(SNVS_LPSR, 1<<LPSR_LPTA)
+
+	reg.Set(SNVS_LPCR, LPCR_LPWUI_EN)
+	reg.Set(SNVS_LPCR, LPCR_LPTA_EN)
+
+	r.cancel = make(chan bool)
+
+	go func(cancel chan bool) {
+		if !reg.WaitSignal(cancel, SNVS_LPSR, LPSR_LPTA, 1, 1) {
+			return
+		}
+
+		r.Lock()
+
+		if r.cancel != cancel {
+			// superseded by another alarm
+			r.Unlock()
+			return
+		}
+
+		reg.Clear(SNVS_LPCR, LPCR_LPTA_EN)
+		reg.Write(SNVS_LPSR, 1<<LPSR_LPTA)
+		r.cancel = nil
+		r.Unlock()
+
+		if fn != nil {
+			fn()
+		}
+	}(r.cancel)
+
+	return
+}
+
+// CancelAlarm disables any previously set alarm.
+func (r *rtc) CancelAlarm() {
+	r.Lock()
+	defer r.Unlock()
+
+	r.cancelAlarm()
+}
+
+func (r *rtc) cancelAlarm() {
+	if r.cancel != nil {
+		close(r.cancel)
+		r.cancel = nil
+	}
+
+	reg.Clear(SNVS_LPCR, LPCR_LPTA_EN)
+	reg.Wait(SNVS_LPCR, LPCR_LPTA_EN, 1, 0)
+}
+
+// WakeSource returns the SNVS time alarm wake-up source for low power mode
+// (see Suspend() and SetAlarm()).
+func (r *rtc) WakeSource() WakeSource {
+	return WakeSource{
+		IRQ: SNVS_IRQ,
+	}
+}
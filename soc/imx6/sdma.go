@@ -0,0 +1,577 @@
+// NXP Smart Direct Memory Access Controller (SDMA) driver
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/f-secure-foundry/tamago/dma"
+	"github.com/f-secure-foundry/tamago/internal/reg"
+)
+
+// SDMA registers
+// (SDMA Memory Map/Register Definition, IMX6ULLRM).
+const (
+	SDMA_BASE = 0x020ec000
+
+	SDMAARM_MC0PTR    = SDMA_BASE + 0x000
+	SDMAARM_INTR      = SDMA_BASE + 0x004
+	SDMAARM_STOP_STAT = SDMA_BASE + 0x008
+	SDMAARM_HSTART    = SDMA_BASE + 0x00c
+	SDMAARM_EVTOVR    = SDMA_BASE + 0x010
+	SDMAARM_DSPOVR    = SDMA_BASE + 0x014
+	SDMAARM_HOSTOVR   = SDMA_BASE + 0x018
+
+	SDMAARM_CONFIG = SDMA_BASE + 0x038
+	CONFIG_ACR     = 4
+	CONFIG_CSM     = 0
+
+	SDMAARM_CHN0ADDR = SDMA_BASE + 0x05c
+	CHN0ADDR_SMSZ    = 14
+	CHN0ADDR_ADDR    = 0
+
+	SDMAARM_SDMA_CHNPRI0 = SDMA_BASE + 0x100
+	SDMAARM_CHNENBL0     = SDMA_BASE + 0x200
+
+	CCM_CCGR5 = 0x020c407c
+	CCGR5_CG3 = 6
+
+	SDMA_CHANNELS = 32
+	SDMA_EVENTS   = 48
+)
+
+// SDMA ROM script addresses, the scripts run on the SDMA core to implement
+// the different transfer types.
+const (
+	SDMA_AP_2_AP    = 642
+	SDMA_APP_2_MCU  = 683
+	SDMA_MCU_2_APP  = 747
+	SDMA_UART_2_MCU = 817
+	SDMA_SHP_2_MCU  = 891
+	SDMA_MCU_2_SHP  = 960
+
+	// channel 0 boot script
+	SDMA_BOOT = 0x050
+)
+
+// SDMA buffer descriptor commands and status flags
+// (SDMA Buffer Descriptor Format, IMX6ULLRM).
+const (
+	// channel 0 commands
+	C0_SETDM = 0x01
+
+	BD_DONE = 0x01
+	BD_WRAP = 0x02
+	BD_CONT = 0x04
+	BD_INTR = 0x08
+	BD_RROR = 0x10
+	BD_LAST = 0x20
+	BD_EXTD = 0x80
+
+	// maximum transfer size for a single buffer descriptor
+	BD_MAX_COUNT = 0xfffc
+)
+
+const (
+	// channel control block size
+	ccbSize = 16
+	// buffer descriptor size
+	bdSize = 12
+	// channel context size
+	contextSize = 128
+	// channel context location in SDMA data memory (words)
+	contextBase = 2048
+
+	// channel dedicated to memory-to-memory transfers
+	memcpyChannel = 1
+	// first channel dedicated to peripheral transfers
+	peripheralChannel = 2
+	// first channel dedicated to continuous peripheral transfers
+	cyclicChannel = 24
+
+	// channel priorities (0 disables the channel)
+	cmdPriority        = 7
+	memcpyPriority     = 1
+	peripheralPriority = 2
+)
+
+// SDMATimeout is the default timeout for SDMA transfers.
+var SDMATimeout = 1 * time.Second
+
+// bufferDescriptor represents an SDMA buffer descriptor.
+type bufferDescriptor struct {
+	// count (0-15), status (16-23), command (24-31)
+	Mode                  uint32
+	BufferAddress         uint32
+	ExtendedBufferAddress uint32
+}
+
+// Bytes converts the buffer descriptor structure to byte array format.
+func (bd *bufferDescriptor) Bytes() []byte {
+	buf := make([]byte, bdSize)
+
+	binary.LittleEndian.PutUint32(buf[0:], bd.Mode)
+	binary.LittleEndian.PutUint32(buf[4:], bd.BufferAddress)
+	binary.LittleEndian.PutUint32(buf[8:], bd.ExtendedBufferAddress)
+
+	return buf
+}
+
+type sdma struct {
+	sync.Mutex
+
+	// channel control blocks
+	ccb uint32
+	// channel 0 buffer descriptor
+	bd0 uint32
+}
+
+// SDMA represents the Smart Direct Memory Access Controller instance.
+var SDMA = &sdma{}
+
+// Init initializes the SDMA controller, loading channel 0 with the ROM boot
+// script to handle channel context loading.
+func (hw *sdma) Init() {
+	hw.Lock()
+	defer hw.Unlock()
+
+	RegisterRegion("SDMA", SDMA_BASE, AIPS_SLOT_SIZE)
+
+	// enable clock
+	EnableClock(CLOCK_SDMA)
+
+	// ensure that the SDMA core is not running
+	reg.Write(SDMAARM_MC0PTR, 0)
+
+	// disable all events and channels
+	for i := uint32(0); i < SDMA_EVENTS; i++ {
+		reg.Write(SDMAARM_CHNENBL0+4*i, 0)
+	}
+
+	for i := uint32(0); i < SDMA_CHANNELS; i++ {
+		reg.Write(SDMAARM_SDMA_CHNPRI0+4*i, 0)
+	}
+
+	if hw.bd0 == 0 {
+		hw.bd0 = dma.Alloc(make([]byte, bdSize), 4)
+		hw.ccb = dma.Alloc(make([]byte, SDMA_CHANNELS*ccbSize), 4)
+	}
+
+	hw.setBufferDescriptors(0, hw.bd0)
+	hw.setOwnership(0, false)
+
+	// set channel 0 boot script, with 32 words scratch memory per channel
+	reg.Write(SDMAARM_CHN0ADDR, 1<<CHN0ADDR_SMSZ|SDMA_BOOT<<CHN0ADDR_ADDR)
+
+	// static context switching, AHB and SDMA core clocks with 2:1 ratio
+	reg.Write(SDMAARM_CONFIG, 0)
+
+	reg.Write(SDMAARM_MC0PTR, hw.ccb)
+	reg.Write(SDMAARM_SDMA_CHNPRI0, cmdPriority)
+}
+
+// setBufferDescriptors sets the buffer descriptors address for a channel
+// control block.
+func (hw *sdma) setBufferDescriptors(ch int, addr uint32) {
+	buf := make([]byte, 8)
+
+	// current buffer descriptor
+	binary.LittleEndian.PutUint32(buf[0:], addr)
+	// base buffer descriptor
+	binary.LittleEndian.PutUint32(buf[4:], addr)
+
+	dma.Write(hw.ccb, buf, ch*ccbSize)
+}
+
+// setOwnership configures a channel to be started by the ARM core, without
+// any DSP control, and optionally triggered by DMA request events.
+func (hw *sdma) setOwnership(ch int, events bool) {
+	if events {
+		reg.Clear(SDMAARM_EVTOVR, ch)
+	} else {
+		reg.Set(SDMAARM_EVTOVR, ch)
+	}
+
+	reg.Set(SDMAARM_DSPOVR, ch)
+	reg.Clear(SDMAARM_HOSTOVR, ch)
+}
+
+// runChannel0 executes a single channel 0 command.
+func (hw *sdma) runChannel0(cmd uint32, addr uint32, count int, ext uint32) (err error) {
+	bd := &bufferDescriptor{
+		Mode:                  cmd<<24 | (BD_DONE|BD_WRAP|BD_EXTD)<<16 | uint32(count),
+		BufferAddress:         addr,
+		ExtendedBufferAddress: ext,
+	}
+
+	dma.Write(hw.bd0, bd.Bytes(), 0)
+
+	reg.Write(SDMAARM_HSTART, 1)
+
+	if !reg.WaitFor(SDMATimeout, SDMAARM_STOP_STAT, 0, 1, 0) {
+		return errors.New("SDMA channel 0 timeout")
+	}
+
+	// clear interrupt status
+	reg.Write(SDMAARM_INTR, 1)
+
+	// enable dynamic context switching once the first context is loaded
+	reg.SetN(SDMAARM_CONFIG, CONFIG_CSM, 0b11, 0b11)
+
+	return
+}
+
+// loadContext loads a channel context with the argument script address and
+// general purpose register values.
+func (hw *sdma) loadContext(ch int, pc uint32, gr [8]uint32) (err error) {
+	buf := make([]byte, contextSize)
+
+	// channel state, program counter
+	binary.LittleEndian.PutUint32(buf[0:], pc&0x3fff)
+
+	// general purpose registers
+	for i, r := range gr {
+		binary.LittleEndian.PutUint32(buf[8+i*4:], r)
+	}
+
+	addr := dma.Alloc(buf, 4)
+	defer dma.Free(addr)
+
+	return hw.runChannel0(C0_SETDM, addr, contextSize/4, contextBase+uint32(ch*contextSize/4))
+}
+
+// start runs a channel and waits for completion of its buffer descriptors,
+// returning an error on timeout or if any of them reports an error.
+func (hw *sdma) start(ch int, bds []byte, addr uint32) (err error) {
+	hw.enable(ch, addr)
+	return hw.wait(ch, bds, addr)
+}
+
+// enable sets the buffer descriptors of a channel and starts it.
+func (hw *sdma) enable(ch int, addr uint32) {
+	hw.setBufferDescriptors(ch, addr)
+
+	// clear interrupt status
+	reg.Write(SDMAARM_INTR, 1<<ch)
+	// start channel
+	reg.Write(SDMAARM_HSTART, 1<<ch)
+}
+
+// wait waits for completion of the buffer descriptors of a running channel,
+// returning an error on timeout or if any of them reports an error.
+func (hw *sdma) wait(ch int, bds []byte, addr uint32) (err error) {
+	if !reg.WaitFor(SDMATimeout, SDMAARM_INTR, ch, 1, 1) {
+		// stop channel
+		reg.Write(SDMAARM_STOP_STAT, 1<<ch)
+		return fmt.Errorf("SDMA transfer %w", ErrTimeout)
+	}
+
+	reg.Write(SDMAARM_INTR, 1<<ch)
+
+	dma.Read(addr, 0, bds)
+
+	for off := 0; off < len(bds); off += bdSize {
+		status := bds[off+2]
+
+		if status&BD_RROR != 0 {
+			return errors.New("SDMA transfer error")
+		}
+	}
+
+	return
+}
+
+// copy performs a memory-to-memory transfer using the ap_2_ap ROM script.
+func (hw *sdma) copy(dst uint32, src uint32, n int) (err error) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	if hw.ccb == 0 {
+		return errors.New("SDMA controller is not initialized")
+	}
+
+	var bds []byte
+
+	for off := 0; off < n; off += BD_MAX_COUNT {
+		size := n - off
+		status := uint32(BD_DONE | BD_EXTD)
+
+		if size > BD_MAX_COUNT {
+			size = BD_MAX_COUNT
+			status |= BD_CONT
+		} else {
+			status |= BD_INTR | BD_LAST
+		}
+
+		// command 0 selects 32-bit transfers
+		bd := &bufferDescriptor{
+			Mode:                  status<<16 | uint32(size),
+			BufferAddress:         src + uint32(off),
+			ExtendedBufferAddress: dst + uint32(off),
+		}
+
+		bds = append(bds, bd.Bytes()...)
+	}
+
+	addr := dma.Alloc(bds, 4)
+	defer dma.Free(addr)
+
+	hw.setOwnership(memcpyChannel, false)
+	reg.Write(SDMAARM_SDMA_CHNPRI0+4*memcpyChannel, memcpyPriority)
+
+	if err = hw.loadContext(memcpyChannel, SDMA_AP_2_AP, [8]uint32{}); err != nil {
+		return
+	}
+
+	return hw.start(memcpyChannel, bds, addr)
+}
+
+// buildBufferDescriptors returns the buffer descriptors for a transfer of n
+// bytes from/to a memory address, the command selects the transfer width.
+func buildBufferDescriptors(cmd uint32, addr uint32, n int) (bds []byte) {
+	for off := 0; off < n; off += BD_MAX_COUNT {
+		size := n - off
+		status := uint32(BD_DONE)
+
+		if size > BD_MAX_COUNT {
+			size = BD_MAX_COUNT
+			status |= BD_CONT
+		} else {
+			status |= BD_INTR | BD_LAST
+		}
+
+		bd := &bufferDescriptor{
+			Mode:          cmd<<24 | status<<16 | uint32(size),
+			BufferAddress: addr + uint32(off),
+		}
+
+		bds = append(bds, bd.Bytes()...)
+	}
+
+	return
+}
+
+// sdmaTransfer represents a peripheral transfer, between memory and a
+// peripheral FIFO, paced by the peripheral DMA request event.
+type sdmaTransfer struct {
+	// ROM script (e.g. SDMA_MCU_2_APP, SDMA_APP_2_MCU)
+	script uint32
+	// DMA request event
+	event int
+	// peripheral FIFO address
+	fifo uint32
+	// watermark level (bytes)
+	wml int
+	// buffer descriptor command (transfer width)
+	cmd uint32
+
+	// memory buffer address and size
+	addr uint32
+	size int
+}
+
+// context returns the channel general purpose register values for the
+// peripheral transfer ROM scripts.
+func (x *sdmaTransfer) context() (gr [8]uint32) {
+	// event mask
+	if x.event < 32 {
+		gr[1] = 1 << x.event
+	} else {
+		gr[0] = 1 << (x.event - 32)
+	}
+
+	// peripheral address
+	gr[2] = x.fifo
+	// watermark level
+	gr[7] = uint32(x.wml)
+
+	return
+}
+
+// transfer runs peripheral transfers, each on its own event driven channel,
+// the argument function is invoked once all channels are ready to enable the
+// peripheral DMA requests. The function returns after completion of all
+// transfers, or on the first error.
+func (hw *sdma) transfer(trigger func(), xfers ...*sdmaTransfer) (err error) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	if hw.ccb == 0 {
+		return errors.New("SDMA controller is not initialized")
+	}
+
+	if peripheralChannel+len(xfers) > cyclicChannel {
+		return errors.New("invalid transfer count")
+	}
+
+	bds := make([][]byte, len(xfers))
+	addr := make([]uint32, len(xfers))
+
+	for i, x := range xfers {
+		ch := peripheralChannel + i
+
+		bds[i] = buildBufferDescriptors(x.cmd, x.addr, x.size)
+		addr[i] = dma.Alloc(bds[i], 4)
+		defer dma.Free(addr[i])
+
+		hw.setOwnership(ch, true)
+		reg.Write(SDMAARM_SDMA_CHNPRI0+4*uint32(ch), peripheralPriority)
+
+		if err = hw.loadContext(ch, x.script, x.context()); err != nil {
+			return
+		}
+
+		evt := SDMAARM_CHNENBL0 + 4*uint32(x.event)
+		reg.Set(evt, ch)
+		defer reg.Clear(evt, ch)
+
+		hw.enable(ch, addr[i])
+	}
+
+	trigger()
+
+	for i := range xfers {
+		ch := peripheralChannel + i
+
+		if err = hw.wait(ch, bds[i], addr[i]); err != nil {
+			for j := i; j < len(xfers); j++ {
+				reg.Write(SDMAARM_STOP_STAT, 1<<(peripheralChannel+j))
+			}
+
+			return
+		}
+	}
+
+	return
+}
+
+// cyclicDescriptor returns the buffer descriptor for a period, of a
+// continuous peripheral transfer split in the argument number of periods.
+func cyclicDescriptor(x *sdmaTransfer, period int, periods int) *bufferDescriptor {
+	size := x.size / periods
+	status := uint32(BD_DONE | BD_INTR | BD_CONT)
+
+	if period == periods-1 {
+		status |= BD_WRAP
+	}
+
+	return &bufferDescriptor{
+		Mode:          x.cmd<<24 | status<<16 | uint32(size),
+		BufferAddress: x.addr + uint32(period*size),
+	}
+}
+
+// startCyclic starts a continuous peripheral transfer on a dedicated channel,
+// the memory buffer is split in periods, each described by a buffer
+// descriptor raising the channel interrupt on completion (see SDMA_IRQ).
+//
+// Completed descriptors (BD_DONE clear) must be returned to the SDMA, once
+// their data is consumed, with rearm(). The returned buffer descriptors
+// address is released by stopCyclic().
+func (hw *sdma) startCyclic(ch int, x *sdmaTransfer, periods int) (bds uint32, err error) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	if hw.ccb == 0 {
+		return 0, errors.New("SDMA controller is not initialized")
+	}
+
+	if ch < cyclicChannel || ch >= SDMA_CHANNELS {
+		return 0, errors.New("invalid channel")
+	}
+
+	if periods <= 0 || x.size/periods > BD_MAX_COUNT {
+		return 0, errors.New("invalid period count")
+	}
+
+	var buf []byte
+
+	for i := 0; i < periods; i++ {
+		buf = append(buf, cyclicDescriptor(x, i, periods).Bytes()...)
+	}
+
+	bds = dma.Alloc(buf, 4)
+
+	hw.setOwnership(ch, true)
+	reg.Write(SDMAARM_SDMA_CHNPRI0+4*uint32(ch), peripheralPriority)
+
+	if err = hw.loadContext(ch, x.script, x.context()); err != nil {
+		dma.Free(bds)
+		return 0, err
+	}
+
+	reg.Set(SDMAARM_CHNENBL0+4*uint32(x.event), ch)
+
+	hw.enable(ch, bds)
+
+	return
+}
+
+// rearm returns a completed period of a continuous peripheral transfer to the
+// SDMA, restarting the channel in case it stopped due to lack of available
+// buffer descriptors.
+func (hw *sdma) rearm(ch int, bds uint32, x *sdmaTransfer, period int, periods int) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	dma.Write(bds, cyclicDescriptor(x, period, periods).Bytes(), period*bdSize)
+
+	// clear interrupt status
+	reg.Write(SDMAARM_INTR, 1<<ch)
+	// (re)start channel
+	reg.Write(SDMAARM_HSTART, 1<<ch)
+}
+
+// stopCyclic stops a continuous peripheral transfer, releasing its buffer
+// descriptors.
+func (hw *sdma) stopCyclic(ch int, bds uint32, x *sdmaTransfer) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	reg.Clear(SDMAARM_CHNENBL0+4*uint32(x.event), ch)
+	reg.Write(SDMAARM_STOP_STAT, 1<<ch)
+	reg.Write(SDMAARM_SDMA_CHNPRI0+4*uint32(ch), 0)
+	reg.Write(SDMAARM_INTR, 1<<ch)
+
+	dma.Free(bds)
+}
+
+// DMACopy copies n bytes from the src to the dst memory addresses using the
+// SDMA memory-to-memory channel, the SDMA controller must be initialized (see
+// SDMA.Init()).
+//
+// The addresses and size must be 32-bit aligned, the caller must ensure that
+// both memory ranges are not used by the Go runtime for the transfer duration
+// (e.g. by allocating them with the dma package).
+//
+// The data cache is flushed before and after the transfer, to ensure
+// coherency of both memory ranges with the SDMA view of memory. Given such
+// overhead and the channel context load required for each transfer, copying
+// with the CPU is faster for small buffers, the crossover size depends on the
+// ARM core frequency and the memory type and location, it is measured and
+// reported by Benchmark() on the target configuration.
+func DMACopy(dst uint32, src uint32, n int) (err error) {
+	if n <= 0 {
+		return errors.New("invalid size")
+	}
+
+	if dst&3 != 0 || src&3 != 0 || n&3 != 0 {
+		return errors.New("addresses and size must be 32-bit aligned")
+	}
+
+	ARM.CacheFlushData()
+	defer ARM.CacheFlushData()
+
+	return SDMA.copy(dst, src, n)
+}
@@ -0,0 +1,78 @@
+// NXP i.MX6 bring-up diagnostics
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/f-secure-foundry/tamago/internal/reg"
+)
+
+// SelfCheck verifies that initialized peripherals respond at their expected
+// addresses, by reading back registers whose value is set by the driver
+// initialization. A message is logged for each peripheral which does not
+// respond (e.g. on a binary built for a different board or SoC) and an error
+// is returned if any check fails.
+//
+// Only initialized peripherals are checked, as accessing a peripheral whose
+// clock is gated might stall the bus.
+func SelfCheck() (err error) {
+	var failures int
+
+	fail := func(name string, addr uint32) {
+		log.Printf("imx6: %s not responding at %#x", name, addr)
+		failures++
+	}
+
+	switch Family {
+	case IMX6Q, IMX6UL, IMX6ULL:
+	default:
+		log.Printf("imx6: unknown processor family %#x", Family)
+		failures++
+	}
+
+	for _, uart := range UARTs() {
+		// the incremental numerator is set by the baud rate solver
+		if reg.Read(uart.ubir) != uart.rate.Num-1 {
+			fail(fmt.Sprintf("UART%d", uart.n), uart.ubir-UARTx_UBIR)
+		}
+	}
+
+	for _, i2c := range []*I2C{I2C1, I2C2, I2C3, I2C4} {
+		if i2c.ifdr == 0 {
+			continue
+		}
+
+		if reg.Read16(i2c.ifdr) != i2c.dividerCode() {
+			fail(fmt.Sprintf("I2C%d", i2c.n), i2c.ifdr-I2Cx_IFDR)
+		}
+	}
+
+	for _, spi := range []*ECSPI{ECSPI1, ECSPI2, ECSPI3, ECSPI4} {
+		if spi.conreg == 0 {
+			continue
+		}
+
+		if reg.Get(spi.conreg, CONREG_EN, 1) != 1 {
+			fail(fmt.Sprintf("ECSPI%d", spi.n), spi.conreg-ECSPIx_CONREG)
+		}
+	}
+
+	if SDMA.ccb != 0 && reg.Read(SDMAARM_MC0PTR) != SDMA.ccb {
+		fail("SDMA", SDMA_BASE)
+	}
+
+	if failures > 0 {
+		err = fmt.Errorf("%d self-check failures", failures)
+	}
+
+	return
+}
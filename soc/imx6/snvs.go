@@ -10,20 +10,66 @@
 package imx6
 
 import (
+	"errors"
+
 	"github.com/f-secure-foundry/tamago/bits"
 	"github.com/f-secure-foundry/tamago/internal/reg"
 )
 
 const (
+	SNVS_HPCOMR_REG   = 0x020cc004
+	HPCOMR_NPSWA_EN   = 31
+	HPCOMR_SW_LPSV    = 10
+	HPCOMR_SW_FSV     = 9
+	HPCOMR_SW_SV      = 8
+	HPCOMR_SSM_ST_DIS = 1
+	HPCOMR_SSM_ST     = 0
+
 	SNVS_HPSR_REG       = 0x020cc014
 	HPSR_OTPMK_ZERO     = 27
 	HPSR_OTPMK_SYNDROME = 16
 
-	HPSR_SSM_STATE    = 8
-	SSM_STATE_TRUSTED = 0b1101
-	SSM_STATE_SECURE  = 0b1111
+	HPSR_SSM_STATE       = 8
+	SSM_STATE_INIT       = 0b0000
+	SSM_STATE_SOFT_FAIL  = 0b1000
+	SSM_STATE_HARD_FAIL  = 0b1001
+	SSM_STATE_NON_SECURE = 0b1011
+	SSM_STATE_CHECK      = 0b1100
+	SSM_STATE_TRUSTED    = 0b1101
+	SSM_STATE_SECURE     = 0b1111
+
+	SNVS_HPSVSR_REG     = 0x020cc018
+	HPSVSR_LP_SEC_VIO   = 31
+	HPSVSR_SW_LPSV      = 15
+	HPSVSR_SW_FSV       = 14
+	HPSVSR_SW_SV        = 13
+	HPSVSR_SECURITY_VIO = 0
 )
 
+// TamperState represents the SNVS security violation and tamper detection
+// status.
+type TamperState struct {
+	// Secure State Machine state (SSM_STATE_*)
+	SSM uint32
+	// security violation inputs (SV0-SV5) detected by the high power
+	// domain, their sources are SoC specific
+	Violations uint32
+	// software initiated security violation (see SecurityViolation())
+	Software bool
+	// security violation detected by the low power domain
+	LowPower bool
+	// power glitch detected by the low power domain
+	PowerGlitch bool
+	// external security violation detected by the low power domain
+	External bool
+}
+
+// Tampered returns whether any security violation, or tamper event, has been
+// detected.
+func (s TamperState) Tampered() bool {
+	return s.Violations != 0 || s.Software || s.LowPower || s.PowerGlitch || s.External
+}
+
 // SNVS verifies whether the Secure Non Volatile Storage (SNVS) is available in
 // Trusted or Secure state (indicating that Secure Boot is enabled).
 //
@@ -45,3 +91,129 @@ func SNVS() bool {
 		return false
 	}
 }
+
+// SSMState returns the SNVS Secure State Machine state (SSM_STATE_*).
+func SSMState() uint32 {
+	return reg.Get(SNVS_HPSR_REG, HPSR_SSM_STATE, 0b1111)
+}
+
+// SSMTransition requests a Secure State Machine transition, which moves the
+// SSM from Trusted to Secure state, or from Check to Non-Secure state. The
+// resulting state is returned.
+func SSMTransition() uint32 {
+	reg.Set(SNVS_HPCOMR_REG, HPCOMR_SSM_ST)
+	return SSMState()
+}
+
+// TamperStatus returns the SNVS security violation and tamper detection
+// status, firmware dealing with secret key material can use it to detect
+// physical attacks and zeroize its keys.
+func TamperStatus() (s TamperState) {
+	hpsvsr := reg.Read(SNVS_HPSVSR_REG)
+	lpsr := reg.Read(SNVS_LPSR)
+
+	s.SSM = SSMState()
+	s.Violations = bits.Get(&hpsvsr, HPSVSR_SECURITY_VIO, 0b111111)
+	s.Software = bits.Get(&hpsvsr, HPSVSR_SW_SV, 0b111) != 0
+	s.LowPower = bits.Get(&hpsvsr, HPSVSR_LP_SEC_VIO, 1) == 1
+	s.PowerGlitch = bits.Get(&lpsr, LPSR_PGD, 1) == 1
+	s.External = bits.Get(&lpsr, LPSR_ESVD, 1) == 1
+
+	return
+}
+
+// ClearTamperStatus clears the latched security violation and tamper
+// detection status bits, violation inputs which are still asserted are
+// detected again. The Secure State Machine state is not affected.
+func ClearTamperStatus() {
+	var hpsvsr uint32
+	var lpsr uint32
+
+	bits.SetN(&hpsvsr, HPSVSR_SECURITY_VIO, 0b111111, 0b111111)
+	bits.SetN(&hpsvsr, HPSVSR_SW_SV, 0b111, 0b111)
+	bits.Set(&hpsvsr, HPSVSR_LP_SEC_VIO)
+
+	bits.Set(&lpsr, LPSR_PGD)
+	bits.Set(&lpsr, LPSR_ESVD)
+
+	// write 1 to clear
+	reg.Write(SNVS_HPSVSR_REG, hpsvsr)
+	reg.Write(SNVS_LPSR, lpsr)
+}
+
+// SecurityViolation signals a software security violation to the Secure State
+// Machine, which moves to Soft Fail state, or Hard Fail state when fatal is
+// true, zeroizing the Zeroizable Master Key and blocking access to the OTPMK
+// (e.g. on detection of a tamper event). Leaving the Hard Fail state requires
+// a power-on reset.
+func SecurityViolation(fatal bool) {
+	if fatal {
+		reg.Set(SNVS_HPCOMR_REG, HPCOMR_SW_FSV)
+	} else {
+		reg.Set(SNVS_HPCOMR_REG, HPCOMR_SW_SV)
+	}
+}
+
+// MonotonicCounter returns the value of the SNVS Secure Monotonic Counter, a
+// 48-bit counter which can only be incremented (see
+// IncrementMonotonicCounter()), for use in firmware anti-rollback or
+// versioning schemes.
+//
+// The counter is held in the SNVS low power domain, therefore it retains its
+// value across resets and power cycles only as long as the domain remains
+// powered (e.g. by a coin cell battery), otherwise it is reset. Applications
+// requiring a counter which survives loss of all power must rely on fuses
+// (see ocotp.MonotonicCounter()).
+//
+// An error is returned if the counter has rolled over, as it can no longer be
+// trusted.
+func MonotonicCounter() (cnt uint64, err error) {
+	if reg.Get(SNVS_LPSR, LPSR_MCR, 1) == 1 {
+		return 0, errors.New("monotonic counter rollover")
+	}
+
+	var prev uint64
+
+	// the counter must be read until two consecutive reads match
+	for i := 0; ; i++ {
+		msb := uint64(reg.Read(SNVS_LPSMCMR) & 0xffff)
+		lsb := uint64(reg.Read(SNVS_LPSMCLR))
+
+		cnt = msb<<32 | lsb
+
+		if i > 0 && cnt == prev {
+			return
+		}
+
+		prev = cnt
+	}
+}
+
+// IncrementMonotonicCounter increments by one the SNVS Secure Monotonic
+// Counter (see MonotonicCounter()), the operation cannot be reverted.
+func IncrementMonotonicCounter() (err error) {
+	cnt, err := MonotonicCounter()
+
+	if err != nil {
+		return
+	}
+
+	if reg.Get(SNVS_LPCR, LPCR_MC_ENV, 1) == 0 {
+		reg.Set(SNVS_LPCR, LPCR_MC_ENV)
+	}
+
+	// any write to the counter registers increments it
+	reg.Write(SNVS_LPSMCLR, 0)
+
+	next, err := MonotonicCounter()
+
+	if err != nil {
+		return
+	}
+
+	if next != cnt+1 {
+		return errors.New("monotonic counter increment failed")
+	}
+
+	return
+}
@@ -0,0 +1,136 @@
+// NXP i.MX6 low power mode support
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"errors"
+
+	"github.com/f-secure-foundry/tamago/bits"
+	"github.com/f-secure-foundry/tamago/internal/reg"
+)
+
+// Low power control registers
+// (CCM Low Power Control Register (CCM_CLPCR), IMX6ULLRM).
+const (
+	CCM_CLPCR = 0x020c4054
+
+	CLPCR_MASK_L2CC_IDLE      = 27
+	CLPCR_MASK_SCU_IDLE       = 26
+	CLPCR_MASK_CORE0_WFI      = 22
+	CLPCR_BYP_MMDC_CH1_LPM_HS = 21
+	CLPCR_BYP_MMDC_CH0_LPM_HS = 19
+	CLPCR_VSTBY               = 8
+	CLPCR_SBYOS               = 6
+	CLPCR_ARM_CLK_DIS_ON_LPM  = 5
+	CLPCR_LPM                 = 0
+	LPM_RUN                   = 0b00
+	LPM_WAIT                  = 0b01
+	LPM_STOP                  = 0b10
+)
+
+// WakeSource represents an interrupt capable of resuming the SoC from low
+// power mode (see Suspend()).
+type WakeSource struct {
+	// Interrupt ID
+	IRQ int
+
+	// Arm, when set, is invoked before suspension to enable the wake-up
+	// signaling on the peripheral.
+	Arm func()
+
+	// Disarm, when set, is invoked after resume to disable the wake-up
+	// signaling on the peripheral.
+	Disarm func()
+}
+
+// setLPM configures the low power mode entered on the next WFI instruction
+// (Low power modes, CCM, IMX6ULLRM).
+func setLPM(mode uint32) {
+	clpcr := reg.Read(CCM_CLPCR)
+
+	bits.SetN(&clpcr, CLPCR_LPM, 0b11, mode)
+
+	if mode == LPM_RUN {
+		bits.Clear(&clpcr, CLPCR_ARM_CLK_DIS_ON_LPM)
+	} else {
+		bits.Set(&clpcr, CLPCR_ARM_CLK_DIS_ON_LPM)
+	}
+
+	// keep oscillator and regulators in run mode configuration
+	bits.Clear(&clpcr, CLPCR_SBYOS)
+	bits.Clear(&clpcr, CLPCR_VSTBY)
+
+	// Channel 0 LPM handshake places DDR in self-refresh, channel 1 is
+	// either absent or unused.
+	bits.Clear(&clpcr, CLPCR_BYP_MMDC_CH0_LPM_HS)
+	bits.Set(&clpcr, CLPCR_BYP_MMDC_CH1_LPM_HS)
+
+	// ERR007265: set a pending unmasked interrupt (IOMUXC GINT) to prevent
+	// low power mode entry before the WFI instruction is executed.
+	reg.Set(IOMUXC_GPR_GPR1, GPR1_GINT)
+	gpcMask(IOMUXC_IRQ, false)
+
+	reg.Write(CCM_CLPCR, clpcr)
+
+	gpcMask(IOMUXC_IRQ, true)
+	reg.Clear(IOMUXC_GPR_GPR1, GPR1_GINT)
+}
+
+// Suspend places the SoC in STOP low power mode, with DRAM in self-refresh,
+// until the argument wake-up source, or any other one enabled with
+// EnableWakeSource(), asserts its interrupt.
+//
+// Before suspension all wake-up interrupts are forwarded by the GIC, the
+// previous configuration is restored on resume. The wake-up interrupt is not
+// acknowledged and it is left pending to its driver, when IRQ exceptions are
+// unmasked its handler is executed on resume.
+//
+// The processor and peripheral registers are retained, however the following
+// state is lost and must be handled by the application:
+//   * any transfer in progress (DMA, serial ports, USB, uSDHC), as peripheral
+//     clocks are gated
+//   * the UART character, or characters, triggering a serial wake-up
+//   * USB sessions, as no remote wake-up signaling is performed
+//
+// The ARM generic timer keeps counting during suspension, the ARM Cortex-A9
+// global timer (i.MX6Q) does not.
+func Suspend(wake WakeSource) (err error) {
+	n := ARM.Interrupts()
+
+	if wake.IRQ < 32 || wake.IRQ >= n {
+		return errors.New("invalid wake-up source")
+	}
+
+	imr := gpcSave()
+	defer gpcRestore(imr)
+
+	gpcMask(wake.IRQ, false)
+
+	for id := 32; id < n; id++ {
+		if WakeSourceEnabled(id) && !ARM.InterruptEnabled(id) {
+			ARM.EnableInterrupt(id)
+			defer ARM.DisableInterrupt(id)
+		}
+	}
+
+	if wake.Arm != nil {
+		wake.Arm()
+	}
+
+	if wake.Disarm != nil {
+		defer wake.Disarm()
+	}
+
+	setLPM(LPM_STOP)
+	ARM.WaitInterrupt()
+	setLPM(LPM_RUN)
+
+	return
+}
@@ -0,0 +1,216 @@
+// NXP i.MX6 Temperature Monitor (TEMPMON) driver
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/f-secure-foundry/tamago/internal/reg"
+)
+
+// TEMPMON registers
+// (TEMPMON Memory Map/Register Definition, IMX6ULLRM).
+const (
+	TEMPMON_TEMPSENSE0 = 0x020c8180
+	TEMPSENSE0_ALARM   = 20
+	TEMPSENSE0_CNT     = 8
+	TEMPSENSE0_FINISH  = 2
+	TEMPSENSE0_MEASURE = 1
+	TEMPSENSE0_PD      = 0
+
+	TEMPMON_TEMPSENSE1 = 0x020c8190
+	TEMPSENSE1_FREQ    = 0
+
+	// not available on i.MX6Q
+	TEMPMON_TEMPSENSE2 = 0x020c8290
+	TEMPSENSE2_PANIC   = 16
+	TEMPSENSE2_LOW     = 0
+
+	// temperature sensor calibration fuses (OCOTP_ANA1 shadow register)
+	OCOTP_ANA1    = 0x021bc4e0
+	ANA1_ROOM_CNT = 20
+	ANA1_HOT_CNT  = 8
+	ANA1_HOT_TEMP = 0
+)
+
+const (
+	// calibration room temperature (°C)
+	tempRoom = 25
+	// measurement timeout
+	tempTimeout = 100 * time.Millisecond
+	// automatic measurement period (32 kHz clock cycles, ~0.5 s), used
+	// when alarms are armed
+	tempAlarmPeriod = 0x4000
+)
+
+type tempmon struct {
+	sync.Mutex
+
+	// calibration points
+	roomCount int64
+	hotCount  int64
+	hotTemp   int64
+
+	// armed alarms, requiring continuous measurement
+	armed bool
+}
+
+var tm tempmon
+
+// calibrate reads the per-chip calibration points, programmed in OCOTP fuses,
+// which are used to convert temperature sensor counts.
+func (t *tempmon) calibrate() (err error) {
+	if t.roomCount != 0 {
+		return
+	}
+
+	ana1 := reg.Read(OCOTP_ANA1)
+
+	room := int64(reg.Get(OCOTP_ANA1, ANA1_ROOM_CNT, 0xfff))
+	hot := int64(reg.Get(OCOTP_ANA1, ANA1_HOT_CNT, 0xfff))
+	hotTemp := int64(reg.Get(OCOTP_ANA1, ANA1_HOT_TEMP, 0xff))
+
+	if ana1 == 0 || ana1 == 0xffffffff || room <= hot || hotTemp <= tempRoom {
+		return errors.New("invalid temperature sensor calibration fuses")
+	}
+
+	t.roomCount = room
+	t.hotCount = hot
+	t.hotTemp = hotTemp
+
+	return
+}
+
+// celsius converts a temperature sensor count, the count decreases linearly
+// as temperature increases.
+func (t *tempmon) celsius(count int64) float64 {
+	return float64(t.hotTemp) - float64(count-t.hotCount)*float64(t.hotTemp-tempRoom)/float64(t.roomCount-t.hotCount)
+}
+
+// count converts a temperature to its temperature sensor count.
+func (t *tempmon) count(celsius float64) (n uint32, err error) {
+	c := float64(t.hotCount) + (float64(t.hotTemp)-celsius)*float64(t.roomCount-t.hotCount)/float64(t.hotTemp-tempRoom)
+
+	if c < 0 || c > 0xfff {
+		return 0, errors.New("temperature out of range")
+	}
+
+	return uint32(c), nil
+}
+
+// ReadTemperature measures the SoC junction temperature, in degrees Celsius,
+// with the on-die temperature sensor, converting its reading with the
+// per-chip calibration points programmed in OCOTP fuses
+// (Temperature Monitor (TEMPMON), IMX6ULLRM).
+//
+// An error is returned if the calibration fuses are not programmed (e.g.
+// under emulation) or if the measurement does not complete in time. The
+// sensor is powered down after the measurement, unless an alarm is armed
+// (see SetTemperatureAlarm()).
+func ReadTemperature() (celsius float64, err error) {
+	tm.Lock()
+	defer tm.Unlock()
+
+	if err = tm.calibrate(); err != nil {
+		return
+	}
+
+	if !tm.armed {
+		reg.Clear(TEMPMON_TEMPSENSE0, TEMPSENSE0_PD)
+		defer reg.Set(TEMPMON_TEMPSENSE0, TEMPSENSE0_PD)
+
+		// single measurement
+		reg.SetN(TEMPMON_TEMPSENSE1, TEMPSENSE1_FREQ, 0xffff, 0)
+		reg.Clear(TEMPMON_TEMPSENSE0, TEMPSENSE0_MEASURE)
+		reg.Set(TEMPMON_TEMPSENSE0, TEMPSENSE0_MEASURE)
+
+		defer reg.Clear(TEMPMON_TEMPSENSE0, TEMPSENSE0_MEASURE)
+	}
+
+	if !reg.WaitFor(tempTimeout, TEMPMON_TEMPSENSE0, TEMPSENSE0_FINISH, 1, 1) {
+		return 0, fmt.Errorf("temperature measurement %w", ErrTimeout)
+	}
+
+	count := int64(reg.Get(TEMPMON_TEMPSENSE0, TEMPSENSE0_CNT, 0xfff))
+
+	return tm.celsius(count), nil
+}
+
+// SetTemperatureAlarm arms the temperature monitor to assert its interrupt
+// (TEMPMON_IRQ) when the SoC junction temperature exceeds the argument
+// threshold, in degrees Celsius, and, on families other than i.MX6Q, to reset
+// the SoC when it exceeds the argument critical (panic) threshold, a zero
+// critical value leaves the panic threshold unchanged.
+//
+// Once armed, the sensor performs automatic measurements about every 0.5
+// seconds, allowing to throttle workloads before the SoC reaches its thermal
+// shutdown limit. The interrupt can be either serviced by the application
+// IRQ handler, after enabling it with ARM.EnableInterrupt(), or polled with
+// TemperatureAlarm().
+func SetTemperatureAlarm(high float64, critical float64) (err error) {
+	tm.Lock()
+	defer tm.Unlock()
+
+	if err = tm.calibrate(); err != nil {
+		return
+	}
+
+	alarm, err := tm.count(high)
+
+	if err != nil {
+		return
+	}
+
+	if critical != 0 {
+		if Family == IMX6Q {
+			return errors.New("panic threshold not supported")
+		}
+
+		p, err := tm.count(critical)
+
+		if err != nil {
+			return err
+		}
+
+		reg.SetN(TEMPMON_TEMPSENSE2, TEMPSENSE2_PANIC, 0xfff, p)
+	}
+
+	reg.SetN(TEMPMON_TEMPSENSE0, TEMPSENSE0_ALARM, 0xfff, alarm)
+
+	// continuous measurement
+	reg.Clear(TEMPMON_TEMPSENSE0, TEMPSENSE0_PD)
+	reg.SetN(TEMPMON_TEMPSENSE1, TEMPSENSE1_FREQ, 0xffff, tempAlarmPeriod)
+	reg.Set(TEMPMON_TEMPSENSE0, TEMPSENSE0_MEASURE)
+
+	tm.armed = true
+
+	return
+}
+
+// TemperatureAlarm returns whether the temperature alarm threshold (see
+// SetTemperatureAlarm()) has been exceeded by the last automatic
+// measurement.
+func TemperatureAlarm() bool {
+	tm.Lock()
+	defer tm.Unlock()
+
+	if !tm.armed {
+		return false
+	}
+
+	count := reg.Get(TEMPMON_TEMPSENSE0, TEMPSENSE0_CNT, 0xfff)
+	alarm := reg.Get(TEMPMON_TEMPSENSE0, TEMPSENSE0_ALARM, 0xfff)
+
+	// the count decreases as temperature increases
+	return count <= alarm
+}
@@ -0,0 +1,157 @@
+// NXP i.MX6 timer calibration
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/f-secure-foundry/tamago/internal/reg"
+)
+
+const (
+	// SRTC periods used for timer calibration (~10 ms)
+	calibrationTicks = 328
+	// maximum deviation (percent) accepted by CheckTimer()
+	timerTolerance = 3
+)
+
+// The timer is checked at package initialization, which takes place after the
+// board console has been initialized by runtime.hwinit, so that the warning
+// is visible.
+func init() {
+	if err := CheckTimer(); err != nil {
+		log.Printf("imx6: warning, %v", err)
+	}
+}
+
+// srtcTicks returns the lower 32 bits of the SRTC counter, which increments at
+// 32768 Hz.
+func srtcTicks() uint32 {
+	var prev uint32
+
+	// the counter must be read until two consecutive reads match
+	for {
+		cnt := reg.Read(SNVS_LPSRTCLR)
+
+		if cnt == prev {
+			return cnt
+		}
+
+		prev = cnt
+	}
+}
+
+// CalibrateTimer measures the CPU timer frequency, used by the runtime for
+// time keeping, against the SNVS Secure Real Time Counter, clocked by the
+// 32.768 kHz crystal oscillator, as an independent reference.
+//
+// The measurement takes about 10 ms and its resolution is one SRTC period over
+// the measurement window (~0.3%). The SRTC is temporarily enabled if not
+// already running.
+//
+// The calibration is performed at boot, on real hardware, to log a warning
+// whenever the timer frequency is found to be misconfigured (see
+// CheckTimer()).
+func CalibrateTimer() (freq int64, err error) {
+	if ARM.Timer == nil {
+		return 0, errors.New("timer not initialized")
+	}
+
+	if reg.Get(SNVS_LPCR, LPCR_SRTC_ENV, 1) == 0 {
+		reg.Set(SNVS_LPCR, LPCR_SRTC_ENV)
+		defer reg.Clear(SNVS_LPCR, LPCR_SRTC_ENV)
+
+		if !reg.WaitFor(10*time.Millisecond, SNVS_LPCR, LPCR_SRTC_ENV, 1, 1) {
+			return 0, errors.New("could not enable SRTC")
+		}
+	}
+
+	// measurement duration, as expected from the SRTC, in nanoseconds
+	window := calibrationTicks * (int64(time.Second) / SRTC_FREQ)
+	// bound the measurement to 100 times its expected duration in case the
+	// SRTC is not running
+	timeout := 100 * window
+
+	// align the measurement start to an SRTC tick edge
+	start := srtcTicks()
+	t0 := ARM.Timer.Nanos()
+
+	for srtcTicks() == start {
+		if ARM.Timer.Nanos()-t0 > timeout {
+			return 0, errors.New("SRTC not running")
+		}
+	}
+
+	start++
+	t0 = ARM.Timer.Nanos()
+
+	for srtcTicks()-start < calibrationTicks {
+		if ARM.Timer.Nanos()-t0 > timeout {
+			return 0, errors.New("SRTC not running")
+		}
+	}
+
+	t1 := ARM.Timer.Nanos()
+
+	if t1 <= t0 {
+		return 0, errors.New("timer not running")
+	}
+
+	return ARM.Timer.Frequency() * (t1 - t0) / window, nil
+}
+
+// CheckTimer calibrates the CPU timer (see CalibrateTimer()) and returns an
+// error if the measured frequency deviates by more than 3% from the one
+// reported by the timer backend (see arm.Timer), in which case time keeping
+// is skewed.
+//
+// The check is performed at boot, logging a warning on failure, to report a
+// misconfigured timer frequency (e.g. an unexpected boot loader CNTFRQ
+// setting) which is otherwise very hard to diagnose, applications can repeat
+// it at any time. The check is skipped under emulation.
+func CheckTimer() (err error) {
+	if !Native {
+		return
+	}
+
+	freq, err := CalibrateTimer()
+
+	if err != nil {
+		return fmt.Errorf("timer calibration failed, %v", err)
+	}
+
+	expected := ARM.Timer.Frequency()
+	deviation := (freq - expected) * 100 / expected
+
+	if deviation > timerTolerance || deviation < -timerTolerance {
+		return fmt.Errorf("timer frequency measured at %d Hz but configured as %d Hz, time keeping is skewed", freq, expected)
+	}
+
+	return
+}
+
+// Delay busy waits for the argument number of microseconds by polling the CPU
+// timer, which is converted according to its frequency (see Init()) both
+// under emulation and on real hardware.
+//
+// It is meant for peripheral timing requirements (e.g. reset pulse widths,
+// bit-banging), too short to justify a goroutine sleep, and it can be used
+// during early hardware initialization once Init() has been executed (see
+// arm.CPU.Delay()).
+func Delay(us int) {
+	if us <= 0 {
+		return
+	}
+
+	ARM.Delay(time.Duration(us) * time.Microsecond)
+}
@@ -10,10 +10,16 @@
 package imx6
 
 import (
+	"errors"
+	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/f-secure-foundry/tamago/bits"
+	"github.com/f-secure-foundry/tamago/internal/clock"
 	"github.com/f-secure-foundry/tamago/internal/reg"
+	"github.com/f-secure-foundry/tamago/internal/ring"
 )
 
 // UART registers
@@ -101,8 +107,11 @@ const (
 	UCR3_INVT      = 1
 	UCR3_ACIEN     = 0
 
-	UARTx_UCR4 = 0x008c
-	UCR4_CTSTL = 10
+	UARTx_UCR4   = 0x008c
+	UCR4_CTSTL   = 10
+	UCR4_INVR    = 9
+	UCR4_IDDMAEN = 6
+	UCR4_IRSC    = 5
 
 	UARTx_UFCR  = 0x0090
 	UFCR_TXTL   = 10
@@ -110,7 +119,15 @@ const (
 	UFCR_DCEDTE = 6
 	UFCR_RXTL   = 0
 
+	UARTx_USR1 = 0x0094
+	USR1_TRDY  = 13
+	USR1_AGTIM = 8
+	USR1_AWAKE = 4
+	USR1_SAD   = 3
+
 	UARTx_USR2 = 0x0098
+	USR2_IDLE  = 12
+	USR2_TXDC  = 3
 	USR2_RDR   = 0
 
 	UARTx_UESC = 0x009c
@@ -120,21 +137,80 @@ const (
 
 	UARTx_UTS   = 0x00b4
 	UTS_TXEMPTY = 6
+	UTS_RXEMPTY = 5
+	UTS_TXFULL  = 4
+	UTS_RXFULL  = 3
+
+	UARTx_UMCR  = 0x00b8
+	UMCR_SLADDR = 8
+	UMCR_SADEN  = 3
+	UMCR_TXB8   = 2
+	UMCR_SLAM   = 1
+	UMCR_MDEN   = 0
 )
 
 // UART represents a serial port instance
 type UART struct {
+	// software receive buffer overruns (see RxOverruns()) and last overrun
+	// time (Unix nanoseconds), first fields to ensure the 64-bit alignment
+	// required for atomic access
+	rxOverruns  uint64
+	overrunTime int64
+
 	sync.Mutex
 
 	// controller index
 	n int
+	// interrupt ID
+	irq int
 
-	// port speed
+	// port speed, changes after Init() require SetBaudrate()
 	Baudrate uint32
-	// DTE mode
+	// DTE mode, changes after Init() require SetRole()
 	DTE bool
-	// hardware flow control
+	// hardware flow control (see EnableFlowControl())
 	Flow bool
+	// Timeout for transmission with hardware flow control, while the peer
+	// holds off the transmitter (default 1s)
+	Timeout time.Duration
+	// character format, 8N1 unless set with Configure()
+	mode UARTMode
+	// RX FIFO level for CTS deassertion (see EnableFlowControl())
+	flowThreshold int
+	// software receive buffer size, for interrupt driven reception (see
+	// EnableInterrupt()), it must be a power of 2 (default 256)
+	RxBufferSize int
+
+	// transmitter and receiver state, saved on Disable()
+	disabled uint32
+	// baud rate generator configuration
+	rate clock.BRM
+
+	// receive error counters, updated with atomic operations as reception
+	// can take place in interrupt context (see EnableInterrupt())
+	overruns      uint32
+	framingErrors uint32
+	parityErrors  uint32
+	breaks        uint32
+
+	// received characters count
+	received uint32
+	// last overrun receive stream offset
+	overrunOffset uint32
+
+	// receive callback state (see OnReceive())
+	rxMutex sync.Mutex
+	rxDone  chan struct{}
+	// DMA receive state (see StartDMA())
+	rxDMA *uartDMA
+	// interrupt driven receive state (see EnableInterrupt())
+	rxBuf *ring.Buffer
+	// characters queued to, and consumed from, the software receive buffer
+	rxQueued   uint32
+	rxConsumed uint32
+	// pending receive error code and its position in the queued stream
+	rxErrCode   uint32
+	rxErrOffset uint32
 
 	// control registers
 	urxd uint32
@@ -144,14 +220,91 @@ type UART struct {
 	ucr3 uint32
 	ucr4 uint32
 	ufcr uint32
+	usr1 uint32
 	usr2 uint32
 	uesc uint32
 	utim uint32
 	ubir uint32
 	ubmr uint32
 	uts  uint32
+	umcr uint32
+
+	// typed register fields
+	UCR1 ucr1Fields
+	UCR2 ucr2Fields
+	UCR3 ucr3Fields
+	UCR4 ucr4Fields
+	UFCR ufcrFields
+	USR1 usr1Fields
+	USR2 usr2Fields
+	UTS  utsFields
+}
+
+// UART receive errors, returned by Read() for characters received with the
+// matching error condition, which are discarded (see Status() for counters).
+var (
+	ErrBreak   = errors.New("UART break condition")
+	ErrFraming = errors.New("UART framing error")
+	ErrParity  = errors.New("UART parity error")
+	ErrOverrun = errors.New("UART receive overrun")
+)
+
+// receive errors by code (see rxError())
+var uartErrors = [...]error{nil, ErrBreak, ErrFraming, ErrParity, ErrOverrun}
+
+// Parity represents the UART parity setting.
+type Parity int
+
+// UART parity settings
+const (
+	ParityNone Parity = iota
+	ParityEven
+	ParityOdd
+)
+
+// UARTMode represents the UART character format.
+type UARTMode struct {
+	// data bits (7 or 8)
+	DataBits int
+	// parity bit
+	Parity Parity
+	// stop bits (1 or 2)
+	StopBits int
 }
 
+// UARTStatus represents the state of a UART instance.
+type UARTStatus struct {
+	// controller index
+	Index int
+	// UART enable
+	Enabled bool
+	// port speed
+	Baudrate uint32
+
+	// receive error counters
+	Overruns      int
+	FramingErrors int
+	ParityErrors  int
+	Breaks        int
+
+	// received characters count, and its value at the last overrun
+	Received      int
+	OverrunOffset int
+
+	// FIFO state
+	TxEmpty bool
+	TxFull  bool
+	RxEmpty bool
+	RxFull  bool
+}
+
+// initialized instances, a fixed size array is used as UART initialization
+// can take place during early runtime initialization, where heap allocation
+// must be avoided.
+var uarts [8]*UART
+var uartsCount int
+var uartsMutex sync.Mutex
+
 // UART1 instance
 var UART1 = &UART{
 	n:        1,
@@ -164,26 +317,96 @@ var UART2 = &UART{
 	Baudrate: UART_DEFAULT_BAUDRATE,
 }
 
-// Init initializes and enables the UART for RS-232 mode,
+// UART3 instance
+var UART3 = &UART{
+	n:        3,
+	Baudrate: UART_DEFAULT_BAUDRATE,
+}
+
+// UART4 instance
+var UART4 = &UART{
+	n:        4,
+	Baudrate: UART_DEFAULT_BAUDRATE,
+}
+
+// UART5 instance
+var UART5 = &UART{
+	n:        5,
+	Baudrate: UART_DEFAULT_BAUDRATE,
+}
+
+// UART6 instance
+var UART6 = &UART{
+	n:        6,
+	Baudrate: UART_DEFAULT_BAUDRATE,
+}
+
+// UART7 instance
+var UART7 = &UART{
+	n:        7,
+	Baudrate: UART_DEFAULT_BAUDRATE,
+}
+
+// UART8 instance
+var UART8 = &UART{
+	n:        8,
+	Baudrate: UART_DEFAULT_BAUDRATE,
+}
+
+// NewUART initializes, at the argument port speed, and returns the UART
+// instance matching the argument index (1-8), the same instance is also
+// available as package variable (e.g. UART3).
+//
+// An error is returned if the instance is not available on the detected
+// processor family or part (e.g. UART6-UART8 on the i.MX6Q, UART5-UART8 on
+// the i.MX6ULZ) or if it has already
+// been initialized, in which case its configuration should be changed with
+// SetBaudrate() or Configure().
+func NewUART(index int, baudrate uint32) (hw *UART, err error) {
+	if uartBase(index) == 0 {
+		return nil, errors.New("invalid UART controller instance")
+	}
+
+	hw = [8]*UART{UART1, UART2, UART3, UART4, UART5, UART6, UART7, UART8}[index-1]
+
+	hw.Lock()
+	initialized := hw.ucr1 != 0
+	hw.Unlock()
+
+	if initialized {
+		return nil, errors.New("UART controller already initialized")
+	}
+
+	if err = hw.Configure(baudrate, hw.Mode()); err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+// Init initializes and enables the UART for RS-232 mode, with 8N1 character
+// format unless otherwise set (see Configure()),
 // p3605, 55.13.1 Programming the UART in RS-232 mode, IMX6ULLRM.
 func (hw *UART) Init() {
-	var base uint32
-
 	hw.Lock()
 
-	switch hw.n {
-	case 1:
-		base = UART1_BASE
-	case 2:
-		base = UART2_BASE
-	case 3:
-		base = UART3_BASE
-	case 4:
-		base = UART4_BASE
-	default:
+	base := uartBase(hw.n)
+
+	if base == 0 {
 		panic("invalid UART controller instance")
 	}
 
+	RegisterRegion("UART", base, AIPS_SLOT_SIZE)
+
+	hw.irq = uartIRQ[hw.n-1]
+
+	if hw.Timeout == 0 {
+		hw.Timeout = 1 * time.Second
+	}
+
+	clk := uartClockGate[hw.n-1]
+	RegisterClock(clk.CCGR, clk.CG)
+
 	hw.urxd = base + UARTx_URXD
 	hw.utxd = base + UARTx_UTXD
 	hw.ucr1 = base + UARTx_UCR1
@@ -191,38 +414,167 @@ func (hw *UART) Init() {
 	hw.ucr3 = base + UARTx_UCR3
 	hw.ucr4 = base + UARTx_UCR4
 	hw.ufcr = base + UARTx_UFCR
+	hw.usr1 = base + UARTx_USR1
 	hw.usr2 = base + UARTx_USR2
 	hw.uesc = base + UARTx_UESC
 	hw.utim = base + UARTx_UTIM
 	hw.ubir = base + UARTx_UBIR
 	hw.ubmr = base + UARTx_UBMR
 	hw.uts = base + UARTx_UTS
+	hw.umcr = base + UARTx_UMCR
 
+	hw.initFields()
 	hw.setup()
 
 	hw.Unlock()
+
+	register(hw)
 }
 
-func uartclk() uint32 {
-	var freq uint32
+// Configure initializes and enables the UART, as Init(), with the argument
+// port speed and character format (e.g. 7E1 for legacy peripherals), which
+// are retained by subsequent Init() invocations.
+//
+// An error is returned for unsupported formats, the receive error counters
+// (see Status()) account for parity errors.
+func (hw *UART) Configure(baudrate uint32, mode UARTMode) (err error) {
+	if mode.DataBits != 7 && mode.DataBits != 8 {
+		return errors.New("unsupported data bits")
+	}
 
-	if reg.Get(CCM_CSCDR1, CSCDR1_UART_CLK_SEL, 0b1) == 1 {
-		freq = OSC_FREQ
-	} else {
-		freq = PLL3_FREQ
+	if mode.Parity < ParityNone || mode.Parity > ParityOdd {
+		return errors.New("unsupported parity")
 	}
 
-	podf := reg.Get(CCM_CSCDR1, CSCDR1_UART_CLK_PODF, 0b111111)
+	if mode.StopBits != 1 && mode.StopBits != 2 {
+		return errors.New("unsupported stop bits")
+	}
+
+	if _, err = clock.SolveBaudrate(uartclk(), baudrate); err != nil {
+		return
+	}
 
-	return freq / (podf + 1)
+	hw.Lock()
+	hw.Baudrate = baudrate
+	hw.mode = mode
+	hw.Unlock()
+
+	hw.Init()
+
+	return
+}
+
+// Mode returns the UART character format.
+func (hw *UART) Mode() UARTMode {
+	if hw.mode.DataBits == 0 {
+		return UARTMode{DataBits: 8, Parity: ParityNone, StopBits: 1}
+	}
+
+	return hw.mode
+}
+
+func register(hw *UART) {
+	uartsMutex.Lock()
+	defer uartsMutex.Unlock()
+
+	for i := 0; i < uartsCount; i++ {
+		if uarts[i] == hw {
+			return
+		}
+	}
+
+	if uartsCount < len(uarts) {
+		uarts[uartsCount] = hw
+		uartsCount++
+	}
+}
+
+// UARTs returns all initialized UART instances (see Init()), in
+// initialization order.
+func UARTs() []*UART {
+	uartsMutex.Lock()
+	defer uartsMutex.Unlock()
+
+	return append([]*UART{}, uarts[0:uartsCount]...)
+}
+
+// UART base addresses for each processor family, unavailable instances are
+// set to zero.
+var (
+	// i.MX 6UltraLite, i.MX 6ULL
+	//
+	// The UART5-8 instances are also missing on the i.MX 6UltraLite G0 and
+	// i.MX 6ULL Y0 parts (see UART5_BASE), which cannot be told apart from
+	// the other parts of their family at runtime, applications must
+	// therefore not use them on such parts.
+	uartBaseUL = [8]uint32{
+		UART1_BASE, UART2_BASE, UART3_BASE, UART4_BASE,
+		UART5_BASE, UART6_BASE, UART7_BASE, UART8_BASE,
+	}
+
+	// i.MX 6ULZ (see ULZ)
+	uartBaseULZ = [8]uint32{
+		UART1_BASE, UART2_BASE, UART3_BASE, UART4_BASE,
+		0, 0, 0, 0,
+	}
+
+	// i.MX 6Quad (ARM Platform Memory Map, IMX6DQRM)
+	uartBaseQ = [8]uint32{
+		UART1_BASE, UART2_BASE, UART3_BASE, UART4_BASE,
+		UART5_BASE, 0, 0, 0,
+	}
+
+	uartIRQ = [8]int{
+		UART1_IRQ, UART2_IRQ, UART3_IRQ, UART4_IRQ,
+		UART5_IRQ, UART6_IRQ, UART7_IRQ, UART8_IRQ,
+	}
+)
+
+// uartBase returns the UART instance base address for the detected processor
+// family (see Family) and part (see ULZ), zero is returned for unavailable
+// instances.
+func uartBase(n int) uint32 {
+	if n < 1 || n > 8 {
+		return 0
+	}
+
+	switch Family {
+	case IMX6Q:
+		return uartBaseQ[n-1]
+	case IMX6ULL:
+		if ULZ {
+			return uartBaseULZ[n-1]
+		}
+
+		return uartBaseUL[n-1]
+	default:
+		return uartBaseUL[n-1]
+	}
+}
+
+// uartclk returns the UART_CLK_ROOT frequency, sourced from pll3_80m (PLL3
+// with /6 static divider) or, on families other than i.MX 6Dual/6Quad which
+// lack the selector, optionally from the 24 MHz oscillator
+// (Clock Tree, IMX6ULLRM).
+func uartclk() uint32 {
+	return uartClockRoot(Family, reg.Read(CCM_CSCDR1))
+}
+
+// uartClockRoot returns the UART_CLK_ROOT frequency for the argument
+// processor family and CCM_CSCDR1 register value (see uartclk()).
+func uartClockRoot(family uint32, cscdr1 uint32) uint32 {
+	sel := bits.Get(&cscdr1, CSCDR1_UART_CLK_SEL, 0b1)
+	podf := bits.Get(&cscdr1, CSCDR1_UART_CLK_PODF, 0b111111)
+
+	return clock.UARTRoot(PLL3_FREQ, OSC_FREQ, family != IMX6Q, sel, podf)
 }
 
 func (hw *UART) txEmpty() bool {
-	return reg.Get(hw.uts, UTS_TXEMPTY, 1) == 0
+	return hw.UTS.TXEMPTY.Get() == 0
 }
 
 func (hw *UART) rxReady() bool {
-	return reg.Get(hw.usr2, USR2_RDR, 1) == 1
+	return hw.USR2.RDR.Get() == 1
 }
 
 func (hw *UART) setup() {
@@ -253,8 +605,6 @@ func (hw *UART) setup() {
 	reg.Write(hw.utim, 0)
 
 	var ufcr uint32
-	// Divide input clock by 2
-	bits.SetN(&ufcr, UFCR_RFDIV, 0b111, 0b100)
 	// TxFIFO has 2 or fewer characters
 	bits.SetN(&ufcr, UFCR_TXTL, 0b111111, 2)
 	// RxFIFO has 1 character
@@ -267,28 +617,36 @@ func (hw *UART) setup() {
 	// set UFCR
 	reg.Write(hw.ufcr, ufcr)
 
-	// p3592, 55.5 Binary Rate Multiplier (BRM), IMX6ULLRM
-	//
-	//              ref_clk_freq
-	// baudrate = -----------------
-	//                   UBMR + 1
-	//             16 * ----------
-	//                   UBIR + 1
-	//
-	// ref_clk_freq = module_clock
+	clk := uartclk()
+	// set reference frequency divider and BRM (see clock.SolveBaudrate())
+	rate, err := clock.SolveBaudrate(clk, hw.Baudrate)
 
-	// match /6 static divider (p630, Figure 18-3. Clock Tree - Part 2, IMX6ULLRM)
-	clk := uartclk() / 6
-	// multiply to match UFCR_RFDIV divider value
-	ubmr := clk / (2 * hw.Baudrate)
-	// neutralize denominator
-	reg.Write(hw.ubir, 15)
-	// set UBMR
-	reg.Write(hw.ubmr, ubmr)
+	if err != nil {
+		hw.Baudrate = UART_DEFAULT_BAUDRATE
+		rate, _ = clock.SolveBaudrate(clk, hw.Baudrate)
+	}
+
+	hw.setBaudrate(rate)
 
 	var ucr2 uint32
-	// 8-bit transmit and receive character length
-	bits.Set(&ucr2, UCR2_WS)
+
+	if hw.mode.DataBits != 7 {
+		// 8-bit transmit and receive character length
+		bits.Set(&ucr2, UCR2_WS)
+	}
+
+	switch hw.mode.Parity {
+	case ParityEven:
+		bits.Set(&ucr2, UCR2_PREN)
+	case ParityOdd:
+		bits.Set(&ucr2, UCR2_PREN)
+		bits.Set(&ucr2, UCR2_PROE)
+	}
+
+	if hw.mode.StopBits == 2 {
+		bits.Set(&ucr2, UCR2_STPB)
+	}
+
 	// Enable the transmitter
 	bits.Set(&ucr2, UCR2_TXEN)
 	// Enable the receiver
@@ -300,9 +658,11 @@ func (hw *UART) setup() {
 		// Receiver controls CTS
 		bits.Set(&ucr2, UCR2_CTSC)
 
-		// 16 characters in the RxFIFO as the maximum value leads to
-		// overflow even with hardware flow control in place.
-		reg.SetN(hw.ucr4, UCR4_CTSTL, 0b111111, 16)
+		if hw.flowThreshold == 0 {
+			hw.flowThreshold = uartFlowThreshold
+		}
+
+		reg.SetN(hw.ucr4, UCR4_CTSTL, 0b111111, uint32(hw.flowThreshold))
 	} else {
 		// Ignore the RTS pin
 		bits.Set(&ucr2, UCR2_IRTS)
@@ -319,56 +679,504 @@ func (hw *UART) setup() {
 
 // Enable enables the UART, this is only required after an explicit disable
 // (see Disable()) as initialized interfaces (see Init()) are enabled by default.
+//
+// The transmitter and receiver are re-enabled, if previously enabled, without
+// any re-initialization as the UART configuration is retained while disabled.
 func (hw *UART) Enable() {
-	reg.Set(hw.ucr1, UCR1_UARTEN)
+	hw.Lock()
+	defer hw.Unlock()
+
+	hw.UCR1.UARTEN.Set()
+
+	if hw.disabled == 0 {
+		return
+	}
+
+	reg.Or(hw.ucr2, hw.disabled)
+	hw.disabled = 0
 }
 
-// Disable disables the UART.
+// Disable disables the UART, after waiting for completion of any pending
+// transmission, so that it does not prevent entering low power modes (see
+// Suspend()).
+//
+// The transmitter and receiver are stopped and their configuration is
+// preserved to be restored by Enable(). A disabled UART cannot be used as
+// wake-up source (see WakeSource()).
 func (hw *UART) Disable() {
-	reg.Clear(hw.ucr1, UCR1_UARTEN)
+	hw.Lock()
+	defer hw.Unlock()
+
+	if hw.UCR1.UARTEN.Get() == 0 {
+		return
+	}
+
+	// wait for transmission completion
+	reg.Wait(hw.usr2, USR2_TXDC, 1, 1)
+
+	ucr2 := reg.Read(hw.ucr2)
+	hw.disabled = ucr2 & (1<<UCR2_TXEN | 1<<UCR2_RXEN)
+
+	hw.UCR2.TXEN.Clear()
+	hw.UCR2.RXEN.Clear()
+	hw.UCR1.UARTEN.Clear()
+}
+
+// WakeSource returns the UART wake-up source for low power mode (see
+// Suspend()), triggered by a falling edge on the receive line (UCR3_AWAKEN).
+//
+// The character, or characters, received while suspended are likely lost.
+func (hw *UART) WakeSource() WakeSource {
+	return WakeSource{
+		IRQ: hw.irq,
+		Arm: func() {
+			reg.Write(hw.usr1, 1<<USR1_AWAKE)
+			reg.Set(hw.ucr3, UCR3_AWAKEN)
+		},
+		Disarm: func() {
+			reg.Clear(hw.ucr3, UCR3_AWAKEN)
+			reg.Write(hw.usr1, 1<<USR1_AWAKE)
+		},
+	}
 }
 
-// Tx transmits a single character to the serial port.
+// Status returns the UART instance state, the receive error counters are
+// updated when errors are detected on receive (see Rx()).
+//
+// The counters are individually read with atomic operations, as they are
+// updated in interrupt context, therefore they do not necessarily reflect the
+// same instant when reception is in progress.
+func (hw *UART) Status() (status UARTStatus) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	status = UARTStatus{
+		Index:         hw.n,
+		Baudrate:      hw.Baudrate,
+		Overruns:      int(atomic.LoadUint32(&hw.overruns)),
+		FramingErrors: int(atomic.LoadUint32(&hw.framingErrors)),
+		ParityErrors:  int(atomic.LoadUint32(&hw.parityErrors)),
+		Breaks:        int(atomic.LoadUint32(&hw.breaks)),
+		Received:      int(atomic.LoadUint32(&hw.received)),
+		OverrunOffset: int(atomic.LoadUint32(&hw.overrunOffset)),
+	}
+
+	if hw.ucr1 == 0 {
+		return
+	}
+
+	uts := reg.Read(hw.uts)
+
+	status.Enabled = reg.Get(hw.ucr1, UCR1_UARTEN, 1) == 1
+	status.TxEmpty = bits.Get(&uts, UTS_TXEMPTY, 1) == 1
+	status.TxFull = bits.Get(&uts, UTS_TXFULL, 1) == 1
+	status.RxEmpty = bits.Get(&uts, UTS_RXEMPTY, 1) == 1
+	status.RxFull = bits.Get(&uts, UTS_RXFULL, 1) == 1
+
+	return
+}
+
+// rxError updates the receive error counters from an URXD register value,
+// it returns a non-zero code (see uartErrors) if the character is invalid.
+//
+// As a break is also detected as framing error, when more conditions are
+// flagged the code reflects, in order of precedence, a break, a framing
+// error, a parity error or an overrun.
+func (hw *UART) rxError(urxd uint32) (code uint32) {
+	if bits.Get(&urxd, URXD_PRERR, 0b11111) == 0 {
+		return 0
+	}
+
+	if bits.Get(&urxd, URXD_OVRRUN, 1) == 1 {
+		atomic.StoreInt64(&hw.overrunTime, time.Now().UnixNano())
+		atomic.StoreUint32(&hw.overrunOffset, atomic.LoadUint32(&hw.received))
+		atomic.AddUint32(&hw.overruns, 1)
+		code = 4
+	}
+
+	if bits.Get(&urxd, URXD_PRERR, 1) == 1 {
+		atomic.AddUint32(&hw.parityErrors, 1)
+		code = 3
+	}
+
+	if bits.Get(&urxd, URXD_FRMERR, 1) == 1 {
+		atomic.AddUint32(&hw.framingErrors, 1)
+		code = 2
+	}
+
+	if bits.Get(&urxd, URXD_BRK, 1) == 1 {
+		atomic.AddUint32(&hw.breaks, 1)
+		code = 1
+	}
+
+	if code == 0 {
+		// error summary only
+		code = 2
+	}
+
+	return
+}
+
+// SetInvert sets the polarity of the transmit (UCR3_INVT) and receive
+// (UCR4_INVR) lines, when inverted the line idle state is low, to interface
+// with devices, or level shifters, using inverted signaling.
+//
+// The setting is reset by Init(), therefore it must be applied afterwards.
+func (hw *UART) SetInvert(tx bool, rx bool) {
+	if tx {
+		hw.UCR3.INVT.Set()
+	} else {
+		hw.UCR3.INVT.Clear()
+	}
+
+	if rx {
+		hw.UCR4.INVR.Set()
+	} else {
+		hw.UCR4.INVR.Clear()
+	}
+}
+
+// Invert returns whether the polarity of the transmit and receive lines is
+// inverted (see SetInvert()).
+func (hw *UART) Invert() (tx bool, rx bool) {
+	return hw.UCR3.INVT.Get() == 1, hw.UCR4.INVR.Get() == 1
+}
+
+// Role represents the UART role on modem control signals.
+type Role int
+
+// UART roles
+const (
+	// Data Communication Equipment (default)
+	DCE Role = iota
+	// Data Terminal Equipment
+	DTE
+)
+
+// SetRole sets the UART role as Data Communication Equipment (DCE) or Data
+// Terminal Equipment (DTE), programming UFCR_DCEDTE, which swaps the
+// direction of the modem control signals (e.g. RTS_B is an input in DCE mode
+// and an output in DTE mode). Connecting two UARTs back-to-back requires each
+// end to have a different role, or a null-modem connection.
+//
+// The role also swaps the RX and TX pad functions, the pad daisy chain must
+// therefore be configured accordingly by the caller (e.g. board package).
+//
+// The function waits for the completion of any pending transmission.
+func (hw *UART) SetRole(role Role) {
+	reg.Wait(hw.usr2, USR2_TXDC, 1, 1)
+
+	hw.DTE = role == DTE
+
+	if hw.DTE {
+		hw.UFCR.DCEDTE.Set()
+	} else {
+		hw.UFCR.DCEDTE.Clear()
+	}
+}
+
+// Role returns the UART role (see SetRole()).
+func (hw *UART) Role() Role {
+	if hw.UFCR.DCEDTE.Get() == 1 {
+		return DTE
+	}
+
+	return DCE
+}
+
+// SetIrDA enables or disables the IrDA serial infrared (SIR) encoding on the
+// transmit and receive lines (UCR1_IREN), each zero bit is transmitted as a
+// pulse, the line polarity can be configured with SetInvert().
+//
+// The hardware supports two pulse widths, 3/16 of the bit period (standard
+// SIR), selected with a zero pulse width, or a fixed short pulse timed by the
+// UART reference clock (UCR4_IRSC), selected with any pulse width shorter than
+// 3/16 of the bit period (e.g. the 1.63 µs SIR minimum), which reduces the
+// transceiver power consumption at low baud rates.
+//
+// The function waits for the completion of any pending transmission, the
+// setting is reset by Init(), therefore it must be applied afterwards.
+func (hw *UART) SetIrDA(enabled bool, pulseWidth time.Duration) {
+	reg.Wait(hw.usr2, USR2_TXDC, 1, 1)
+
+	if !enabled {
+		hw.UCR1.IREN.Clear()
+		hw.UCR4.IRSC.Clear()
+		return
+	}
+
+	// 3/16 of the bit period
+	sir := 3 * time.Second / time.Duration(16*hw.Baudrate)
+
+	if pulseWidth > 0 && pulseWidth < sir {
+		hw.UCR4.IRSC.Set()
+	} else {
+		hw.UCR4.IRSC.Clear()
+	}
+
+	hw.UCR1.IREN.Set()
+}
+
+// SetRxAging configures the number of idle character times (4, 8, 16 or 32)
+// after which the receiver signals that the RX FIFO holds data which did not
+// reach the trigger level (see UFCR_RXTL), a zero argument disables it.
+//
+// The aging timer (UCR2_ATEN, USR1_AGTIM) is enabled along with the idle
+// condition detection (UCR1_IDEN, USR2_IDLE), using the argument character
+// times, so that data below the trigger level is delivered to interrupt or
+// DMA driven receive paths with bounded latency. The aging timer period is
+// fixed by hardware to 8 character times. Polled reception (see Rx()) is not
+// affected as any received character is immediately available.
+//
+// The setting is reset by Init(), therefore it must be applied afterwards.
+func (hw *UART) SetRxAging(chars int) (err error) {
+	var icd uint32
+
+	switch chars {
+	case 0:
+		hw.UCR1.IDEN.Clear()
+		hw.UCR2.ATEN.Clear()
+		return
+	case 4:
+		icd = 0b00
+	case 8:
+		icd = 0b01
+	case 16:
+		icd = 0b10
+	case 32:
+		icd = 0b11
+	default:
+		return errors.New("unsupported number of idle character times")
+	}
+
+	hw.UCR1.ICD.Write(icd)
+	hw.UCR1.IDEN.Set()
+	hw.UCR2.ATEN.Set()
+
+	return
+}
+
+// SetAddress enables RS-485 9-bit multidrop mode with automatic slave address
+// detection, only characters following an address frame (9th bit set)
+// matching the argument address are received, up to the next address frame.
+func (hw *UART) SetAddress(addr byte) {
+	var umcr uint32
+
+	bits.SetN(&umcr, UMCR_SLADDR, 0xff, uint32(addr))
+	bits.Set(&umcr, UMCR_SLAM)
+	bits.Set(&umcr, UMCR_MDEN)
+
+	reg.Write(hw.umcr, umcr)
+}
+
+// ClearAddress disables RS-485 9-bit multidrop mode.
+func (hw *UART) ClearAddress() {
+	reg.Write(hw.umcr, 0)
+}
+
+// SendAddressFrame transmits an RS-485 9-bit address frame (9th bit set), the
+// characters transmitted afterwards are sent as data frames (9th bit clear).
+//
+// The 9-bit multidrop mode is enabled if not already set (see SetAddress()).
+func (hw *UART) SendAddressFrame(addr byte) {
+	// wait for completion of pending data frames
+	reg.Wait(hw.usr2, USR2_TXDC, 1, 1)
+
+	reg.Set(hw.umcr, UMCR_MDEN)
+	reg.Set(hw.umcr, UMCR_TXB8)
+
+	hw.Tx(addr)
+
+	// wait for address frame completion
+	reg.Wait(hw.usr2, USR2_TXDC, 1, 1)
+
+	reg.Clear(hw.umcr, UMCR_TXB8)
+}
+
+// Tx transmits a single character to the serial port, the function returns
+// once the TX FIFO is empty which happens while the character is still being
+// shifted out (see WriteAndWaitComplete()).
 func (hw *UART) Tx(c byte) {
 	reg.Write(hw.utxd, uint32(c))
+	hw.txDrain()
+}
 
-	for hw.txEmpty() {
-		// wait for TX FIFO to be empty
-	}
+// WriteAndWaitComplete transmits a single character to the serial port, the
+// function returns once the transmission is complete, meaning that both the
+// TX FIFO and the shift register are empty and the last stop bit has left the
+// transmitter (see USR2_TXDC).
+//
+// Unlike Tx() and Write(), which return as soon as the TX FIFO is emptied,
+// this allows to reliably turn around half-duplex lines (e.g. deasserting the
+// RS-485 transceiver Driver Enable) without truncating the last character.
+func (hw *UART) WriteAndWaitComplete(c byte) {
+	hw.Tx(c)
+	reg.Wait(hw.usr2, USR2_TXDC, 1, 1)
 }
 
-// Rx receives a single character from the serial port.
+// Rx receives a single character from the serial port, when interrupt driven
+// reception is enabled (see EnableInterrupt()) the character is taken from the
+// software receive buffer.
 func (hw *UART) Rx() (c byte, valid bool) {
+	if rxBuf := hw.rxBuf; rxBuf != nil {
+		var buf [1]byte
+		n, _ := hw.readBuffer(rxBuf, buf[:])
+		return buf[0], n == 1
+	}
+
+	c, valid, _ = hw.rxFIFO()
+
+	return
+}
+
+// rxFIFO receives a single character from the RX FIFO, invalid characters
+// are discarded and reported with a non-zero error code (see rxError()).
+func (hw *UART) rxFIFO() (c byte, valid bool, code uint32) {
 	if !hw.rxReady() {
 		return
 	}
 
 	urxd := reg.Read(hw.urxd)
 
-	if bits.Get(&urxd, URXD_PRERR, 0b11111) != 0 {
+	if code = hw.rxError(urxd); code != 0 {
 		return
 	}
 
-	return byte(bits.Get(&urxd, URXD_RX_DATA, 0xff)), true
+	atomic.AddUint32(&hw.received, 1)
+
+	return byte(bits.Get(&urxd, URXD_RX_DATA, 0xff)), true, 0
 }
 
-// Write data from buffer to serial port.
-func (hw *UART) Write(buf []byte) {
-	for i := 0; i < len(buf); i++ {
-		hw.Tx(buf[i])
+// LastOverrun returns the number of receive FIFO overruns and the time of the
+// last one, data has been lost right after the received character at the
+// stream offset reported by Status() (see UARTStatus.OverrunOffset).
+func (hw *UART) LastOverrun() (count int, at time.Time) {
+	count = int(atomic.LoadUint32(&hw.overruns))
+
+	if count > 0 {
+		at = time.Unix(0, atomic.LoadInt64(&hw.overrunTime))
 	}
+
+	return
 }
 
-// Read available data to buffer from serial port.
-func (hw *UART) Read(buf []byte) (n int) {
+// WriteByte transmits a single character to the serial port, it implements
+// io.ByteWriter (see Tx()).
+func (hw *UART) WriteByte(c byte) error {
+	hw.Tx(c)
+	return nil
+}
+
+// ReadByte receives a single character from the serial port, it implements
+// io.ByteReader. Unlike Rx() the function blocks until a character is
+// received.
+func (hw *UART) ReadByte() (c byte, err error) {
 	var valid bool
 
+	for {
+		if c, valid = hw.Rx(); valid {
+			return
+		}
+
+		runtime.Gosched()
+	}
+}
+
+// Write transmits all data from the buffer to the serial port, it implements
+// io.Writer. The TX FIFO is filled up to its depth before waiting for room,
+// the function returns once the TX FIFO is empty (see Tx() and
+// WriteAndWaitComplete()).
+//
+// With hardware flow control enabled (see EnableFlowControl()) an error
+// wrapping ErrTimeout is returned, along with the number of characters
+// queued for transmission, if the peer holds off the transmitter for longer
+// than Timeout.
+func (hw *UART) Write(buf []byte) (n int, err error) {
+	if hw.Flow {
+		return hw.writeFlow(buf)
+	}
+
 	for n = 0; n < len(buf); n++ {
-		buf[n], valid = hw.Rx()
+		hw.txFIFO(buf[n])
+	}
+
+	hw.txDrain()
+
+	return
+}
+
+// WriteString transmits all characters of the argument string to the serial
+// port, it implements io.StringWriter (see Write()).
+func (hw *UART) WriteString(s string) (n int, err error) {
+	if hw.Flow {
+		return hw.writeFlow([]byte(s))
+	}
+
+	for n = 0; n < len(s); n++ {
+		hw.txFIFO(s[n])
+	}
+
+	hw.txDrain()
+
+	return
+}
+
+// txFIFO queues a single character in the TX FIFO, waiting only when the FIFO
+// is full, so that bulk transmissions take advantage of the entire 32
+// characters FIFO rather than waiting for each character to leave it.
+//
+// Once full, the FIFO is refilled when its level drops to the transmitter
+// trigger level (UFCR_TXTL, USR1_TRDY), which leaves enough characters queued
+// to keep the transmitter busy while it is refilled.
+func (hw *UART) txFIFO(c byte) {
+	if hw.UTS.TXFULL.Get() == 1 {
+		for reg.Get(hw.usr1, USR1_TRDY, 1) == 0 {
+			// wait for TX FIFO level to reach the trigger level
+		}
+	}
+
+	reg.Write(hw.utxd, uint32(c))
+}
+
+// txDrain waits for the TX FIFO to be empty.
+func (hw *UART) txDrain() {
+	for hw.txEmpty() {
+		// wait for TX FIFO to be empty
+	}
+}
+
+// Read receives the data available in the RX FIFO to the buffer, it
+// implements io.Reader. The function does not block, it returns zero with a
+// nil error when no data is available.
+//
+// As repeated empty reads are treated as failure by bufio.Scanner (see
+// io.ErrNoProgress), line oriented input should be read with ReadByte(), or
+// through a reader which waits for data, when wrapped by it.
+//
+// Characters received with an error condition are discarded, reception stops
+// at the first one and the data received before it is returned along with
+// ErrBreak, ErrFraming, ErrParity or ErrOverrun. This allows protocols using
+// breaks as frame delimiters to detect them reliably. With interrupt driven
+// reception (see EnableInterrupt()) the error is returned once the data
+// buffered before it has been read.
+func (hw *UART) Read(buf []byte) (n int, err error) {
+	if rxBuf := hw.rxBuf; rxBuf != nil {
+		return hw.readBuffer(rxBuf, buf)
+	}
+
+	for n < len(buf) {
+		c, valid, code := hw.rxFIFO()
+
+		if code != 0 {
+			return n, uartErrors[code]
+		}
 
 		if !valid {
 			break
 		}
+
+		buf[n] = c
+		n++
 	}
 
 	return
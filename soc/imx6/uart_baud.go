@@ -0,0 +1,73 @@
+// NXP i.MX6 UART driver
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"errors"
+
+	"github.com/f-secure-foundry/tamago/internal/clock"
+	"github.com/f-secure-foundry/tamago/internal/reg"
+)
+
+// UFCR_RFDIV values for each reference frequency divider (1-7)
+// (UART FIFO Control Register (UARTx_UFCR), IMX6ULLRM).
+var rfdivCode = [8]uint32{0, 0b101, 0b100, 0b011, 0b010, 0b001, 0b000, 0b110}
+
+// setBaudrate programs the reference frequency divider and the Binary Rate
+// Multiplier for the argument configuration.
+func (hw *UART) setBaudrate(rate clock.BRM) {
+	reg.SetN(hw.ufcr, UFCR_RFDIV, 0b111, rfdivCode[rate.Div])
+	// UBIR must be written before UBMR
+	reg.Write(hw.ubir, rate.Num-1)
+	reg.Write(hw.ubmr, rate.Den-1)
+
+	hw.rate = rate
+}
+
+// SetBaudrate changes the port speed, the reference frequency divider and
+// Binary Rate Multiplier values are selected to minimize the error on the
+// argument baud rate, allowing nonstandard rates (e.g. 31250 bps for MIDI,
+// 250000 bps for DMX512) to be achieved (see BaudrateError()).
+//
+// Unlike Init(), only the divider registers (UFCR_RFDIV, UBIR, UBMR) are
+// written, without any reset, while the transmitter and receiver remain
+// enabled, allowing the speed to be negotiated mid-session without glitching
+// the line. The function waits for the completion of any pending
+// transmission, so that characters already queued leave at the previous
+// rate, an error is returned if the rate is not achievable, within ±2%, with
+// the current UART clock.
+func (hw *UART) SetBaudrate(baud uint32) (err error) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	if hw.ucr1 == 0 {
+		return errors.New("UART controller is not initialized")
+	}
+
+	rate, err := clock.SolveBaudrate(uartclk(), baud)
+
+	if err != nil {
+		return
+	}
+
+	reg.Wait(hw.usr2, USR2_TXDC, 1, 1)
+
+	hw.setBaudrate(rate)
+	hw.Baudrate = baud
+
+	return
+}
+
+// BaudrateError returns the relative error, in percent, between the
+// configured port speed (see Baudrate) and the one generated by the current
+// divider configuration (see SetBaudrate()).
+func (hw *UART) BaudrateError() float64 {
+	return float64(hw.rate.PPM) / 10000
+}
@@ -0,0 +1,197 @@
+// NXP i.MX6 UART DMA receive
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync/atomic"
+
+	"github.com/f-secure-foundry/tamago/dma"
+	"github.com/f-secure-foundry/tamago/internal/reg"
+)
+
+const (
+	// DMA receive buffer size
+	uartDMABufferSize = 4096
+	// DMA receive buffer periods (half/full buffer)
+	uartDMAPeriods = 2
+	// RX FIFO trigger level and SDMA watermark level for DMA receive
+	uartDMAWatermark = 16
+)
+
+// uartDMA represents a continuous DMA receive transfer.
+type uartDMA struct {
+	xfer sdmaTransfer
+
+	// SDMA channel
+	ch int
+	// buffer descriptors address
+	bds uint32
+	// receive buffer
+	buf []byte
+
+	// period being consumed and read offset within it
+	period int
+	off    int
+}
+
+// StartDMA enables continuous DMA receive, the received data is transferred
+// by the SDMA, without per character interrupts, to a circular buffer split
+// in two halves and made available to ReadDMA(). The SDMA controller must be
+// initialized (see SDMA.Init()), only UART1-5 are supported.
+//
+// The SDMA interrupt (SDMA_IRQ) is asserted whenever a half is filled, or
+// closed early by the receiver aging timer (i.e. after an idle line), and can
+// be used by applications to schedule ReadDMA() invocations. Once both halves
+// are filled, reception stops until data is consumed and further characters
+// are subject to overrun.
+//
+// While DMA receive is enabled Rx(), Read() and OnReceive() must not be used,
+// nor can interrupt driven reception be enabled (see EnableInterrupt()).
+func (hw *UART) StartDMA() (err error) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	if hw.ucr1 == 0 {
+		return errors.New("UART controller is not initialized")
+	}
+
+	if hw.n > 5 {
+		return errors.New("unsupported UART instance")
+	}
+
+	if hw.rxBuf != nil {
+		return errors.New("interrupt driven receive is active")
+	}
+
+	if hw.rxDMA != nil {
+		return errors.New("DMA receive already started")
+	}
+
+	addr, buf := dma.Reserve(uartDMABufferSize, 4)
+
+	d := &uartDMA{
+		xfer: sdmaTransfer{
+			script: SDMA_UART_2_MCU,
+			// SDMA request event (SDMA Event Mapping, IMX6ULLRM)
+			event: 2*hw.n + 23,
+			fifo:  hw.urxd,
+			wml:   uartDMAWatermark,
+			// 8-bit transfers
+			cmd:  1,
+			addr: addr,
+			size: uartDMABufferSize,
+		},
+		ch:  cyclicChannel + hw.n - 1,
+		buf: buf,
+	}
+
+	ARM.CacheFlushData()
+
+	if d.bds, err = SDMA.startCyclic(d.ch, &d.xfer, uartDMAPeriods); err != nil {
+		dma.Release(addr)
+		return
+	}
+
+	reg.SetN(hw.ufcr, UFCR_RXTL, 0b111111, uartDMAWatermark)
+
+	// enable DMA requests on RX FIFO trigger level, aging and idle
+	// conditions
+	reg.Set(hw.ucr4, UCR4_IDDMAEN)
+	reg.Set(hw.ucr1, UCR1_ATDMAEN)
+	reg.Set(hw.ucr1, UCR1_RXDMAEN)
+
+	hw.rxDMA = d
+
+	return
+}
+
+// StopDMA disables continuous DMA receive (see StartDMA()), any data not yet
+// consumed with ReadDMA() is discarded.
+func (hw *UART) StopDMA() {
+	hw.Lock()
+	defer hw.Unlock()
+
+	d := hw.rxDMA
+
+	if d == nil {
+		return
+	}
+
+	reg.Clear(hw.ucr1, UCR1_RXDMAEN)
+	reg.Clear(hw.ucr1, UCR1_ATDMAEN)
+	reg.Clear(hw.ucr4, UCR4_IDDMAEN)
+
+	reg.SetN(hw.ufcr, UFCR_RXTL, 0b111111, 1)
+
+	SDMA.stopCyclic(d.ch, d.bds, &d.xfer)
+	dma.Release(d.xfer.addr)
+
+	hw.rxDMA = nil
+}
+
+// ReadDMA copies to the argument buffer the data accumulated by continuous
+// DMA receive (see StartDMA()), returning the number of bytes copied. Each
+// half of the circular buffer is returned to the SDMA once entirely
+// consumed.
+func (hw *UART) ReadDMA(p []byte) (n int, err error) {
+	var desc [bdSize]byte
+
+	hw.Lock()
+	defer hw.Unlock()
+
+	d := hw.rxDMA
+
+	if d == nil {
+		return 0, errors.New("DMA receive not started")
+	}
+
+	// ensure coherency with the SDMA view of memory
+	ARM.CacheFlushData()
+
+	size := d.xfer.size / uartDMAPeriods
+
+	for n < len(p) {
+		dma.Read(d.bds, d.period*bdSize, desc[:])
+
+		mode := binary.LittleEndian.Uint32(desc[0:])
+		status := (mode >> 16) & 0xff
+
+		if status&BD_DONE != 0 {
+			// period still owned by the SDMA
+			break
+		}
+
+		if status&BD_RROR != 0 {
+			err = errors.New("SDMA receive error")
+		}
+
+		// the SDMA updates the count with the received bytes
+		count := int(mode & 0xffff)
+		start := d.period * size
+
+		c := copy(p[n:], d.buf[start+d.off:start+count])
+		n += c
+		d.off += c
+		atomic.AddUint32(&hw.received, uint32(c))
+
+		if d.off < count {
+			break
+		}
+
+		SDMA.rearm(d.ch, d.bds, &d.xfer, d.period, uartDMAPeriods)
+
+		d.off = 0
+		d.period = (d.period + 1) % uartDMAPeriods
+	}
+
+	return
+}
@@ -0,0 +1,192 @@
+// NXP i.MX6 UART driver
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"github.com/f-secure-foundry/tamago/internal/reg"
+)
+
+// The following types provide typed access to the UART register fields, as
+// an alternative to raw positions and masks (e.g. `UART2.UCR2.TXEN.Set()`).
+//
+// The fields are defined from the UART register constants and are available
+// after UART initialization (see Init()).
+
+type ucr1Fields struct {
+	ADEN     reg.Field
+	ADBR     reg.Field
+	TRDYEN   reg.Field
+	IDEN     reg.Field
+	ICD      reg.Field
+	RRDYEN   reg.Field
+	RXDMAEN  reg.Field
+	IREN     reg.Field
+	TXMPTYEN reg.Field
+	RTSDEN   reg.Field
+	SNDBRK   reg.Field
+	TXDMAEN  reg.Field
+	ATDMAEN  reg.Field
+	DOZE     reg.Field
+	UARTEN   reg.Field
+}
+
+type ucr2Fields struct {
+	ESCI  reg.Field
+	IRTS  reg.Field
+	CTSC  reg.Field
+	CTS   reg.Field
+	ESCEN reg.Field
+	RTEC  reg.Field
+	PREN  reg.Field
+	PROE  reg.Field
+	STPB  reg.Field
+	WS    reg.Field
+	RTSEN reg.Field
+	ATEN  reg.Field
+	TXEN  reg.Field
+	RXEN  reg.Field
+	SRST  reg.Field
+}
+
+type ucr3Fields struct {
+	DPEC      reg.Field
+	DTREN     reg.Field
+	PARERREN  reg.Field
+	FRAERREN  reg.Field
+	DSR       reg.Field
+	DCD       reg.Field
+	RI        reg.Field
+	ADNIMP    reg.Field
+	RXDSEN    reg.Field
+	AIRINTEN  reg.Field
+	AWAKEN    reg.Field
+	DTRDEN    reg.Field
+	RXDMUXSEL reg.Field
+	INVT      reg.Field
+	ACIEN     reg.Field
+}
+
+type ucr4Fields struct {
+	CTSTL   reg.Field
+	INVR    reg.Field
+	IDDMAEN reg.Field
+	IRSC    reg.Field
+}
+
+type ufcrFields struct {
+	TXTL   reg.Field
+	RFDIV  reg.Field
+	DCEDTE reg.Field
+	RXTL   reg.Field
+}
+
+type usr1Fields struct {
+	AWAKE reg.Field
+}
+
+type usr2Fields struct {
+	RDR reg.Field
+}
+
+type utsFields struct {
+	TXEMPTY reg.Field
+	RXEMPTY reg.Field
+	TXFULL  reg.Field
+	RXFULL  reg.Field
+}
+
+func bitField(addr uint32, pos int) reg.Field {
+	return reg.Field{Addr: addr, Pos: pos, Mask: 1}
+}
+
+func (hw *UART) initFields() {
+	hw.UCR1 = ucr1Fields{
+		ADEN:     bitField(hw.ucr1, UCR1_ADEN),
+		ADBR:     bitField(hw.ucr1, UCR1_ADBR),
+		TRDYEN:   bitField(hw.ucr1, UCR1_TRDYEN),
+		IDEN:     bitField(hw.ucr1, UCR1_IDEN),
+		ICD:      reg.Field{Addr: hw.ucr1, Pos: UCR1_ICD, Mask: 0b11},
+		RRDYEN:   bitField(hw.ucr1, UCR1_RRDYEN),
+		RXDMAEN:  bitField(hw.ucr1, UCR1_RXDMAEN),
+		IREN:     bitField(hw.ucr1, UCR1_IREN),
+		TXMPTYEN: bitField(hw.ucr1, UCR1_TXMPTYEN),
+		RTSDEN:   bitField(hw.ucr1, UCR1_RTSDEN),
+		SNDBRK:   bitField(hw.ucr1, UCR1_SNDBRK),
+		TXDMAEN:  bitField(hw.ucr1, UCR1_TXDMAEN),
+		ATDMAEN:  bitField(hw.ucr1, UCR1_ATDMAEN),
+		DOZE:     bitField(hw.ucr1, UCR1_DOZE),
+		UARTEN:   bitField(hw.ucr1, UCR1_UARTEN),
+	}
+
+	hw.UCR2 = ucr2Fields{
+		ESCI:  bitField(hw.ucr2, UCR2_ESCI),
+		IRTS:  bitField(hw.ucr2, UCR2_IRTS),
+		CTSC:  bitField(hw.ucr2, UCR2_CTSC),
+		CTS:   bitField(hw.ucr2, UCR2_CTS),
+		ESCEN: bitField(hw.ucr2, UCR2_ESCEN),
+		RTEC:  reg.Field{Addr: hw.ucr2, Pos: UCR2_RTEC, Mask: 0b11},
+		PREN:  bitField(hw.ucr2, UCR2_PREN),
+		PROE:  bitField(hw.ucr2, UCR2_PROE),
+		STPB:  bitField(hw.ucr2, UCR2_STPB),
+		WS:    bitField(hw.ucr2, UCR2_WS),
+		RTSEN: bitField(hw.ucr2, UCR2_RTSEN),
+		ATEN:  bitField(hw.ucr2, UCR2_ATEN),
+		TXEN:  bitField(hw.ucr2, UCR2_TXEN),
+		RXEN:  bitField(hw.ucr2, UCR2_RXEN),
+		SRST:  bitField(hw.ucr2, UCR2_SRST),
+	}
+
+	hw.UCR3 = ucr3Fields{
+		DPEC:      reg.Field{Addr: hw.ucr3, Pos: UCR3_DPEC, Mask: 0b11},
+		DTREN:     bitField(hw.ucr3, UCR3_DTREN),
+		PARERREN:  bitField(hw.ucr3, UCR3_PARERREN),
+		FRAERREN:  bitField(hw.ucr3, UCR3_FRAERREN),
+		DSR:       bitField(hw.ucr3, UCR3_DSR),
+		DCD:       bitField(hw.ucr3, UCR3_DCD),
+		RI:        bitField(hw.ucr3, UCR3_RI),
+		ADNIMP:    bitField(hw.ucr3, UCR3_ADNIMP),
+		RXDSEN:    bitField(hw.ucr3, UCR3_RXDSEN),
+		AIRINTEN:  bitField(hw.ucr3, UCR3_AIRINTEN),
+		AWAKEN:    bitField(hw.ucr3, UCR3_AWAKEN),
+		DTRDEN:    bitField(hw.ucr3, UCR3_DTRDEN),
+		RXDMUXSEL: bitField(hw.ucr3, UCR3_RXDMUXSEL),
+		INVT:      bitField(hw.ucr3, UCR3_INVT),
+		ACIEN:     bitField(hw.ucr3, UCR3_ACIEN),
+	}
+
+	hw.UCR4 = ucr4Fields{
+		CTSTL:   reg.Field{Addr: hw.ucr4, Pos: UCR4_CTSTL, Mask: 0b111111},
+		INVR:    bitField(hw.ucr4, UCR4_INVR),
+		IDDMAEN: bitField(hw.ucr4, UCR4_IDDMAEN),
+		IRSC:    bitField(hw.ucr4, UCR4_IRSC),
+	}
+
+	hw.UFCR = ufcrFields{
+		TXTL:   reg.Field{Addr: hw.ufcr, Pos: UFCR_TXTL, Mask: 0b111111},
+		RFDIV:  reg.Field{Addr: hw.ufcr, Pos: UFCR_RFDIV, Mask: 0b111},
+		DCEDTE: bitField(hw.ufcr, UFCR_DCEDTE),
+		RXTL:   reg.Field{Addr: hw.ufcr, Pos: UFCR_RXTL, Mask: 0b111111},
+	}
+
+	hw.USR1 = usr1Fields{
+		AWAKE: bitField(hw.usr1, USR1_AWAKE),
+	}
+
+	hw.USR2 = usr2Fields{
+		RDR: bitField(hw.usr2, USR2_RDR),
+	}
+
+	hw.UTS = utsFields{
+		TXEMPTY: bitField(hw.uts, UTS_TXEMPTY),
+		RXEMPTY: bitField(hw.uts, UTS_RXEMPTY),
+		TXFULL:  bitField(hw.uts, UTS_TXFULL),
+		RXFULL:  bitField(hw.uts, UTS_RXFULL),
+	}
+}
@@ -0,0 +1,97 @@
+// NXP i.MX6 UART driver
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/f-secure-foundry/tamago/internal/reg"
+)
+
+// Default RX FIFO level for CTS deassertion, 16 characters as the maximum
+// value leads to overflow even with hardware flow control in place.
+const uartFlowThreshold = 16
+
+// EnableFlowControl enables hardware RTS/CTS flow control, the receiver
+// deasserts CTS_B once the RX FIFO holds the argument number of characters
+// (UCR4_CTSTL, up to 32) and the transmitter is held off while the RTS_B
+// input is deasserted (UCR2_IRTS cleared).
+//
+// Flow control is disabled unless enabled with this function, or with the
+// Flow field before Init(). The setting is retained by subsequent Init()
+// invocations.
+//
+// The caller (e.g. board package) is responsible for the configuration of the
+// UARTx_CTS_B and UARTx_RTS_B pads, in their UART mux mode, as well as of the
+// RTS_B input daisy chain (IOMUXC_UARTx_RTS_B_SELECT_INPUT). In DCE mode (see
+// SetRole()) CTS_B is an output and RTS_B an input, in DTE mode their
+// directions are swapped.
+func (hw *UART) EnableFlowControl(rxThreshold int) (err error) {
+	if rxThreshold <= 0 || rxThreshold > 32 {
+		return errors.New("invalid threshold")
+	}
+
+	hw.Lock()
+	defer hw.Unlock()
+
+	hw.Flow = true
+	hw.flowThreshold = rxThreshold
+
+	if hw.ucr1 == 0 {
+		return
+	}
+
+	reg.SetN(hw.ucr4, UCR4_CTSTL, 0b111111, uint32(rxThreshold))
+	// Receiver controls CTS
+	reg.Set(hw.ucr2, UCR2_CTSC)
+	// Honor the RTS pin
+	reg.Clear(hw.ucr2, UCR2_IRTS)
+
+	return
+}
+
+// DisableFlowControl disables hardware RTS/CTS flow control (see
+// EnableFlowControl()).
+func (hw *UART) DisableFlowControl() {
+	hw.Lock()
+	defer hw.Unlock()
+
+	hw.Flow = false
+
+	if hw.ucr1 == 0 {
+		return
+	}
+
+	// Ignore the RTS pin
+	reg.Set(hw.ucr2, UCR2_IRTS)
+	reg.Clear(hw.ucr2, UCR2_CTSC)
+	// 32 characters in the RxFIFO (maximum)
+	reg.SetN(hw.ucr4, UCR4_CTSTL, 0b111111, 32)
+}
+
+// writeFlow transmits data with hardware flow control, each character is
+// written once the TX FIFO has room, so that a peer holding off the
+// transmitter results in a timeout rather than an endless wait.
+func (hw *UART) writeFlow(buf []byte) (n int, err error) {
+	for n = 0; n < len(buf); n++ {
+		if !reg.WaitFor(hw.Timeout, hw.uts, UTS_TXFULL, 1, 0) {
+			return n, fmt.Errorf("UART transmit %w", ErrTimeout)
+		}
+
+		reg.Write(hw.utxd, uint32(buf[n]))
+	}
+
+	if !reg.WaitFor(hw.Timeout, hw.uts, UTS_TXEMPTY, 1, 1) {
+		return n, fmt.Errorf("UART transmit %w", ErrTimeout)
+	}
+
+	return
+}
@@ -0,0 +1,176 @@
+// NXP i.MX6 UART driver
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/f-secure-foundry/tamago/internal/reg"
+	"github.com/f-secure-foundry/tamago/internal/ring"
+)
+
+// default software receive buffer size (see RxBufferSize)
+const uartRxBufferSize = 256
+
+// EnableInterrupt enables interrupt driven reception, the receiver ready
+// interrupt (UCR1_RRDYEN) is enabled, registered with ServiceUARTInterrupt()
+// as handler (see arm.CPU.RegisterInterrupt()) and forwarded by the GIC, so
+// that each received character is moved from the RX FIFO to a software buffer
+// of RxBufferSize bytes, from which Rx() and Read() serve data afterwards.
+//
+// This prevents data loss while the receiver is not serviced (e.g. during
+// long computations) beyond the 32 characters RX FIFO. Characters received
+// with the software buffer full are discarded and accounted by RxOverruns().
+//
+// The GIC must be initialized and the CPU interrupts must be enabled (see
+// ARM.InterruptsEnable()). When an application IRQ handler is set (see
+// arm.InterruptHandler()), which takes precedence over registered handlers,
+// it must invoke ServiceUARTInterrupt() for UART interrupts.
+//
+// While interrupt driven reception is enabled DMA receive (see StartDMA())
+// must not be used.
+func (hw *UART) EnableInterrupt() (err error) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	if hw.ucr1 == 0 {
+		return errors.New("UART controller is not initialized")
+	}
+
+	if hw.rxDMA != nil {
+		return errors.New("DMA receive is active")
+	}
+
+	if hw.rxBuf != nil {
+		return
+	}
+
+	if hw.RxBufferSize == 0 {
+		hw.RxBufferSize = uartRxBufferSize
+	}
+
+	// allocated outside interrupt context, see ring.NewBuffer()
+	buf, err := ring.NewBuffer(hw.RxBufferSize)
+
+	if err != nil {
+		return
+	}
+
+	hw.rxQueued = 0
+	hw.rxConsumed = 0
+	hw.rxErrCode = 0
+	hw.rxBuf = buf
+
+	irq := hw.irq
+	ARM.RegisterInterrupt(irq, func() { ServiceUARTInterrupt(irq) })
+
+	reg.Set(hw.ucr1, UCR1_RRDYEN)
+	ARM.EnableInterrupt(irq)
+
+	return
+}
+
+// DisableInterrupt disables interrupt driven reception (see
+// EnableInterrupt()), any data left in the software buffer is discarded and
+// the RX FIFO is polled again by Rx() and Read().
+func (hw *UART) DisableInterrupt() {
+	hw.Lock()
+	defer hw.Unlock()
+
+	if hw.rxBuf == nil {
+		return
+	}
+
+	reg.Clear(hw.ucr1, UCR1_RRDYEN)
+	ARM.DisableInterrupt(hw.irq)
+	ARM.RegisterInterrupt(hw.irq, nil)
+
+	hw.rxBuf = nil
+}
+
+// readBuffer receives data from the software receive buffer, stopping at the
+// position of any pending receive error, which is then returned.
+func (hw *UART) readBuffer(rxBuf *ring.Buffer, buf []byte) (n int, err error) {
+	if code := atomic.LoadUint32(&hw.rxErrCode); code != 0 {
+		pending := atomic.LoadUint32(&hw.rxErrOffset) - hw.rxConsumed
+
+		if pending == 0 {
+			atomic.StoreUint32(&hw.rxErrCode, 0)
+			return 0, uartErrors[code]
+		}
+
+		if int(pending) < len(buf) {
+			buf = buf[:pending]
+		}
+	}
+
+	n = rxBuf.Read(buf)
+	hw.rxConsumed += uint32(n)
+
+	return
+}
+
+// RxOverruns returns the number of characters discarded, during interrupt
+// driven reception, as the software receive buffer was full (see
+// EnableInterrupt()).
+//
+// Unlike RX FIFO overruns (see Status()), these are caused by data not being
+// consumed in time with Rx() or Read(), rather than by the receiver not being
+// serviced.
+func (hw *UART) RxOverruns() uint64 {
+	return atomic.LoadUint64(&hw.rxOverruns)
+}
+
+// ServiceUARTInterrupt moves all characters available in the RX FIFO to the
+// software receive buffer of the UART instance, with interrupt driven
+// reception enabled (see EnableInterrupt()), matching the argument interrupt
+// ID. It returns whether the interrupt ID belongs to such instance.
+//
+// The function is registered as handler by EnableInterrupt(), it only needs
+// to be invoked by an application IRQ handler (see arm.InterruptHandler()) for
+// any interrupt acknowledged with ARM.GetInterrupt().
+func ServiceUARTInterrupt(id int) (uart bool) {
+	// the instance table is never shrunk and is read without locking, as
+	// the function runs in interrupt context
+	for i := 0; i < uartsCount; i++ {
+		hw := uarts[i]
+
+		if hw.irq != id {
+			continue
+		}
+
+		buf := hw.rxBuf
+
+		if buf == nil {
+			return false
+		}
+
+		for hw.rxReady() {
+			c, valid, code := hw.rxFIFO()
+
+			switch {
+			case code != 0:
+				// the error offset must be visible before its code
+				atomic.StoreUint32(&hw.rxErrOffset, hw.rxQueued)
+				atomic.StoreUint32(&hw.rxErrCode, code)
+			case !valid:
+			case buf.Put(c):
+				atomic.StoreUint32(&hw.rxQueued, hw.rxQueued+1)
+			default:
+				atomic.AddUint64(&hw.rxOverruns, 1)
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
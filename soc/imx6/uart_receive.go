@@ -0,0 +1,79 @@
+// NXP i.MX6 UART driver
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx6
+
+import (
+	"time"
+)
+
+const (
+	// receive polling interval, at 115200 bps about 12 characters are
+	// received within it, well below the 32 characters RX FIFO size
+	uartPollInterval = 1 * time.Millisecond
+	// maximum amount of data passed to each receive callback invocation
+	uartReceiveSize = 32
+)
+
+// OnReceive registers a function which is invoked with data received on the
+// serial port, replacing any previously registered one. A nil argument
+// unregisters the current function.
+//
+// The function is invoked from a dedicated goroutine, never in interrupt
+// context, which polls the receive FIFO. Invocations are serialized and
+// deliver data in reception order, each one passes a newly allocated slice
+// which the function can retain. After being replaced, or unregistered, a
+// function might still complete an invocation already in progress.
+//
+// No buffering takes place beyond the 32 characters RX FIFO, therefore while
+// the function executes further data can only be held by the FIFO. A slow
+// function applies backpressure up to the FIFO filling up, at which point
+// characters are lost and accounted as overruns (see Status()). Functions
+// which perform lengthy processing should hand off data to a separate
+// goroutine. Hardware flow control (see Flow) prevents data loss, with
+// compatible peers, by deasserting RTS when the FIFO fills up.
+//
+// While a function is registered the receive FIFO must not be drained by
+// other means (e.g. Rx(), Read()).
+func (hw *UART) OnReceive(fn func([]byte)) {
+	hw.rxMutex.Lock()
+	defer hw.rxMutex.Unlock()
+
+	if hw.rxDone != nil {
+		close(hw.rxDone)
+		hw.rxDone = nil
+	}
+
+	if fn == nil {
+		return
+	}
+
+	hw.rxDone = make(chan struct{})
+
+	go hw.receive(fn, hw.rxDone)
+}
+
+func (hw *UART) receive(fn func([]byte), done chan struct{}) {
+	var buf [uartReceiveSize]byte
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		if n, _ := hw.Read(buf[:]); n > 0 {
+			fn(append([]byte{}, buf[:n]...))
+			continue
+		}
+
+		time.Sleep(uartPollInterval)
+	}
+}
@@ -0,0 +1,180 @@
+// Serial over USB driver
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// Package acm implements a driver for serial port emulation over USB on i.MX6
+// SoCs.
+//
+// It implements the CDC Abstract Control Model (CDC-ACM), supported without
+// additional drivers by Linux (/dev/ttyACMx), macOS and Windows hosts. The
+// port implements the same interface of SoC UARTs (see `serial.Port`),
+// allowing its use as console or debug channel (e.g. with a board
+// AddConsoleBackend()).
+//
+// This package is only meant to be used with `GOOS=tamago GOARCH=arm` as
+// supported by the TamaGo framework for bare metal Go on ARM SoCs, see
+// https://github.com/f-secure-foundry/tamago.
+package acm
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+
+	"github.com/f-secure-foundry/tamago/internal/ring"
+	"github.com/f-secure-foundry/tamago/soc/imx6/usb"
+)
+
+// receive and transmit buffer size (power of 2)
+const bufferSize = 4096
+
+// Port represents a serial port over USB instance.
+type Port struct {
+	sync.Mutex
+
+	device *usb.Device
+
+	// receive buffer, filled by the endpoint 3 OUT function (ACMRx)
+	rxBuf   *ring.Buffer
+	rxMutex sync.Mutex
+
+	// transmit buffer, drained by the endpoint 3 IN function (ACMTx)
+	txBuf *ring.Buffer
+}
+
+// Init initializes a serial port over USB instance on a specific USB device
+// and configuration index.
+//
+// The port uses endpoints 3 (bulk IN/OUT) and 4 (interrupt IN), so that it can
+// be added to the same configuration of other functions using lower endpoint
+// numbers (e.g. `ethernet.NIC`).
+func (port *Port) Init(device *usb.Device, configurationIndex int) (err error) {
+	if device == nil || configurationIndex < 0 || configurationIndex >= len(device.Configurations) {
+		return errors.New("invalid configuration")
+	}
+
+	if port.rxBuf, err = ring.NewBuffer(bufferSize); err != nil {
+		return
+	}
+
+	if port.txBuf, err = ring.NewBuffer(bufferSize); err != nil {
+		return
+	}
+
+	if device.LineCoding.DTERate == 0 {
+		device.LineCoding.SetDefaults()
+	}
+
+	port.device = device
+
+	addControlInterface(device, configurationIndex, port)
+	addDataInterface(device, configurationIndex, port)
+
+	return
+}
+
+// ACMControl implements the endpoint 4 IN function.
+func (port *Port) ACMControl(_ []byte, lastErr error) (in []byte, err error) {
+	// no serial state notifications for now
+	return
+}
+
+// ACMRx implements the endpoint 3 OUT function, used to receive data from host
+// to device.
+//
+// Data is buffered, up to 4096 bytes, until it is read with Read() or Rx(),
+// with a full buffer the function waits, and the host is therefore flow
+// controlled, until data is consumed.
+func (port *Port) ACMRx(out []byte, lastErr error) (_ []byte, err error) {
+	for len(out) > 0 {
+		n := port.rxBuf.Write(out)
+		out = out[n:]
+
+		if len(out) > 0 {
+			runtime.Gosched()
+		}
+	}
+
+	return
+}
+
+// ACMTx implements the endpoint 3 IN function, used to transmit data from
+// device to host.
+func (port *Port) ACMTx(_ []byte, lastErr error) (in []byte, err error) {
+	n := port.txBuf.Len()
+
+	if n == 0 {
+		return
+	}
+
+	in = make([]byte, n)
+	n = port.txBuf.Read(in)
+
+	return in[:n], nil
+}
+
+// Connected returns whether the host has signaled presence of a terminal
+// (DTR), which typically takes place when the host serial device is opened.
+func (port *Port) Connected() bool {
+	if port.device == nil {
+		return false
+	}
+
+	return (port.device.ControlLineState>>usb.CONTROL_LINE_DTR)&1 == 1
+}
+
+// Write buffers data for transmission to the host, it waits until all data
+// has been buffered. It implements io.Writer.
+func (port *Port) Write(buf []byte) (n int, err error) {
+	port.Lock()
+	defer port.Unlock()
+
+	if port.txBuf == nil {
+		return 0, errors.New("port is not initialized")
+	}
+
+	for n < len(buf) {
+		n += port.txBuf.Write(buf[n:])
+
+		if n < len(buf) {
+			runtime.Gosched()
+		}
+	}
+
+	return
+}
+
+// Read receives available data from the host to the buffer, without blocking,
+// it returns the number of bytes read. It implements io.Reader.
+func (port *Port) Read(buf []byte) (n int, err error) {
+	if port.rxBuf == nil {
+		return 0, errors.New("port is not initialized")
+	}
+
+	port.rxMutex.Lock()
+	defer port.rxMutex.Unlock()
+
+	return port.rxBuf.Read(buf), nil
+}
+
+// Tx buffers a single character for transmission to the host.
+func (port *Port) Tx(c byte) {
+	port.Write([]byte{c})
+}
+
+// Rx receives a single character from the host, if available.
+func (port *Port) Rx() (c byte, valid bool) {
+	if port.rxBuf == nil {
+		return
+	}
+
+	port.rxMutex.Lock()
+	defer port.rxMutex.Unlock()
+
+	return port.rxBuf.Get()
+}
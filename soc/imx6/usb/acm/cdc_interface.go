@@ -0,0 +1,119 @@
+// Serial over USB driver
+// https://github.com/f-secure-foundry/tamago
+//
+// Copyright (c) F-Secure Corporation
+// https://foundry.f-secure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package acm
+
+import (
+	"github.com/f-secure-foundry/tamago/soc/imx6/usb"
+)
+
+// Build a CDC control interface.
+func addControlInterface(device *usb.Device, configurationIndex int, port *Port) (iface *usb.InterfaceDescriptor) {
+	conf := device.Configurations[configurationIndex]
+
+	iface = &usb.InterfaceDescriptor{}
+	iface.SetDefaults()
+
+	iface.NumEndpoints = 1
+	iface.InterfaceClass = 2
+	iface.InterfaceSubClass = 2
+	// AT commands (V.250), as expected by most host drivers
+	iface.InterfaceProtocol = 1
+
+	iInterface, _ := device.AddString(`CDC Abstract Control Model (ACM)`)
+	iface.Interface = iInterface
+
+	// Set IAD to be inserted before first interface, to support multiple
+	// functions in this same configuration.
+	iface.IAD = &usb.InterfaceAssociationDescriptor{}
+	iface.IAD.SetDefaults()
+	// control and data interfaces
+	iface.IAD.InterfaceCount = 2
+	iface.IAD.FunctionClass = iface.InterfaceClass
+	iface.IAD.FunctionSubClass = iface.InterfaceSubClass
+	iface.IAD.FunctionProtocol = iface.InterfaceProtocol
+
+	iFunction, _ := device.AddString(`CDC`)
+	iface.IAD.Function = iFunction
+
+	// the data interface follows the control one
+	controlInterface := conf.NumInterfaces
+	dataInterface := controlInterface + 1
+
+	iface.IAD.FirstInterface = controlInterface
+
+	header := &usb.CDCHeaderDescriptor{}
+	header.SetDefaults()
+
+	iface.ClassDescriptors = append(iface.ClassDescriptors, header.Bytes())
+
+	callManagement := &usb.CDCCallManagementDescriptor{}
+	callManagement.SetDefaults()
+	callManagement.DataInterface = dataInterface
+
+	iface.ClassDescriptors = append(iface.ClassDescriptors, callManagement.Bytes())
+
+	acm := &usb.CDCAbstractControlManagementDescriptor{}
+	acm.SetDefaults()
+
+	iface.ClassDescriptors = append(iface.ClassDescriptors, acm.Bytes())
+
+	union := &usb.CDCUnionDescriptor{}
+	union.SetDefaults()
+	union.MasterInterface = controlInterface
+	union.SlaveInterface0 = dataInterface
+
+	iface.ClassDescriptors = append(iface.ClassDescriptors, union.Bytes())
+
+	ep4IN := &usb.EndpointDescriptor{}
+	ep4IN.SetDefaults()
+	ep4IN.EndpointAddress = 0x84
+	ep4IN.Attributes = 3
+	ep4IN.MaxPacketSize = 16
+	ep4IN.Interval = 9
+	ep4IN.Function = port.ACMControl
+
+	iface.Endpoints = append(iface.Endpoints, ep4IN)
+
+	conf.AddInterface(iface)
+
+	return
+}
+
+// Build a CDC data interface.
+func addDataInterface(device *usb.Device, configurationIndex int, port *Port) (iface *usb.InterfaceDescriptor) {
+	iface = &usb.InterfaceDescriptor{}
+	iface.SetDefaults()
+
+	iface.NumEndpoints = 2
+	iface.InterfaceClass = 10
+
+	iInterface, _ := device.AddString(`CDC Data`)
+	iface.Interface = iInterface
+
+	ep3IN := &usb.EndpointDescriptor{}
+	ep3IN.SetDefaults()
+	ep3IN.EndpointAddress = 0x83
+	ep3IN.Attributes = 2
+	ep3IN.Function = port.ACMTx
+
+	iface.Endpoints = append(iface.Endpoints, ep3IN)
+
+	ep3OUT := &usb.EndpointDescriptor{}
+	ep3OUT.SetDefaults()
+	ep3OUT.EndpointAddress = 0x03
+	ep3OUT.Attributes = 2
+	ep3OUT.Function = port.ACMRx
+
+	iface.Endpoints = append(iface.Endpoints, ep3OUT)
+
+	device.Configurations[configurationIndex].AddInterface(iface)
+
+	return
+}
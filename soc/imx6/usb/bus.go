@@ -70,6 +70,7 @@ const (
 	PORTSC_PR        = 8
 
 	USB_UOGx_OTGSC = 0x1a4
+	OTGSC_BSV      = 11
 	OTGSC_OT       = 3
 
 	USB_UOGx_USBMODE  = 0x1a8
@@ -172,6 +173,9 @@ func (hw *USB) Init() {
 		panic("invalid USB controller instance")
 	}
 
+	imx6.RegisterRegion("USB", base, 0x200)
+	imx6.RegisterRegion("USBPHY", phyBase, 0x1000)
+
 	hw.ctrl = phyBase + USBPHYx_CTRL
 	hw.pwd = phyBase + USBPHYx_PWD
 	hw.chrg = analogBase + USB_ANALOG_USBx_CHRG_DETECT
@@ -190,7 +194,7 @@ func (hw *USB) Init() {
 	hw.epctrl = base + USB_UOGx_ENDPTCTRL
 
 	// enable clock
-	reg.SetN(imx6.CCM_CCGR6, imx6.CCGR6_CG0, 0b11, 0b11)
+	imx6.EnableClock(imx6.CLOCK_USBOH3)
 
 	// power up PLL
 	reg.Set(hw.pll, imx6.PLL_POWER)
@@ -246,6 +250,17 @@ func (hw *USB) Speed() (speed string) {
 	return
 }
 
+// Present returns whether the port is attached to a powered bus, as reported
+// by the B-session valid (VBUS) status, it implements imx6.Device to allow
+// attach detection with imx6.WatchDevices().
+func (hw *USB) Present() bool {
+	if hw.otg == 0 {
+		return false
+	}
+
+	return reg.Get(hw.otg, OTGSC_BSV, 1) == 1
+}
+
 // PowerDown shuts down the USB PHY.
 func (hw *USB) PowerDown() {
 	reg.Write(hw.pwd, 0xffffffff)
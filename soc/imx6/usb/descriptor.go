@@ -365,6 +365,11 @@ type Device struct {
 	ConfigurationValue uint8
 	AlternateSetting   uint8
 
+	// Host requested CDC-ACM settings (see SET_LINE_CODING and
+	// SET_CONTROL_LINE_STATE)
+	LineCoding       CDCLineCoding
+	ControlLineState uint16
+
 	// Optional class-specific setup handler
 	Setup SetupFunction
 }
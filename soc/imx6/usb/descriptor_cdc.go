@@ -20,17 +20,31 @@ const (
 	// USB Class Definitions for Communication Devices 1.1
 	CS_INTERFACE = 0x24
 
-	HEADER_LENGTH              = 5
-	UNION_LENGTH               = 5
-	ETHERNET_NETWORKING_LENGTH = 13
+	HEADER_LENGTH                      = 5
+	CALL_MANAGEMENT_LENGTH             = 5
+	ABSTRACT_CONTROL_MANAGEMENT_LENGTH = 4
+	UNION_LENGTH                       = 5
+	ETHERNET_NETWORKING_LENGTH         = 13
+	LINE_CODING_LENGTH                 = 7
 
 	// p64, Table 46: Class-Specific Request Codes,
 	// USB Class Definitions for Communication Devices 1.1
+	SET_LINE_CODING            = 0x20
+	GET_LINE_CODING            = 0x21
+	SET_CONTROL_LINE_STATE     = 0x22
 	SET_ETHERNET_PACKET_FILTER = 0x43
 
-	HEADER              = 0
-	UNION               = 6
-	ETHERNET_NETWORKING = 15
+	HEADER                      = 0
+	CALL_MANAGEMENT             = 1
+	ABSTRACT_CONTROL_MANAGEMENT = 2
+	UNION                       = 6
+	ETHERNET_NETWORKING         = 15
+
+	// Control signals, Table 51: Control Signal Bitmap Values for
+	// SetControlLineState, USB Class Definitions for Communication Devices
+	// 1.1
+	CONTROL_LINE_DTR = 0
+	CONTROL_LINE_RTS = 1
 
 	// Maximum Segment Size
 	MSS = 1500 + 14
@@ -63,6 +77,59 @@ func (d *CDCHeaderDescriptor) Bytes() []byte {
 	return buf.Bytes()
 }
 
+// CDCCallManagementDescriptor implements
+// Table 27: Call Management Functional Descriptor, USB Class Definitions for
+// Communication Devices 1.1.
+type CDCCallManagementDescriptor struct {
+	Length            uint8
+	DescriptorType    uint8
+	DescriptorSubType uint8
+	Capabilities      uint8
+	DataInterface     uint8
+}
+
+// SetDefaults initializes default values for the USB CDC Call Management
+// Functional Descriptor.
+func (d *CDCCallManagementDescriptor) SetDefaults() {
+	d.Length = CALL_MANAGEMENT_LENGTH
+	d.DescriptorType = CS_INTERFACE
+	d.DescriptorSubType = CALL_MANAGEMENT
+}
+
+// Bytes converts the descriptor structure to byte array format.
+func (d *CDCCallManagementDescriptor) Bytes() []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, d)
+	return buf.Bytes()
+}
+
+// CDCAbstractControlManagementDescriptor implements
+// Table 28: Abstract Control Management Functional Descriptor, USB Class
+// Definitions for Communication Devices 1.1.
+type CDCAbstractControlManagementDescriptor struct {
+	Length            uint8
+	DescriptorType    uint8
+	DescriptorSubType uint8
+	Capabilities      uint8
+}
+
+// SetDefaults initializes default values for the USB CDC Abstract Control
+// Management Functional Descriptor.
+func (d *CDCAbstractControlManagementDescriptor) SetDefaults() {
+	d.Length = ABSTRACT_CONTROL_MANAGEMENT_LENGTH
+	d.DescriptorType = CS_INTERFACE
+	d.DescriptorSubType = ABSTRACT_CONTROL_MANAGEMENT
+	// supports Set_Line_Coding, Set_Control_Line_State, Get_Line_Coding
+	d.Capabilities = 0x02
+}
+
+// Bytes converts the descriptor structure to byte array format.
+func (d *CDCAbstractControlManagementDescriptor) Bytes() []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, d)
+	return buf.Bytes()
+}
+
 // CDCUnionDescriptor implements
 // p51, Table 33: Union Interface Functional Descriptor, USB Class Definitions
 // for Communication Devices 1.1.
@@ -118,3 +185,31 @@ func (d *CDCEthernetDescriptor) Bytes() []byte {
 	binary.Write(buf, binary.LittleEndian, d)
 	return buf.Bytes()
 }
+
+// CDCLineCoding implements
+// Table 50: Line Coding Structure, USB Class Definitions for Communication
+// Devices 1.1.
+type CDCLineCoding struct {
+	// data terminal rate, in bits per second
+	DTERate uint32
+	// stop bits: 0 (1 stop bit), 1 (1.5 stop bits), 2 (2 stop bits)
+	CharFormat uint8
+	// parity: 0 (none), 1 (odd), 2 (even), 3 (mark), 4 (space)
+	ParityType uint8
+	// data bits: 5, 6, 7, 8 or 16
+	DataBits uint8
+}
+
+// SetDefaults initializes default values (115200 8N1) for the USB CDC line
+// coding.
+func (d *CDCLineCoding) SetDefaults() {
+	d.DTERate = 115200
+	d.DataBits = 8
+}
+
+// Bytes converts the line coding structure to byte array format.
+func (d *CDCLineCoding) Bytes() []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, d)
+	return buf.Bytes()
+}
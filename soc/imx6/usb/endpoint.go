@@ -361,7 +361,7 @@ func (hw *USB) transfer(n int, dir int, ioc bool, buf []byte) (out []byte, err e
 
 	size, err := checkDTD(n, dir, dtds, hw.done)
 
-	if n != 0 && dir == OUT && buf != nil {
+	if dir == OUT && buf != nil {
 		out = buf[0:size]
 		dma.Read(pages, 0, out)
 	}
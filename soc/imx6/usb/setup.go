@@ -10,6 +10,7 @@
 package usb
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 
@@ -177,6 +178,13 @@ func (hw *USB) handleSetup(dev *Device, setup *SetupData) (err error) {
 	case SET_INTERFACE:
 		dev.AlternateSetting = uint8(setup.Value >> 8)
 		err = hw.ack(0)
+	case SET_LINE_CODING:
+		err = hw.setLineCoding(dev, setup)
+	case GET_LINE_CODING:
+		err = hw.tx(0, false, trim(dev.LineCoding.Bytes(), setup.Length))
+	case SET_CONTROL_LINE_STATE:
+		dev.ControlLineState = (setup.Value<<8)&0xff00 | (setup.Value >> 8)
+		err = hw.ack(0)
 	case SET_ETHERNET_PACKET_FILTER:
 		// no meaningful action for now
 		err = hw.ack(0)
@@ -188,6 +196,32 @@ func (hw *USB) handleSetup(dev *Device, setup *SetupData) (err error) {
 	return
 }
 
+// setLineCoding receives the line coding structure from the data stage of a
+// SET_LINE_CODING request.
+func (hw *USB) setLineCoding(dev *Device, setup *SetupData) (err error) {
+	if setup.Length != LINE_CODING_LENGTH {
+		hw.stall(0, IN)
+		return fmt.Errorf("invalid line coding length %d", setup.Length)
+	}
+
+	out, err := hw.rx(0, false, make([]byte, setup.Length))
+
+	if err != nil {
+		return
+	}
+
+	if len(out) != LINE_CODING_LENGTH {
+		hw.stall(0, IN)
+		return fmt.Errorf("invalid line coding data length %d", len(out))
+	}
+
+	if err = binary.Read(bytes.NewReader(out), binary.LittleEndian, &dev.LineCoding); err != nil {
+		return
+	}
+
+	return hw.ack(0)
+}
+
 func trim(buf []byte, wLength uint16) []byte {
 	if int(wLength) < len(buf) {
 		buf = buf[0:wLength]
@@ -12,6 +12,7 @@
 package usdhc
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -151,7 +152,7 @@ func (hw *USDHC) cmd(index uint32, arg uint32, blocks uint32, timeout time.Durat
 
 	dmasel := uint32(DMASEL_NONE)
 
-	if blocks > 0 {
+	if blocks > 0 && !hw.PIO {
 		dmasel = DMASEL_ADMA2
 		reg.Write(hw.int_signal_en, 0xffffffff)
 	}
@@ -200,8 +201,13 @@ func (hw *USDHC) cmd(index uint32, arg uint32, blocks uint32, timeout time.Durat
 
 		// enable data presence
 		bits.Set(&xfr, CMD_XFR_TYP_DPSEL)
-		// enable DMA
-		bits.Set(&mix, MIX_CTRL_DMAEN)
+
+		if hw.PIO {
+			bits.Clear(&mix, MIX_CTRL_DMAEN)
+		} else {
+			// enable DMA
+			bits.Set(&mix, MIX_CTRL_DMAEN)
+		}
 		// enable automatic CMD12 to stop transactions
 		bits.Set(&mix, MIX_CTRL_AC12EN)
 
@@ -230,6 +236,14 @@ func (hw *USDHC) cmd(index uint32, arg uint32, blocks uint32, timeout time.Durat
 	reg.Write(hw.mix_ctrl, mix)
 	reg.Write(hw.cmd_xfr, xfr)
 
+	if blocks > 0 && hw.PIO {
+		if err = hw.pio(params.dtd, timeout); err != nil {
+			return fmt.Errorf("CMD%d:%v pres_state:%#x int_status:%#x", index, err,
+				reg.Read(hw.pres_state),
+				reg.Read(hw.int_status))
+		}
+	}
+
 	// wait for completion
 	if !reg.WaitFor(timeout, hw.int_status, int_status, 1, 1) {
 		err = fmt.Errorf("CMD%d:timeout pres_state:%#x int_status:%#x", index,
@@ -266,6 +280,42 @@ func (hw *USDHC) cmd(index uint32, arg uint32, blocks uint32, timeout time.Durat
 	return
 }
 
+// pio transfers data, through the buffer data port, with programmed I/O. The
+// watermark levels are set to the block size, therefore each buffer read or
+// write ready status is serviced with a burst of one full block
+// (Data Buffer, IMX6ULLRM).
+func (hw *USDHC) pio(dtd uint32, timeout time.Duration) (err error) {
+	var ready int
+
+	buf := hw.pioBuf
+	size := int(hw.pioBlockSize)
+
+	switch dtd {
+	case READ:
+		ready = INT_STATUS_BRR
+	case WRITE:
+		ready = INT_STATUS_BWR
+	}
+
+	for off := 0; off < len(buf); off += size {
+		if !reg.WaitFor(timeout, hw.int_status, ready, 1, 1) {
+			return errors.New("PIO timeout")
+		}
+
+		// clear buffer ready status
+		reg.Write(hw.int_status, 1<<ready)
+
+		switch dtd {
+		case READ:
+			reg.ReadFIFO(hw.data_buff, buf[off:off+size])
+		case WRITE:
+			reg.WriteFIFO(hw.data_buff, buf[off:off+size])
+		}
+	}
+
+	return
+}
+
 func (hw *USDHC) rsp(i int) uint32 {
 	if i > 3 {
 		return 0
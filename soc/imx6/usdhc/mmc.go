@@ -251,7 +251,9 @@ func (hw *USDHC) initMMC() (err error) {
 		// clear clock
 		hw.setClock(-1, -1)
 		// set operating frequency
-		hw.setClock(DVS_OP, SDCLKFS_OP)
+		if err = hw.setClock(DVS_OP, SDCLKFS_OP); err != nil {
+			return
+		}
 	} else {
 		return fmt.Errorf("unexpected TRAN_SPEED %#x", mhz)
 	}
@@ -333,7 +335,10 @@ func (hw *USDHC) initMMC() (err error) {
 
 	hw.setClock(-1, -1)
 	hw.setRootClock(root_clk, 0)
-	hw.setClock(DVS_HS, clk)
+
+	if err = hw.setClock(DVS_HS, clk); err != nil {
+		return
+	}
 
 	if tune {
 		// FIXME: Use fixed sampling clock as eMMC tuning fails for unknown reasons.
@@ -302,7 +302,9 @@ func (hw *USDHC) voltageSwitchSD() (err error) {
 
 	time.Sleep(10 * time.Millisecond)
 
-	hw.setClock(DVS_OP, SDCLKFS_OP)
+	if err = hw.setClock(DVS_OP, SDCLKFS_OP); err != nil {
+		return
+	}
 
 	if !reg.WaitFor(1*time.Millisecond, hw.pres_state, PRES_STATE_DLSL, 1, 1) {
 		return fmt.Errorf("voltage switch failed, invalid data line")
@@ -345,7 +347,10 @@ func (hw *USDHC) initSD() (err error) {
 
 	if hw.card.Rate == HS_MBPS {
 		hw.setClock(-1, -1)
-		hw.setClock(DVS_OP, SDCLKFS_OP)
+
+		if err = hw.setClock(DVS_OP, SDCLKFS_OP); err != nil {
+			return
+		}
 	}
 
 	// set relative card address
@@ -425,7 +430,10 @@ func (hw *USDHC) initSD() (err error) {
 
 	hw.setClock(-1, -1)
 	hw.setRootClock(root_clk, 0)
-	hw.setClock(DVS_HS, clk)
+
+	if err = hw.setClock(DVS_HS, clk); err != nil {
+		return
+	}
 
 	if tune {
 		err = hw.executeTuningSD()
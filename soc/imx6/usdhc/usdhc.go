@@ -83,10 +83,14 @@ const (
 	USDHCx_CMD_RSP2 = 0x18
 	USDHCx_CMD_RSP3 = 0x1c
 
+	USDHCx_DATA_BUFF_ACC_PORT = 0x20
+
 	USDHCx_PRES_STATE = 0x24
 	PRES_STATE_DLSL   = 24
 	PRES_STATE_WPSPL  = 19
+	PRES_STATE_CINST  = 16
 	PRES_STATE_BREN   = 11
+	PRES_STATE_BWEN   = 10
 	PRES_STATE_SDSTB  = 3
 	PRES_STATE_CDIHB  = 1
 	PRES_STATE_CIHB   = 0
@@ -114,6 +118,7 @@ const (
 	INT_STATUS_CCE    = 17
 	INT_STATUS_CTOE   = 16
 	INT_STATUS_BRR    = 5
+	INT_STATUS_BWR    = 4
 	INT_STATUS_TC     = 1
 	INT_STATUS_CC     = 0
 
@@ -201,6 +206,10 @@ const (
 
 )
 
+// Timeout for controller reset, initialization and clock stabilization, which
+// do not depend on card presence.
+const ctrlTimeout = 10 * time.Millisecond
+
 // CardInfo holds detected card information.
 type CardInfo struct {
 	// eMMC card
@@ -231,6 +240,11 @@ type USDHC struct {
 	// reflects whether LV I/O signaling is present.
 	LowVoltage func() bool
 
+	// PIO selects programmed I/O, rather than ADMA2, for data transfers
+	// (e.g. under emulation or during bring-up, where DMA might be
+	// unreliable).
+	PIO bool
+
 	// controller index
 	n int
 	// bus width
@@ -246,6 +260,7 @@ type USDHC struct {
 	cmd_arg         uint32
 	cmd_xfr         uint32
 	cmd_rsp         uint32
+	data_buff       uint32
 	prot_ctrl       uint32
 	sys_ctrl        uint32
 	mix_ctrl        uint32
@@ -266,6 +281,10 @@ type USDHC struct {
 	// eMMC Replay Protected Memory Block (RPMB) operation
 	rpmb bool
 
+	// programmed I/O transfer buffer and block size
+	pioBuf       []byte
+	pioBlockSize uint32
+
 	readTimeout  time.Duration
 	writeTimeout time.Duration
 }
@@ -344,7 +363,7 @@ func (hw *USDHC) setRootClock(podf uint32, sel uint32) (err error) {
 // setClock controls the clock of USDHCx_CLK line by setting
 // the SDCLKFS and DVS fields of USDHCx_SYS_CTRL register
 // p4035, 58.8.12 System Control (uSDHCx_SYS_CTRL), IMX6ULLRM.
-func (hw *USDHC) setClock(dvs int, sdclkfs int) {
+func (hw *USDHC) setClock(dvs int, sdclkfs int) (err error) {
 	// Prevent possible glitch on the card clock as noted in
 	// p4011, 58.7.7 Change Clock Frequency, IMX6ULLRM.
 	reg.Clear(hw.vend_spec, VEND_SPEC_FRC_SDCLK_ON)
@@ -355,7 +374,9 @@ func (hw *USDHC) setClock(dvs int, sdclkfs int) {
 
 	// Wait for stable clock as noted in
 	// p4038, DVS[3:0], IMX6ULLRM.
-	reg.Wait(hw.pres_state, PRES_STATE_SDSTB, 1, 1)
+	if !reg.WaitFor(ctrlTimeout, hw.pres_state, PRES_STATE_SDSTB, 1, 1) {
+		return fmt.Errorf("uSDHC%d clock stabilization %w", hw.n, imx6.ErrTimeout)
+	}
 
 	sys := reg.Read(hw.sys_ctrl)
 
@@ -364,11 +385,16 @@ func (hw *USDHC) setClock(dvs int, sdclkfs int) {
 	bits.SetN(&sys, SYS_CTRL_SDCLKFS, 0xff, uint32(sdclkfs))
 
 	reg.Write(hw.sys_ctrl, sys)
-	reg.Wait(hw.pres_state, PRES_STATE_SDSTB, 1, 1)
+
+	if !reg.WaitFor(ctrlTimeout, hw.pres_state, PRES_STATE_SDSTB, 1, 1) {
+		return fmt.Errorf("uSDHC%d clock stabilization %w", hw.n, imx6.ErrTimeout)
+	}
 
 	if hw.card.SD {
 		reg.Set(hw.vend_spec, VEND_SPEC_FRC_SDCLK_ON)
 	}
+
+	return
 }
 
 // executeTuning performs the bus tuning, `cmd` should be set to the relevant
@@ -420,6 +446,22 @@ func (hw *USDHC) detect() (sd bool, mmc bool, hc bool, err error) {
 	return
 }
 
+// Present returns whether a card is inserted, as reported by the controller
+// card detection (PRES_STATE_CINST) which requires the slot card detect line
+// to be routed to the controller CD_B pad, it implements imx6.Device to allow
+// hot-plug detection with imx6.WatchDevices().
+//
+// Boards with a card detect line routed to a GPIO, non removable devices
+// (e.g. eMMC) or slots without card detection, should not rely on this
+// function.
+func (hw *USDHC) Present() bool {
+	if hw.pres_state == 0 {
+		return false
+	}
+
+	return reg.Get(hw.pres_state, PRES_STATE_CINST, 1) == 1
+}
+
 // Info returns detected card information.
 func (hw *USDHC) Info() CardInfo {
 	return hw.card
@@ -442,12 +484,15 @@ func (hw *USDHC) Init(width int) {
 		panic("invalid uSDHC controller instance")
 	}
 
+	imx6.RegisterRegion("uSDHC", base, imx6.AIPS_SLOT_SIZE)
+
 	hw.width = width
 	hw.blk_att = base + USDHCx_BLK_ATT
 	hw.wtmk_lvl = base + USDHCx_WTMK_LVL
 	hw.cmd_arg = base + USDHCx_CMD_ARG
 	hw.cmd_xfr = base + USDHCx_CMD_XFR_TYP
 	hw.cmd_rsp = base + USDHCx_CMD_RSP0
+	hw.data_buff = base + USDHCx_DATA_BUFF_ACC_PORT
 	hw.prot_ctrl = base + USDHCx_PROT_CTRL
 	hw.sys_ctrl = base + USDHCx_SYS_CTRL
 	hw.mix_ctrl = base + USDHCx_MIX_CTRL
@@ -477,6 +522,10 @@ func (hw *USDHC) Init(width int) {
 // driver, card and controller is automatically selected. Speed modes that
 // require voltage switching require definition of function VoltageSelect on
 // the USDHC instance, which is up to board packages.
+//
+// All controller and card operations are bounded by timeouts, so that an
+// error is returned, rather than execution being stalled, in case of missing
+// or unresponsive cards.
 func (hw *USDHC) Detect() (err error) {
 	hw.Lock()
 	defer hw.Unlock()
@@ -489,11 +538,14 @@ func (hw *USDHC) Detect() (err error) {
 	hw.card = CardInfo{}
 
 	// enable clock
-	reg.SetN(imx6.CCM_CCGR6, hw.cg, 0b11, 0b11)
+	imx6.EnableClock(imx6.ClockGate{CCGR: imx6.CCM_CCGR6, CG: hw.cg})
 
 	// soft reset uSDHC
 	reg.Set(hw.sys_ctrl, SYS_CTRL_RSTA)
-	reg.Wait(hw.sys_ctrl, SYS_CTRL_RSTA, 1, 0)
+
+	if !reg.WaitFor(ctrlTimeout, hw.sys_ctrl, SYS_CTRL_RSTA, 1, 0) {
+		return fmt.Errorf("uSDHC%d reset %w", hw.n, imx6.ErrTimeout)
+	}
 
 	// A soft reset fails to clear MIX_CTRL register, clear it all except
 	// tuning bits.
@@ -526,7 +578,9 @@ func (hw *USDHC) Detect() (err error) {
 	// clear clock
 	hw.setClock(-1, -1)
 	// set identification frequency
-	hw.setClock(DVS_ID, SDCLKFS_ID)
+	if err = hw.setClock(DVS_ID, SDCLKFS_ID); err != nil {
+		return
+	}
 
 	// set data timeout counter to SDCLK x 2^28
 	reg.Clear(hw.int_status_en, INT_STATUS_EN_DTOESEN)
@@ -535,7 +589,10 @@ func (hw *USDHC) Detect() (err error) {
 
 	// initialize
 	reg.Set(hw.sys_ctrl, SYS_CTRL_INITA)
-	reg.Wait(hw.sys_ctrl, SYS_CTRL_INITA, 1, 0)
+
+	if !reg.WaitFor(ctrlTimeout, hw.sys_ctrl, SYS_CTRL_INITA, 1, 0) {
+		return fmt.Errorf("uSDHC%d initialization %w", hw.n, imx6.ErrTimeout)
+	}
 
 	// CMD0 - GO_IDLE_STATE - reset card
 	if err = hw.cmd(0, GO_IDLE_STATE, 0, 0); err != nil {
@@ -599,17 +656,28 @@ func (hw *USDHC) transfer(index uint32, dtd uint32, offset uint64, blocks uint32
 	// set block count
 	reg.SetN(hw.blk_att, BLK_ATT_BLKCNT, 0xffff, blocks)
 
-	bufAddress := dma.Alloc(buf, 32)
-	defer dma.Free(bufAddress)
+	var bufAddress uint32
+
+	if hw.PIO {
+		hw.pioBuf = buf
+		hw.pioBlockSize = blockSize
 
-	// ADMA2 descriptor
-	bd := &ADMABufferDescriptor{}
-	bd.Init(bufAddress, len(buf))
+		defer func() {
+			hw.pioBuf = nil
+		}()
+	} else {
+		bufAddress = dma.Alloc(buf, 32)
+		defer dma.Free(bufAddress)
+
+		// ADMA2 descriptor
+		bd := &ADMABufferDescriptor{}
+		bd.Init(bufAddress, len(buf))
 
-	bdAddress := dma.Alloc(bd.Bytes(), 4)
-	defer dma.Free(bdAddress)
+		bdAddress := dma.Alloc(bd.Bytes(), 4)
+		defer dma.Free(bdAddress)
 
-	reg.Write(hw.adma_sys_addr, bdAddress)
+		reg.Write(hw.adma_sys_addr, bdAddress)
+	}
 
 	if hw.card.HC && index != 6 {
 		// p102, 4.3.14 Command Functional Difference in Card Capacity Types, SD-PL-7.10
@@ -658,7 +726,7 @@ func (hw *USDHC) transfer(index uint32, dtd uint32, offset uint64, blocks uint32
 		return fmt.Errorf("len:%d offset:%#x timeout:%v ADMA:%#x", len(buf), offset, timeout, adma_err)
 	}
 
-	if dtd == READ {
+	if dtd == READ && !hw.PIO {
 		dma.Read(bufAddress, 0, buf)
 	}
 